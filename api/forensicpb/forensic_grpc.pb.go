@@ -0,0 +1,268 @@
+// Service definition of the forgery detection, mirroring the HTTP API of `forensic serve`.
+//
+// The Go stubs of the forensicpb package are generated with 'make proto', that is:
+//
+//   protoc --go_out=. --go_opt=module=github.com/esimov/forensic \
+//          --go-grpc_out=. --go-grpc_opt=module=github.com/esimov/forensic api/forensic.proto
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.4.0
+// - protoc             (unknown)
+// source: api/forensic.proto
+
+package forensicpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.62.0 or later.
+const _ = grpc.SupportPackageIsVersion8
+
+const (
+	Forensic_Detect_FullMethodName       = "/forensic.v1.Forensic/Detect"
+	Forensic_StreamDetect_FullMethodName = "/forensic.v1.Forensic/StreamDetect"
+	Forensic_ListMethods_FullMethodName  = "/forensic.v1.Forensic/ListMethods"
+)
+
+// ForensicClient is the client API for Forensic service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type ForensicClient interface {
+	// Detect analyzes the image streamed in chunks and returns the result.
+	Detect(ctx context.Context, opts ...grpc.CallOption) (Forensic_DetectClient, error)
+	// StreamDetect analyzes the image streamed in chunks and streams the progress
+	// of the analysis stages, followed by the result.
+	StreamDetect(ctx context.Context, opts ...grpc.CallOption) (Forensic_StreamDetectClient, error)
+	// ListMethods returns the detection methods, the feature extractors and the parameter presets.
+	ListMethods(ctx context.Context, in *ListMethodsRequest, opts ...grpc.CallOption) (*ListMethodsResponse, error)
+}
+
+type forensicClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewForensicClient(cc grpc.ClientConnInterface) ForensicClient {
+	return &forensicClient{cc}
+}
+
+func (c *forensicClient) Detect(ctx context.Context, opts ...grpc.CallOption) (Forensic_DetectClient, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Forensic_ServiceDesc.Streams[0], Forensic_Detect_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &forensicDetectClient{ClientStream: stream}
+	return x, nil
+}
+
+type Forensic_DetectClient interface {
+	Send(*DetectRequest) error
+	CloseAndRecv() (*DetectResponse, error)
+	grpc.ClientStream
+}
+
+type forensicDetectClient struct {
+	grpc.ClientStream
+}
+
+func (x *forensicDetectClient) Send(m *DetectRequest) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *forensicDetectClient) CloseAndRecv() (*DetectResponse, error) {
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	m := new(DetectResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *forensicClient) StreamDetect(ctx context.Context, opts ...grpc.CallOption) (Forensic_StreamDetectClient, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Forensic_ServiceDesc.Streams[1], Forensic_StreamDetect_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &forensicStreamDetectClient{ClientStream: stream}
+	return x, nil
+}
+
+type Forensic_StreamDetectClient interface {
+	Send(*DetectRequest) error
+	Recv() (*DetectEvent, error)
+	grpc.ClientStream
+}
+
+type forensicStreamDetectClient struct {
+	grpc.ClientStream
+}
+
+func (x *forensicStreamDetectClient) Send(m *DetectRequest) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *forensicStreamDetectClient) Recv() (*DetectEvent, error) {
+	m := new(DetectEvent)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *forensicClient) ListMethods(ctx context.Context, in *ListMethodsRequest, opts ...grpc.CallOption) (*ListMethodsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListMethodsResponse)
+	err := c.cc.Invoke(ctx, Forensic_ListMethods_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ForensicServer is the server API for Forensic service.
+// All implementations must embed UnimplementedForensicServer
+// for forward compatibility
+type ForensicServer interface {
+	// Detect analyzes the image streamed in chunks and returns the result.
+	Detect(Forensic_DetectServer) error
+	// StreamDetect analyzes the image streamed in chunks and streams the progress
+	// of the analysis stages, followed by the result.
+	StreamDetect(Forensic_StreamDetectServer) error
+	// ListMethods returns the detection methods, the feature extractors and the parameter presets.
+	ListMethods(context.Context, *ListMethodsRequest) (*ListMethodsResponse, error)
+	mustEmbedUnimplementedForensicServer()
+}
+
+// UnimplementedForensicServer must be embedded to have forward compatible implementations.
+type UnimplementedForensicServer struct {
+}
+
+func (UnimplementedForensicServer) Detect(Forensic_DetectServer) error {
+	return status.Errorf(codes.Unimplemented, "method Detect not implemented")
+}
+func (UnimplementedForensicServer) StreamDetect(Forensic_StreamDetectServer) error {
+	return status.Errorf(codes.Unimplemented, "method StreamDetect not implemented")
+}
+func (UnimplementedForensicServer) ListMethods(context.Context, *ListMethodsRequest) (*ListMethodsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListMethods not implemented")
+}
+func (UnimplementedForensicServer) mustEmbedUnimplementedForensicServer() {}
+
+// UnsafeForensicServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to ForensicServer will
+// result in compilation errors.
+type UnsafeForensicServer interface {
+	mustEmbedUnimplementedForensicServer()
+}
+
+func RegisterForensicServer(s grpc.ServiceRegistrar, srv ForensicServer) {
+	s.RegisterService(&Forensic_ServiceDesc, srv)
+}
+
+func _Forensic_Detect_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(ForensicServer).Detect(&forensicDetectServer{ServerStream: stream})
+}
+
+type Forensic_DetectServer interface {
+	SendAndClose(*DetectResponse) error
+	Recv() (*DetectRequest, error)
+	grpc.ServerStream
+}
+
+type forensicDetectServer struct {
+	grpc.ServerStream
+}
+
+func (x *forensicDetectServer) SendAndClose(m *DetectResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *forensicDetectServer) Recv() (*DetectRequest, error) {
+	m := new(DetectRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _Forensic_StreamDetect_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(ForensicServer).StreamDetect(&forensicStreamDetectServer{ServerStream: stream})
+}
+
+type Forensic_StreamDetectServer interface {
+	Send(*DetectEvent) error
+	Recv() (*DetectRequest, error)
+	grpc.ServerStream
+}
+
+type forensicStreamDetectServer struct {
+	grpc.ServerStream
+}
+
+func (x *forensicStreamDetectServer) Send(m *DetectEvent) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *forensicStreamDetectServer) Recv() (*DetectRequest, error) {
+	m := new(DetectRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _Forensic_ListMethods_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListMethodsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ForensicServer).ListMethods(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Forensic_ListMethods_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ForensicServer).ListMethods(ctx, req.(*ListMethodsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Forensic_ServiceDesc is the grpc.ServiceDesc for Forensic service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Forensic_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "forensic.v1.Forensic",
+	HandlerType: (*ForensicServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ListMethods",
+			Handler:    _Forensic_ListMethods_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Detect",
+			Handler:       _Forensic_Detect_Handler,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "StreamDetect",
+			Handler:       _Forensic_StreamDetect_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "api/forensic.proto",
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"math"
+)
+
+const (
+	// flatBlockDeviation is the standard deviation of the luminance below which a block is considered flat.
+	flatBlockDeviation = 2.0
+	// referenceArea is the image area (320x240) the default forgery threshold is tuned for.
+	referenceArea = 320 * 240
+)
+
+// imageProperties are the image characteristics the automatic parameters are derived from.
+type imageProperties struct {
+	width, height         int
+	origWidth, origHeight int
+	// quality is the estimated JPEG quality, 0 for the other formats.
+	quality int
+	// noise is the estimated standard deviation of the noise, after blurring.
+	noise float64
+	// flat is the fraction of the flat blocks.
+	flat float64
+}
+
+// estimateNoise estimates the standard deviation of the gaussian noise of the luminance channel,
+// using the method described by J. Immerkær in "Fast Noise Variance Estimation" (1996).
+// The image structures are mostly cancelled by the difference of two Laplacian masks.
+func estimateNoise(lum []float64, w, h int) float64 {
+	if w < 3 || h < 3 {
+		return 0
+	}
+	var sum float64
+	for y := 1; y < h-1; y++ {
+		for x := 1; x < w-1; x++ {
+			i := y*w + x
+			v := lum[i-w-1] - 2*lum[i-w] + lum[i-w+1] -
+				2*lum[i-1] + 4*lum[i] - 2*lum[i+1] +
+				lum[i+w-1] - 2*lum[i+w] + lum[i+w+1]
+			sum += math.Abs(v)
+		}
+	}
+	return sum * math.Sqrt(math.Pi/2) / (6 * float64(w-2) * float64(h-2))
+}
+
+// flatFraction returns the fraction of the non-overlapping blocks whose luminance
+// standard deviation is below flatBlockDeviation, but not below min.
+func flatFraction(lum []float64, w, h, blockSize int, min float64) float64 {
+	var flat, total int
+	for by := 0; by+blockSize <= h; by += blockSize {
+		for bx := 0; bx+blockSize <= w; bx += blockSize {
+			if d := blockDeviation(lum, w, bx, by, blockSize); d >= min && d < flatBlockDeviation {
+				flat++
+			}
+			total++
+		}
+	}
+	if total == 0 {
+		return 0
+	}
+	return float64(flat) / float64(total)
+}
+
+// blockDeviation returns the standard deviation of the luminance of the block having its upper left corner at (x, y).
+func blockDeviation(lum []float64, w, x, y, blockSize int) float64 {
+	var sum, sumSq float64
+	for j := y; j < y+blockSize; j++ {
+		for i := x; i < x+blockSize; i++ {
+			v := lum[j*w+i]
+			sum += v
+			sumSq += v * v
+		}
+	}
+	n := float64(blockSize * blockSize)
+	mean := sum / n
+	return math.Sqrt(math.Max(sumSq/n-mean*mean, 0))
+}
+
+// autoParams derives the parameters not fixed by the user (on the command line, in the configuration file
+// or by a preset) from the content of the image: the block size from its resolution, the blur radius from
+// the JPEG quality, the distance threshold from the noise level and the offset threshold from the fraction
+// of flat blocks, which produce most of the false matches. The minimum region area is scaled with the image area.
+// It returns the new parameters together with the explanation of the chosen values.
+func autoParams(path string, img image.Image, p *params) (*params, []string, error) {
+	q := *p
+	var notes []string
+	choose := func(name, value, reason string) {
+		if q.fixed[name] {
+			notes = append(notes, fmt.Sprintf("%s=%s: set by the user", name, q.get(name)))
+			return
+		}
+		q.set(name, value)
+		notes = append(notes, fmt.Sprintf("%s=%s: %s", name, value, reason))
+	}
+
+	prop := imageProperties{width: img.Bounds().Dx(), height: img.Bounds().Dy()}
+	prop.origWidth, prop.origHeight = prop.width, prop.height
+	if meta, err := readMetadata(path); err == nil {
+		prop.origWidth, prop.origHeight, prop.quality = meta.Width, meta.Height, meta.Quality
+	}
+
+	// JPEG quality
+	switch {
+	case prop.quality == 0:
+		choose("blur", "1", "lossless image")
+	case prop.quality < 70:
+		choose("blur", "2", fmt.Sprintf("strong compression artifacts (estimated JPEG quality %d)", prop.quality))
+	default:
+		choose("blur", "1", fmt.Sprintf("estimated JPEG quality %d", prop.quality))
+	}
+
+	// The noise and the texture are measured on the image as seen by the feature extractor.
+	nrgba := imgToNRGBA(img)
+	if q.BlurRadius > 0 {
+		nrgba = StackBlur(nrgba, uint32(q.BlurRadius))
+	}
+	lum := luminance(nrgba)
+	prop.noise = estimateNoise(lum, prop.width, prop.height)
+
+	// Resolution and noise level. Larger blocks average the noise out.
+	size := prop.width
+	if prop.height > size {
+		size = prop.height
+	}
+	bs := 4
+	if size > 800 {
+		bs = 8
+	} else if size > 400 {
+		bs = 6
+	}
+	reason := fmt.Sprintf("analyzed resolution %dx%d (original %dx%d)", prop.width, prop.height, prop.origWidth, prop.origHeight)
+	if prop.noise > 3 && bs < 8 {
+		bs += 2
+		reason += fmt.Sprintf(", larger blocks to average the noise (σ=%.2f)", prop.noise)
+	}
+	choose("bs", fmt.Sprint(bs), reason)
+
+	minArea := math.Max(64, math.Round(210*float64(prop.width*prop.height)/referenceArea))
+	choose("minarea", fmt.Sprint(minArea), fmt.Sprintf("minimum region area scaled with the image area of %d px", prop.width*prop.height))
+
+	// The averaged block values of two noisy copies differ by about 2.5σ/bs,
+	// so the threshold is set well above this distance.
+	dt := math.Min(2, math.Max(0.2, 5*prop.noise/float64(q.BlockSize)))
+	choose("dt", fmt.Sprintf("%.2f", dt), fmt.Sprintf("estimated noise σ=%.2f after blurring", prop.noise))
+
+	// Flat blocks. The blocks below the texture threshold are not matched at all.
+	prop.flat = flatFraction(lum, prop.width, prop.height, q.BlockSize, q.TextureThreshold)
+	blocks := (prop.width - q.BlockSize + 1) * (prop.height - q.BlockSize + 1)
+	ot := math.Round(float64(voteThreshold(blocks)) * (1 + 4*prop.flat))
+	choose("ot", fmt.Sprint(ot), fmt.Sprintf("%.0f%% of flat blocks above the texture threshold", 100*prop.flat))
+
+	if err := q.validate(); err != nil {
+		return nil, nil, err
+	}
+	return &q, notes, nil
+}
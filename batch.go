@@ -0,0 +1,363 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// imageExtensions are the file extensions considered when walking through a directory.
+var imageExtensions = map[string]bool{
+	".jpg":  true,
+	".jpeg": true,
+	".png":  true,
+}
+
+// batchInput is an image file to be processed in batch mode.
+type batchInput struct {
+	path string
+	// rel is the path of the output file relative to the output directory, without extension.
+	rel string
+}
+
+// batchEntry is the summary of the analysis of a single image.
+type batchEntry struct {
+	Input    string  `json:"input"`
+	Output   string  `json:"output,omitempty"`
+	Status   string  `json:"status"`
+	Error    string  `json:"error,omitempty"`
+	Score    float64 `json:"score"`
+	Forged   bool    `json:"forged"`
+	Regions  int     `json:"regions"`
+	Excluded int     `json:"excluded"`
+	Duration float64 `json:"duration"`
+	Config   *params `json:"config,omitempty"`
+	// Evidence explains the score, the probability of a forgery in percent.
+	Evidence *evidence `json:"evidence,omitempty"`
+	// Fusion lists the detectors fused into the score, if any.
+	Fusion *fusion `json:"fusion,omitempty"`
+	// Auto explains the parameters chosen in automatic mode.
+	Auto []string `json:"auto,omitempty"`
+
+	// reason classifies the failures in the metrics.
+	reason string
+	// files are the output files of the analysis, recorded in the chain-of-custody manifest.
+	files []string
+}
+
+// isBatchInput reports whether the input designates possibly more than one image.
+func isBatchInput(input string) bool {
+	if strings.HasPrefix(input, "@") || strings.ContainsAny(input, "*?[") {
+		return true
+	}
+	fi, err := os.Stat(input)
+	return err == nil && fi.IsDir()
+}
+
+// expandInputs resolves the batch inputs to the list of image files. An input can be an image file,
+// a directory which is walked recursively, a glob pattern or a file list prefixed with @,
+// containing one input per line. Empty lines and lines starting with # are ignored.
+func expandInputs(inputs []string) ([]batchInput, error) {
+	files, err := expand(inputs)
+	if err != nil {
+		return nil, err
+	}
+
+	// Make sure the output files of different inputs don't overwrite each other.
+	used := make(map[string]bool)
+	for i, f := range files {
+		for n := 1; used[files[i].rel]; n++ {
+			files[i].rel = fmt.Sprintf("%s_%d", f.rel, n)
+		}
+		used[files[i].rel] = true
+	}
+	return files, nil
+}
+
+// expand resolves recursively the batch inputs to the list of image files.
+func expand(inputs []string) ([]batchInput, error) {
+	var files []batchInput
+	for _, input := range inputs {
+		switch {
+		case strings.HasPrefix(input, "@"):
+			list, err := readFileList(input[1:])
+			if err != nil {
+				return nil, err
+			}
+			expanded, err := expand(list)
+			if err != nil {
+				return nil, err
+			}
+			files = append(files, expanded...)
+		case strings.ContainsAny(input, "*?["):
+			matches, err := filepath.Glob(input)
+			if err != nil {
+				return nil, fmt.Errorf("invalid glob pattern %q: %v", input, err)
+			}
+			for _, m := range matches {
+				if fi, err := os.Stat(m); err == nil && !fi.IsDir() {
+					files = append(files, batchInput{path: m, rel: outputName(m)})
+				}
+			}
+		default:
+			fi, err := os.Stat(input)
+			if err != nil {
+				return nil, err
+			}
+			if !fi.IsDir() {
+				files = append(files, batchInput{path: input, rel: outputName(input)})
+				continue
+			}
+			err = filepath.Walk(input, func(path string, info os.FileInfo, err error) error {
+				if err != nil {
+					return err
+				}
+				if info.IsDir() || !imageExtensions[strings.ToLower(filepath.Ext(path))] {
+					return nil
+				}
+				// Keep the directory structure of the input in the output directory.
+				rel, err := filepath.Rel(input, path)
+				if err != nil {
+					return err
+				}
+				files = append(files, batchInput{path: path, rel: outputName(rel)})
+				return nil
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return files, nil
+}
+
+// readFileList returns the inputs listed in the file.
+func readFileList(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var list []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		list = append(list, line)
+	}
+	return list, scanner.Err()
+}
+
+// outputName returns the output file name of an input, without extension.
+func outputName(path string) string {
+	if filepath.IsAbs(path) || strings.HasPrefix(filepath.Clean(path), "..") {
+		path = filepath.Base(path)
+	}
+	return strings.TrimSuffix(filepath.Clean(path), filepath.Ext(path))
+}
+
+// runBatch analyzes the images concurrently and writes the results into the output directory,
+// together with the summary of the batch. The failure of an image doesn't abort the batch.
+// It returns the summary entries of the images, in the order of the inputs.
+// The debug images are written next to the outputs if debug is set.
+func runBatch(inputs []string, outDir, summary string, workers int, resolver *paramsResolver, debug bool) ([]batchEntry, error) {
+	files, err := expandInputs(inputs)
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no images found")
+	}
+	if err := os.MkdirAll(outDir, 0755); err != nil {
+		return nil, err
+	}
+	if summary == "" {
+		summary = filepath.Join(outDir, "summary.csv")
+	}
+
+	// The progress bars of the concurrent analyses would overwrite each other.
+	reporter := progressOutput
+	if _, ok := reporter.(*barReporter); ok || progressMode == "auto" {
+		reporter = nil
+	}
+
+	entries := make([]batchEntry, len(files))
+	jobs := make(chan int)
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		finished int
+	)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				opts := analysisOptions{tracker: &tracker{image: files[i].path, reporter: reporter}, debug: debug}
+				entries[i], _ = analyzeFile(context.Background(), files[i].path, filepath.Join(outDir, files[i].rel+".png"), resolver.resolve, opts)
+
+				mu.Lock()
+				finished++
+				e := entries[i]
+				switch {
+				case logFormat == "json":
+					logger.Info("image analyzed", "input", e.Input, "output", e.Output, "status", e.Status,
+						"error", e.Error, "score", e.Score, "regions", e.Regions, "duration", e.Duration)
+				case outputFormat == "text":
+					if e.Status == "ok" {
+						fmt.Printf("[%d/%d] %s: %s\n", finished, len(files), e.Input, verdict(e.Score))
+					} else {
+						fmt.Printf("[%d/%d] %s: %s\n", finished, len(files), e.Input, e.Error)
+					}
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for i := range files {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	return entries, writeSummary(summary, entries)
+}
+
+// analysisOptions are the settings of an analysis which are not detection parameters.
+type analysisOptions struct {
+	// tracker, if not nil, follows the progress of the analysis.
+	tracker *tracker
+	// debug writes the low-texture blocks excluded from matching into <out>_excluded.png.
+	debug bool
+	// verbose prints the details of the analysis on the console. It is only set
+	// for the single image analyzed from the command line.
+	verbose bool
+}
+
+// analyzeFile processes a single image with the parameters returned by resolve and writes the result into the output file.
+// The errors are reported in the returned entry. The tracker of the options, if not nil, follows the progress of the analysis.
+// The status of the entry is "canceled" if the context is done before the end of the analysis.
+// The detection result is nil in case of error.
+func analyzeFile(ctx context.Context, input, output string, resolve func(string) (*params, error), opts analysisOptions) (entry batchEntry, res *detection) {
+	start := time.Now()
+	entry = batchEntry{
+		Input:  input,
+		Output: output,
+		Status: "ok",
+	}
+
+	fail := func(reason string, err error) {
+		entry.Status = "error"
+		entry.Error = err.Error()
+		entry.Output = ""
+		entry.reason = reason
+	}
+	defer func() {
+		entry.Duration = time.Since(start).Seconds()
+		stats.observeImage(entry)
+	}()
+
+	if err := os.MkdirAll(filepath.Dir(entry.Output), 0755); err != nil {
+		fail("output", err)
+		return
+	}
+	p, err := resolve(input)
+	if err != nil {
+		fail("params", err)
+		return
+	}
+	// The resolved parameters might be shared by several images.
+	q := *p
+	q.analysisOptions = opts
+	p = &q
+	entry.Config = p
+
+	img, err := loadImage(input, p.MaxSize)
+	if err != nil {
+		fail("decode", err)
+		return
+	}
+	if p.Auto {
+		if p, entry.Auto, err = autoParams(input, img, p); err != nil {
+			fail("params", err)
+			return
+		}
+		entry.Config = p
+	}
+	res, err = process(ctx, img, entry.Output, p)
+	if err != nil && err == ctx.Err() {
+		fail("canceled", err)
+		entry.Status = "canceled"
+		return
+	}
+	if err != nil {
+		fail("output", err)
+		return
+	}
+	if len(p.detectors) > 0 {
+		if entry.Fusion, err = fuse(input, img, res, entry.Output, p); err != nil {
+			fail("fusion", err)
+			res = nil
+			return
+		}
+		res.score = 100 * entry.Fusion.Score
+		res.files = append(res.files, entry.Fusion.Heatmap)
+	}
+	entry.files = res.files
+	entry.Score = res.score
+	entry.Forged = res.score > 50.0
+	entry.Regions = len(res.regions)
+	entry.Excluded = res.excluded
+	entry.Evidence = res.evidence
+
+	return
+}
+
+// writeSummary writes the batch summary as JSON or CSV, depending on the file extension.
+func writeSummary(path string, entries []batchEntry) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if strings.ToLower(filepath.Ext(path)) == ".json" {
+		enc := json.NewEncoder(f)
+		enc.SetIndent("", "  ")
+		return enc.Encode(entries)
+	}
+
+	w := csv.NewWriter(f)
+	w.Write([]string{"input", "output", "status", "error", "score", "forged", "regions", "excluded", "duration", "config"})
+	for _, e := range entries {
+		var config string
+		if e.Config != nil {
+			config = e.Config.String()
+		}
+		w.Write([]string{
+			e.Input,
+			e.Output,
+			e.Status,
+			e.Error,
+			strconv.FormatFloat(e.Score, 'f', 2, 64),
+			strconv.FormatBool(e.Forged),
+			strconv.Itoa(e.Regions),
+			strconv.Itoa(e.Excluded),
+			strconv.FormatFloat(e.Duration, 'f', 2, 64),
+			config,
+		})
+	}
+	w.Flush()
+	return w.Error()
+}
@@ -0,0 +1,414 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+	"sync"
+)
+
+var (
+	// Calibration flags
+	calibrateFlags = flag.NewFlagSet("calibrate", flag.ExitOnError)
+
+	calibrateOut = calibrateFlags.String("out", "calibration.json", "Output calibration file")
+	calibrateL2  = calibrateFlags.Float64("l2", 1, "L2 regularization strength of the logistic regression, must be positive")
+)
+
+// calibrationFeatures are the names of the evidence features the calibration models are built on,
+// followed by the scores of the fused detectors (see fuse), which are 0 if they are not run.
+var calibrationFeatures = []string{"score", "area", "regions", "clusters", "coherence", "votes", "ela", "noise", "dq", "meta"}
+
+// evidence gathers the clues of a forgery found by the detection, from which the probability is computed.
+type evidence struct {
+	// Score is the raw score in the [0, 100] range: the fraction of the matched blocks kept
+	// by the post-processing (dct) or the confidence of the consistent offsets (patchmatch).
+	Score float64 `json:"score"`
+	// Area is the fraction of the image covered by the forged regions.
+	Area    float64 `json:"area"`
+	Regions int     `json:"regions"`
+	// Clusters is the number of shift vector clusters (dct only).
+	Clusters int `json:"clusters"`
+	// Coherence is the share of the largest cluster in the matched blocks (dct),
+	// or the mean confidence of the consistent offsets (patchmatch).
+	Coherence float64 `json:"coherence"`
+	// Votes is the number of matched block pairs (dct) or of consistent patches (patchmatch).
+	Votes int `json:"votes"`
+	// Detectors are the scores of the detectors fused with the copy-move detection, in the [0, 1] range.
+	Detectors map[string]float64 `json:"detectors,omitempty"`
+
+	// Probability is the calibrated probability of a forgery, in the [0, 1] range.
+	Probability float64 `json:"probability"`
+	// Contributions are the terms of the log-odds of a forgery, by feature, and the bias of the model.
+	Contributions map[string]float64 `json:"contributions,omitempty"`
+	// Calibration is the calibration file, or "uncalibrated" for the built-in model.
+	Calibration string `json:"calibration"`
+}
+
+// features returns the values of the calibration features. The counts are log-scaled.
+func (e *evidence) features() map[string]float64 {
+	return map[string]float64{
+		"score":     e.Score / 100,
+		"area":      e.Area,
+		"regions":   math.Log1p(float64(e.Regions)),
+		"clusters":  math.Log1p(float64(e.Clusters)),
+		"coherence": e.Coherence,
+		"votes":     math.Log1p(float64(e.Votes)),
+		"ela":       e.Detectors["ela"],
+		"noise":     e.Detectors["noise"],
+		"dq":        e.Detectors["dq"],
+		"meta":      e.Detectors["meta"],
+	}
+}
+
+// calibration is a logistic regression model giving the probability of a forgery from the evidence.
+// The features are standardized with the mean and scale of the fitting data before being weighted.
+type calibration struct {
+	Model    string    `json:"model"`
+	Features []string  `json:"features"`
+	Mean     []float64 `json:"mean"`
+	Scale    []float64 `json:"scale"`
+	Weights  []float64 `json:"weights"`
+	Bias     float64   `json:"bias"`
+
+	// Samples and Forged are the number of images of the fitting data, LogLoss and Brier its fitting errors.
+	Samples int     `json:"samples,omitempty"`
+	Forged  int     `json:"forged,omitempty"`
+	LogLoss float64 `json:"log_loss,omitempty"`
+	Brier   float64 `json:"brier,omitempty"`
+
+	// name is the calibration file.
+	name string
+}
+
+// uncalibrated names the built-in model in the evidence.
+const uncalibrated = "uncalibrated"
+
+// defaultCalibration is the built-in model, used without calibration file. It is not fitted on data:
+// it requires a high raw score on at least one region, like the former verdict, so its probabilities
+// are only scores, and is meant to be replaced by a calibration fitted on images similar to the
+// analyzed ones.
+var defaultCalibration = &calibration{
+	Model:    "logistic",
+	Features: calibrationFeatures,
+	Mean:     []float64{0, 0, 0, 0, 0, 0, 0, 0, 0, 0},
+	Scale:    []float64{1, 1, 1, 1, 1, 1, 1, 1, 1, 1},
+	Weights:  []float64{6, 0, 2, 0, 0, 0, 0, 0, 0, 0},
+	Bias:     -5,
+	name:     uncalibrated,
+}
+
+// calibrations caches the calibration files, shared by the analyses.
+var calibrations = struct {
+	sync.Mutex
+	files map[string]*calibration
+}{files: make(map[string]*calibration)}
+
+// loadCalibration reads the calibration file, or returns the built-in model if the path is empty.
+func loadCalibration(path string) (*calibration, error) {
+	if path == "" {
+		return defaultCalibration, nil
+	}
+	calibrations.Lock()
+	defer calibrations.Unlock()
+	if c, ok := calibrations.files[path]; ok {
+		return c, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	c := &calibration{name: path}
+	if err := json.Unmarshal(data, c); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if err := c.check(); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	calibrations.files[path] = c
+	return c, nil
+}
+
+// check validates the model.
+func (c *calibration) check() error {
+	if c.Model != "logistic" {
+		return fmt.Errorf("unsupported calibration model: %s", c.Model)
+	}
+	n := len(c.Features)
+	if n == 0 || len(c.Mean) != n || len(c.Scale) != n || len(c.Weights) != n {
+		return fmt.Errorf("the features, mean, scale and weights must have the same length")
+	}
+	known := (&evidence{}).features()
+	for i, name := range c.Features {
+		if _, ok := known[name]; !ok {
+			return fmt.Errorf("unknown feature: %s", name)
+		}
+		if c.Scale[i] <= 0 {
+			return fmt.Errorf("the scale of %s must be positive", name)
+		}
+	}
+	return nil
+}
+
+// apply computes the probability of a forgery and the contributions of the features to its log-odds.
+func (c *calibration) apply(e *evidence) {
+	values := e.features()
+	logit := c.Bias
+	e.Contributions = map[string]float64{"bias": c.Bias}
+	for i, name := range c.Features {
+		v := c.Weights[i] * (values[name] - c.Mean[i]) / c.Scale[i]
+		e.Contributions[name] = v
+		logit += v
+	}
+	e.Probability = sigmoid(logit)
+	e.Calibration = c.name
+}
+
+// evidenceRow is a line of the evidence reports. The contribution is empty if the calibration doesn't use the feature.
+type evidenceRow struct {
+	Label, Value, Contribution string
+}
+
+// rows returns the values of the evidence and their contributions to the log-odds of a forgery,
+// in the order of the reports, followed by the bias of the model.
+func (e *evidence) rows() []evidenceRow {
+	type row struct {
+		name, label, value string
+	}
+	values := []row{
+		{"score", "raw score", fmt.Sprintf("%.2f", e.Score)},
+		{"area", "forged area", fmt.Sprintf("%.2f%%", 100*e.Area)},
+		{"regions", "regions", fmt.Sprint(e.Regions)},
+		{"clusters", "clusters", fmt.Sprint(e.Clusters)},
+		{"coherence", "coherence", fmt.Sprintf("%.2f", e.Coherence)},
+		{"votes", "votes", fmt.Sprint(e.Votes)},
+	}
+	for _, name := range detectors {
+		if score, ok := e.Detectors[name]; ok {
+			values = append(values, row{name, name + " score", fmt.Sprintf("%.2f", score)})
+		}
+	}
+	values = append(values, row{"bias", "bias", ""})
+
+	rows := make([]evidenceRow, len(values))
+	for i, v := range values {
+		rows[i] = evidenceRow{Label: v.label, Value: v.value}
+		if c, ok := e.Contributions[v.name]; ok {
+			rows[i].Contribution = fmt.Sprintf("%+.2f", c)
+		}
+	}
+	return rows
+}
+
+// printEvidence prints the evidence of the detection with the contributions of the features.
+func printEvidence(e *evidence) {
+	if e.Calibration == uncalibrated {
+		fmt.Println("Evidence (uncalibrated built-in model, contributions to the log-odds of a forgery):")
+	} else {
+		fmt.Printf("Evidence (calibration %s, contributions to the log-odds of a forgery):\n", e.Calibration)
+	}
+	for _, r := range e.rows() {
+		fmt.Println(strings.TrimRight(fmt.Sprintf("  %-12s %-10s %s", r.Label, r.Value, r.Contribution), " "))
+	}
+}
+
+// sigmoid is the logistic function.
+func sigmoid(x float64) float64 {
+	return 1 / (1 + math.Exp(-x))
+}
+
+// fitCalibration fits a logistic regression with L2 regularization on the evidence of the labelled images,
+// by Newton's method. The bias is not regularized.
+func fitCalibration(samples []*evidence, labels []bool, l2 float64) (*calibration, error) {
+	if l2 <= 0 {
+		return nil, fmt.Errorf("the regularization strength must be positive")
+	}
+	n, d := len(samples), len(calibrationFeatures)
+	c := &calibration{
+		Model:    "logistic",
+		Features: calibrationFeatures,
+		Mean:     make([]float64, d),
+		Scale:    make([]float64, d),
+		Weights:  make([]float64, d),
+		Samples:  n,
+	}
+	for _, forged := range labels {
+		if forged {
+			c.Forged++
+		}
+	}
+	if c.Forged == 0 || c.Forged == n {
+		return nil, fmt.Errorf("the calibration needs both forged and authentic images")
+	}
+
+	// Standardized features, followed by the constant term of the bias.
+	x := make([][]float64, n)
+	for i, e := range samples {
+		values := e.features()
+		x[i] = make([]float64, d+1)
+		for k, name := range calibrationFeatures {
+			x[i][k] = values[name]
+			c.Mean[k] += values[name] / float64(n)
+		}
+		x[i][d] = 1
+	}
+	for k := 0; k < d; k++ {
+		for i := range x {
+			c.Scale[k] += (x[i][k] - c.Mean[k]) * (x[i][k] - c.Mean[k]) / float64(n)
+		}
+		// The constant features are left as is.
+		if c.Scale[k] = math.Sqrt(c.Scale[k]); c.Scale[k] < 1e-9 {
+			c.Scale[k] = 1
+		}
+		for i := range x {
+			x[i][k] = (x[i][k] - c.Mean[k]) / c.Scale[k]
+		}
+	}
+
+	theta := make([]float64, d+1)
+	for iter := 0; iter < 100; iter++ {
+		grad := make([]float64, d+1)
+		hess := make([][]float64, d+1)
+		for k := range hess {
+			hess[k] = make([]float64, d+1)
+		}
+		for i := range x {
+			var z float64
+			for k := range theta {
+				z += theta[k] * x[i][k]
+			}
+			p := sigmoid(z)
+			y := 0.0
+			if labels[i] {
+				y = 1
+			}
+			for k := range theta {
+				grad[k] += (p - y) * x[i][k]
+				for l := range theta {
+					hess[k][l] += p * (1 - p) * x[i][k] * x[i][l]
+				}
+			}
+		}
+		for k := 0; k < d; k++ {
+			grad[k] += l2 * theta[k]
+			hess[k][k] += l2
+		}
+		step, err := solve(hess, grad)
+		if err != nil {
+			return nil, err
+		}
+		var change float64
+		for k := range theta {
+			theta[k] -= step[k]
+			change = math.Max(change, math.Abs(step[k]))
+		}
+		if change < 1e-9 {
+			break
+		}
+	}
+	copy(c.Weights, theta[:d])
+	c.Bias = theta[d]
+
+	for i, e := range samples {
+		p := *e
+		c.apply(&p)
+		y := 0.0
+		if labels[i] {
+			y = 1
+		}
+		q := math.Min(math.Max(p.Probability, 1e-15), 1-1e-15)
+		c.LogLoss -= (y*math.Log(q) + (1-y)*math.Log(1-q)) / float64(n)
+		c.Brier += (p.Probability - y) * (p.Probability - y) / float64(n)
+	}
+	return c, nil
+}
+
+// solve solves the linear system a x = b by Gaussian elimination with partial pivoting.
+// The arguments are modified.
+func solve(a [][]float64, b []float64) ([]float64, error) {
+	n := len(b)
+	for col := 0; col < n; col++ {
+		pivot := col
+		for row := col + 1; row < n; row++ {
+			if math.Abs(a[row][col]) > math.Abs(a[pivot][col]) {
+				pivot = row
+			}
+		}
+		if math.Abs(a[pivot][col]) < 1e-12 {
+			return nil, fmt.Errorf("singular system")
+		}
+		a[col], a[pivot] = a[pivot], a[col]
+		b[col], b[pivot] = b[pivot], b[col]
+		for row := col + 1; row < n; row++ {
+			f := a[row][col] / a[col][col]
+			for k := col; k < n; k++ {
+				a[row][k] -= f * a[col][k]
+			}
+			b[row] -= f * b[col]
+		}
+	}
+	x := make([]float64, n)
+	for row := n - 1; row >= 0; row-- {
+		s := b[row]
+		for k := row + 1; k < n; k++ {
+			s -= a[row][k] * x[k]
+		}
+		x[row] = s / a[row][row]
+	}
+	return x, nil
+}
+
+// runCalibrate fits the calibration model on the evidence recorded in the evaluation results given as argument.
+func runCalibrate(args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+	if *calibrateL2 <= 0 {
+		return fmt.Errorf("the regularization strength must be positive")
+	}
+	entries, err := readEvalCSV(args[0])
+	if err != nil {
+		return err
+	}
+	var (
+		samples []*evidence
+		labels  []bool
+	)
+	for _, e := range entries {
+		if e.Status != "ok" {
+			continue
+		}
+		if e.Evidence == nil {
+			return fmt.Errorf("%s: no evidence recorded for %s", args[0], e.Image)
+		}
+		samples = append(samples, e.Evidence)
+		labels = append(labels, e.Label)
+	}
+	c, err := fitCalibration(samples, labels, *calibrateL2)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(*calibrateOut, append(data, '\n'), 0644); err != nil {
+		return err
+	}
+	if outputFormat == "json" {
+		return printJSON(c)
+	}
+	fmt.Printf("Images: %d (%d forged, %d authentic)\n", c.Samples, c.Forged, c.Samples-c.Forged)
+	fmt.Printf("Log loss %.4f, Brier score %.4f\n", c.LogLoss, c.Brier)
+	for i, name := range c.Features {
+		fmt.Printf("  %-10s weight %+.3f (mean %.3f, scale %.3f)\n", name, c.Weights[i], c.Mean[i], c.Scale[i])
+	}
+	fmt.Printf("  %-10s %+.3f\n", "bias", c.Bias)
+	fmt.Printf("Calibration written to %s\n", *calibrateOut)
+	return nil
+}
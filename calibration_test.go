@@ -0,0 +1,92 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestFitCalibration(t *testing.T) {
+	// The forged images have a higher raw score and forged area, with some overlap between the classes.
+	rng := rand.New(rand.NewSource(1))
+	var (
+		samples []*evidence
+		labels  []bool
+	)
+	for i := 0; i < 200; i++ {
+		forged := i%2 == 0
+		e := &evidence{Score: 20 + 10*rng.NormFloat64(), Area: 0.01 * rng.Float64(), Coherence: rng.Float64()}
+		if forged {
+			e.Score += 40
+			e.Area += 0.05
+			e.Regions, e.Votes = 2, 100+rng.Intn(100)
+		}
+		samples = append(samples, e)
+		labels = append(labels, forged)
+	}
+
+	c, err := fitCalibration(samples, labels, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.check(); err != nil {
+		t.Fatal(err)
+	}
+	if c.Samples != 200 || c.Forged != 100 {
+		t.Errorf("got %d samples, %d forged, want 200 and 100", c.Samples, c.Forged)
+	}
+	if c.LogLoss > 0.2 || c.Brier > 0.05 {
+		t.Errorf("the fitting errors are too large: log loss %.3f, Brier score %.3f", c.LogLoss, c.Brier)
+	}
+	weights := make(map[string]float64)
+	for i, name := range c.Features {
+		weights[name] = c.Weights[i]
+	}
+	if weights["score"] <= 0 || weights["area"] <= 0 {
+		t.Errorf("the score and area weights are %.3f and %.3f, want positive weights", weights["score"], weights["area"])
+	}
+	// The detectors that are not run don't vary, so the regularization keeps their weights at zero.
+	for _, name := range []string{"ela", "noise", "meta"} {
+		if weights[name] != 0 {
+			t.Errorf("the %s weight is %g, want 0 for a constant feature", name, weights[name])
+		}
+	}
+
+	// The fitted model separates the classes.
+	forged, clean := *samples[0], *samples[1]
+	c.apply(&forged)
+	c.apply(&clean)
+	if forged.Probability < 0.9 || clean.Probability > 0.1 {
+		t.Errorf("the probabilities are %.3f (forged) and %.3f (clean)", forged.Probability, clean.Probability)
+	}
+	// The contributions add up to the log-odds.
+	var logit float64
+	for _, v := range forged.Contributions {
+		logit += v
+	}
+	if math.Abs(sigmoid(logit)-forged.Probability) > 1e-9 {
+		t.Errorf("the contributions give the probability %.6f, want %.6f", sigmoid(logit), forged.Probability)
+	}
+
+	// A single class can't be fitted.
+	if _, err := fitCalibration(samples[:1], labels[:1], 1); err == nil {
+		t.Error("fitted the calibration on forged images only")
+	}
+	// Without regularization, the weights of the constant features are not defined.
+	for _, l2 := range []float64{0, -1} {
+		if _, err := fitCalibration(samples, labels, l2); err == nil {
+			t.Errorf("fitted the calibration with the regularization strength %g", l2)
+		}
+	}
+}
+
+func TestDefaultCalibration(t *testing.T) {
+	e := &evidence{Score: 99, Regions: 1}
+	defaultCalibration.apply(e)
+	if e.Calibration != "uncalibrated" {
+		t.Errorf("the built-in model is named %q, want uncalibrated", e.Calibration)
+	}
+	if e.Probability < 0.5 {
+		t.Errorf("the built-in model gives the probability %.3f to a high raw score", e.Probability)
+	}
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"runtime"
+	"strings"
+)
+
+// command is a forensic subcommand, having its own set of flags.
+type command struct {
+	name  string
+	args  string
+	short string
+	flags *flag.FlagSet
+	run   func(args []string) error
+}
+
+// usage prints the usage of the command together with its flags.
+func (c *command) usage() {
+	fmt.Fprintf(os.Stderr, "Usage: forensic %s [options] %s\n\n%s.\n\nOptions:\n", c.name, c.args, c.short)
+	c.flags.PrintDefaults()
+}
+
+// errUsage is returned by the commands invoked with invalid arguments.
+var errUsage = errors.New("invalid usage")
+
+var (
+	// Global options, accepted both before and after the command name.
+	workers      int
+	verbosity    int
+	outputFormat string
+	logFormat    string
+	progressMode string
+	quiet        bool
+
+	// logger writes the diagnostic messages to the standard error.
+	logger = newLogger("text", 1)
+	// progressOutput renders the progress of the analyses on the console, if not nil.
+	progressOutput progressReporter
+
+	globalFlags = flag.NewFlagSet("forensic", flag.ContinueOnError)
+	commands    []*command
+)
+
+// addGlobalFlags registers the global options on the flag set.
+func addGlobalFlags(fs *flag.FlagSet) {
+	fs.IntVar(&workers, "workers", runtime.NumCPU(), "Number of images processed concurrently")
+	fs.IntVar(&verbosity, "v", 1, "Verbosity level: 0 (result only), 1 (details), 2 (debug)")
+	fs.StringVar(&outputFormat, "format", "text", "Output format: text, json")
+	fs.StringVar(&logFormat, "log-format", "text", "Log format: text, json")
+	fs.StringVar(&progressMode, "progress", "auto", "Progress output on the standard error: auto, bar, plain, json, none")
+	fs.BoolVar(&quiet, "quiet", false, "Print the results only, without progress and logs below the warnings (same as -v 0 -progress none)")
+}
+
+// newLogger creates the structured logger of the given format. The level depends on the verbosity:
+// only the warnings and errors are logged at level 0, the debug messages at level 2.
+func newLogger(format string, verbosity int) *slog.Logger {
+	level := slog.LevelInfo
+	switch {
+	case verbosity <= 0:
+		level = slog.LevelWarn
+	case verbosity > 1:
+		level = slog.LevelDebug
+	}
+	opts := &slog.HandlerOptions{Level: level}
+	if format == "json" {
+		return slog.New(slog.NewJSONHandler(os.Stderr, opts))
+	}
+	return slog.New(slog.NewTextHandler(os.Stderr, opts))
+}
+
+// newCommand creates a new command and registers the global options on its flag set.
+func newCommand(name, args, short string, flags *flag.FlagSet, run func(args []string) error) *command {
+	c := &command{
+		name:  name,
+		args:  args,
+		short: short,
+		flags: flags,
+		run:   run,
+	}
+	c.flags.Usage = c.usage
+	addGlobalFlags(c.flags)
+	return c
+}
+
+func init() {
+	addGlobalFlags(globalFlags)
+	// The parse errors of the global options are handled by dispatch.
+	globalFlags.Usage = func() {}
+
+	commands = []*command{
+		newCommand("detect", "<file|dir|glob|@filelist.txt>...", "Detect the copy-move forgeries of the images", detectFlags, runDetect),
+		newCommand("ela", "<image>", "Run the error level analysis of a JPEG image", elaFlags, runELA),
+		newCommand("meta", "<image>", "Print the file and format metadata of an image", metaFlags, runMeta),
+		newCommand("report", "<image>", "Analyze an image into a self-contained HTML report", reportFlags, runReport),
+		newCommand("generate", "<file|dir|glob|@filelist.txt>...", "Generate copy-move forgeries of clean images with their ground truth", generateFlags, runGenerate),
+		newCommand("eval", "<dataset dir>", "Evaluate the detection on a labelled dataset", evalFlags, runEval),
+		newCommand("curves", "<eval.csv>", "Compute the ROC and precision-recall curves of an evaluation", curvesFlags, runCurves),
+		newCommand("calibrate", "<eval.csv>", "Fit the calibration of the forgery probability on the results of an evaluation", calibrateFlags, runCalibrate),
+		newCommand("tune", "<dataset dir>", "Search the detection parameters giving the best results on a labelled dataset", tuneFlags, runTune),
+		newCommand("replay", "<manifest.json>", "Replay the analyses of a chain-of-custody manifest and compare the outputs", replayFlags, runReplay),
+		newCommand("keygen", "", "Generate the Ed25519 key pair signing the manifests", keygenFlags, runKeygen),
+		newCommand("verify", "<manifest.json>", "Verify the signature of a manifest and the hashes of the files it references", verifyFlags, runVerify),
+		newCommand("serve", "", "Serve the forgery detection over an HTTP API", serveFlags, runServe),
+		newCommand("version", "", "Print the version information", flag.NewFlagSet("version", flag.ExitOnError), runVersion),
+		newCommand("help", "[command]", "Print the usage of a command", flag.NewFlagSet("help", flag.ExitOnError), runHelp),
+	}
+}
+
+// usage prints the list of the commands and the global options.
+func usage() {
+	fmt.Fprintf(os.Stderr, Banner, Version)
+	fmt.Fprintf(os.Stderr, "Usage: forensic [global options] <command> [options] [arguments]\n\nCommands:\n")
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-10s%s\n", c.name, c.short)
+	}
+	fmt.Fprintf(os.Stderr, "\nRun 'forensic help <command>' for the options of a command.\n"+
+		"'forensic -in input.jpg -out output.png' is an alias of 'forensic detect'.\n\nGlobal options:\n")
+	globalFlags.PrintDefaults()
+}
+
+// lookupCommand returns the command with the given name or nil.
+func lookupCommand(name string) *command {
+	for _, c := range commands {
+		if c.name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// dispatch runs the command designated by the arguments. The arguments not starting
+// with a command name, after the global options, are passed to the detect command.
+func dispatch(args []string) error {
+	if len(args) == 0 {
+		usage()
+		return errUsage
+	}
+
+	// Try the global options first. The detection flags of the former,
+	// command-less invocation are unknown at this level.
+	globalFlags.SetOutput(io.Discard)
+	err := globalFlags.Parse(args)
+	globalFlags.SetOutput(os.Stderr)
+	if err == flag.ErrHelp {
+		usage()
+		return nil
+	}
+
+	cmd := lookupCommand("detect")
+	if err == nil && globalFlags.NArg() > 0 {
+		if c := lookupCommand(globalFlags.Arg(0)); c != nil {
+			cmd, args = c, globalFlags.Args()[1:]
+		}
+	}
+	cmd.flags.Parse(args)
+
+	if outputFormat != "text" && outputFormat != "json" {
+		return fmt.Errorf("unsupported output format: %s", outputFormat)
+	}
+	if logFormat != "text" && logFormat != "json" {
+		return fmt.Errorf("unsupported log format: %s", logFormat)
+	}
+	if workers < 1 {
+		return fmt.Errorf("the number of workers must be at least 1")
+	}
+	if quiet {
+		verbosity, progressMode = 0, "none"
+	}
+	logger = newLogger(logFormat, verbosity)
+	// The progress bars and the console report would be mixed up with the JSON logs.
+	interactive = verbosity > 0 && outputFormat == "text" && logFormat == "text"
+	if progressOutput, err = newProgressReporter(progressMode); err != nil {
+		return err
+	}
+
+	err = cmd.run(cmd.flags.Args())
+	if err == errUsage {
+		cmd.usage()
+	}
+	return err
+}
+
+// printJSON writes the value in indented JSON format on the standard output.
+func printJSON(v interface{}) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// runVersion prints the build information.
+func runVersion(args []string) error {
+	version := Version
+	if version == "" {
+		version = "devel"
+	}
+	info := map[string]string{
+		"version": version,
+		"go":      runtime.Version(),
+		"os":      runtime.GOOS,
+		"arch":    runtime.GOARCH,
+	}
+	if outputFormat == "json" {
+		return printJSON(info)
+	}
+	fmt.Printf("forensic version %s %s %s/%s\n", info["version"], info["go"], info["os"], info["arch"])
+	return nil
+}
+
+// runHelp prints the usage of the command given as argument, or the general usage.
+func runHelp(args []string) error {
+	if len(args) == 0 {
+		usage()
+		return nil
+	}
+	c := lookupCommand(args[0])
+	if c == nil {
+		return fmt.Errorf("unknown command: %s (known commands: %s)", args[0], commandNames())
+	}
+	c.usage()
+	return nil
+}
+
+// commandNames returns the comma separated list of the command names.
+func commandNames() string {
+	names := make([]string, len(commands))
+	for i, c := range commands {
+		names[i] = c.name
+	}
+	return strings.Join(names, ", ")
+}
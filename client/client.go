@@ -0,0 +1,140 @@
+// Package client is a Go client of the gRPC API of the forgery detection, served by 'forensic serve -grpc-addr'.
+//
+//	c, err := client.Dial("127.0.0.1:9090")
+//	if err != nil {
+//		return err
+//	}
+//	defer c.Close()
+//
+//	f, err := os.Open("image.jpg")
+//	if err != nil {
+//		return err
+//	}
+//	defer f.Close()
+//	res, err := c.StreamDetect(ctx, "image.jpg", f, map[string]string{"preset": "strict"},
+//		func(p *forensicpb.Progress) {
+//			fmt.Printf("%s: %d/%d\n", p.Stage, p.Current, p.Total)
+//		})
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	"github.com/esimov/forensic/api/forensicpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// ChunkSize is the size of the chunks the images are streamed in.
+const ChunkSize = 64 << 10
+
+// maxResponseSize is the maximum size of the responses, which embed the result images.
+const maxResponseSize = 64 << 20
+
+// Client is a client of the gRPC API of the forgery detection.
+type Client struct {
+	conn *grpc.ClientConn
+	rpc  forensicpb.ForensicClient
+}
+
+// Dial creates a client of the server at the given address. The connection is not encrypted
+// unless the options set the transport credentials.
+func Dial(addr string, opts ...grpc.DialOption) (*Client, error) {
+	opts = append([]grpc.DialOption{
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithDefaultCallOptions(grpc.MaxCallRecvMsgSize(maxResponseSize)),
+	}, opts...)
+	conn, err := grpc.NewClient(addr, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{conn: conn, rpc: forensicpb.NewForensicClient(conn)}, nil
+}
+
+// Close closes the connection to the server.
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// Detect uploads the image read from r and waits for the result of its analysis. The parameters
+// use the names of the detection flags (e.g. "bs", "method", "preset"). The file name is only reported
+// in the result. The analysis is canceled if the context is done first.
+func (c *Client) Detect(ctx context.Context, filename string, r io.Reader, params map[string]string) (*forensicpb.DetectResponse, error) {
+	stream, err := c.rpc.Detect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := upload(stream.Send, filename, r, params); err != nil {
+		return nil, err
+	}
+	return stream.CloseAndRecv()
+}
+
+// ProgressFunc is the callback receiving the progress of an analysis: the name of the running stage
+// (generate, analyze or detect) and its counters. It is called by StreamDetect, from its goroutine.
+type ProgressFunc func(p *forensicpb.Progress)
+
+// StreamDetect is like Detect, calling progress, if not nil, with the counters of the running
+// analysis stage whenever they change.
+func (c *Client) StreamDetect(ctx context.Context, filename string, r io.Reader, params map[string]string, progress ProgressFunc) (*forensicpb.DetectResponse, error) {
+	stream, err := c.rpc.StreamDetect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := upload(stream.Send, filename, r, params); err != nil {
+		return nil, err
+	}
+	if err := stream.CloseSend(); err != nil {
+		return nil, err
+	}
+	for {
+		ev, err := stream.Recv()
+		if err == io.EOF {
+			return nil, errors.New("the server closed the stream without result")
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch e := ev.Event.(type) {
+		case *forensicpb.DetectEvent_Progress:
+			if progress != nil {
+				progress(e.Progress)
+			}
+		case *forensicpb.DetectEvent_Result:
+			return e.Result, nil
+		}
+	}
+}
+
+// ListMethods returns the detection methods, the feature extractors and the parameter presets of the server.
+func (c *Client) ListMethods(ctx context.Context) (*forensicpb.ListMethodsResponse, error) {
+	return c.rpc.ListMethods(ctx, &forensicpb.ListMethodsRequest{})
+}
+
+// upload sends the image in chunks, the first one carrying the file name and the parameters.
+func upload(send func(*forensicpb.DetectRequest) error, filename string, r io.Reader, params map[string]string) error {
+	req := &forensicpb.DetectRequest{Filename: filename, Params: params}
+	buf := make([]byte, ChunkSize)
+	for first := true; ; first = false {
+		n, err := io.ReadFull(r, buf)
+		last := err == io.EOF || err == io.ErrUnexpectedEOF
+		if err != nil && !last {
+			return err
+		}
+		if n > 0 || first {
+			req.Chunk = buf[:n]
+			if err := send(req); err == io.EOF {
+				// The server ended the stream, its status is returned with the response.
+				return nil
+			} else if err != nil {
+				return err
+			}
+			req = new(forensicpb.DetectRequest)
+		}
+		if last {
+			return nil
+		}
+	}
+}
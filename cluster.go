@@ -0,0 +1,158 @@
+package main
+
+import (
+	"image"
+	"math"
+	"sort"
+)
+
+const (
+	// offsetVoteRatio is the fraction of the image blocks which should vote for
+	// the same shift vector for the corresponding regions to be considered suspicious.
+	offsetVoteRatio = 0.001
+	// minOffsetVotes is the lower limit of the automatically computed offset threshold.
+	minOffsetVotes = 10
+)
+
+// shiftCluster contains the pair of blocks having the same transformation and approximately the same shift vector.
+type shiftCluster struct {
+	offsetX, offsetY float64
+	transform        transform
+	blocks           newVector
+}
+
+// bounds returns the upper left position of the cluster's top-left and bottom-right source blocks.
+func (c shiftCluster) bounds() (int, int, int, int) {
+	xmin, ymin := math.MaxInt32, math.MaxInt32
+	xmax, ymax := math.MinInt32, math.MinInt32
+	for _, b := range c.blocks {
+		if b.xa < xmin {
+			xmin = b.xa
+		}
+		if b.ya < ymin {
+			ymin = b.ya
+		}
+		if b.xa > xmax {
+			xmax = b.xa
+		}
+		if b.ya > ymax {
+			ymax = b.ya
+		}
+	}
+	return xmin, ymin, xmax, ymax
+}
+
+// clonePair is a copied region: the source and the target blocks of a shift vector cluster.
+type clonePair struct {
+	transform      transform
+	source, target image.Rectangle
+	blocks         int
+}
+
+// pair returns the regions covered by the source and the target blocks of the cluster.
+func (c shiftCluster) pair(size int) clonePair {
+	p := clonePair{transform: c.transform, blocks: len(c.blocks)}
+	for i, b := range c.blocks {
+		source := image.Rect(b.xa, b.ya, b.xa+size, b.ya+size)
+		target := image.Rect(b.xb, b.yb, b.xb+size, b.yb+size)
+		if i == 0 {
+			p.source, p.target = source, target
+			continue
+		}
+		p.source, p.target = p.source.Union(source), p.target.Union(target)
+	}
+	return p
+}
+
+// voteThreshold returns the offset threshold scaled with the number of image blocks.
+func voteThreshold(blocks int) int {
+	return int(math.Max(minOffsetVotes, math.Round(offsetVoteRatio*float64(blocks))))
+}
+
+// clusterShiftVectors groups the shift vectors of the same transformation whose offsets are within the given tolerance.
+// The vectors are binned on a grid having the tolerance as cell size. Starting from the most
+// voted cell, each cell absorbs its not yet assigned neighbours, so that the offsets perturbed
+// by noise end up in the same cluster, without chaining unrelated offsets together.
+// The progress function, if not nil, is called after each binned vector.
+func clusterShiftVectors(vect []vector, tolerance float64, progress func() int) []shiftCluster {
+	type cell struct {
+		t    transform
+		x, y int
+	}
+
+	bins := make(map[cell][]int)
+	for i, v := range vect {
+		c := cell{v.transform, int(math.Floor(v.offsetX / tolerance)), int(math.Floor(v.offsetY / tolerance))}
+		bins[c] = append(bins[c], i)
+		if progress != nil {
+			progress()
+		}
+	}
+
+	cells := make([]cell, 0, len(bins))
+	for c := range bins {
+		cells = append(cells, c)
+	}
+	sort.Slice(cells, func(i, j int) bool {
+		ci, cj := cells[i], cells[j]
+		if len(bins[ci]) != len(bins[cj]) {
+			return len(bins[ci]) > len(bins[cj])
+		}
+		if ci.t != cj.t {
+			return ci.t < cj.t
+		}
+		if ci.x != cj.x {
+			return ci.x < cj.x
+		}
+		return ci.y < cj.y
+	})
+
+	var groups [][]int
+	assigned := make(map[cell]bool, len(bins))
+	for _, c := range cells {
+		if assigned[c] {
+			continue
+		}
+		var members []int
+		for dx := -1; dx <= 1; dx++ {
+			for dy := -1; dy <= 1; dy++ {
+				n := cell{c.t, c.x + dx, c.y + dy}
+				if _, ok := bins[n]; ok && !assigned[n] {
+					assigned[n] = true
+					members = append(members, bins[n]...)
+				}
+			}
+		}
+		groups = append(groups, members)
+	}
+
+	clusters := make([]shiftCluster, 0, len(groups))
+	for _, members := range groups {
+		// Keep the vectors in their original order.
+		sort.Ints(members)
+
+		c := shiftCluster{transform: vect[members[0]].transform}
+		for _, i := range members {
+			c.offsetX += vect[i].offsetX
+			c.offsetY += vect[i].offsetY
+			c.blocks = append(c.blocks, vect[i])
+		}
+		c.offsetX /= float64(len(members))
+		c.offsetY /= float64(len(members))
+		clusters = append(clusters, c)
+	}
+
+	sort.Slice(clusters, func(i, j int) bool {
+		if len(clusters[i].blocks) != len(clusters[j].blocks) {
+			return len(clusters[i].blocks) > len(clusters[j].blocks)
+		}
+		if clusters[i].transform != clusters[j].transform {
+			return clusters[i].transform < clusters[j].transform
+		}
+		if clusters[i].offsetX != clusters[j].offsetX {
+			return clusters[i].offsetX < clusters[j].offsetX
+		}
+		return clusters[i].offsetY < clusters[j].offsetY
+	})
+	return clusters
+}
@@ -0,0 +1,521 @@
+package main
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	// Curve flags
+	curvesFlags = flag.NewFlagSet("curves", flag.ExitOnError)
+
+	curvesOutDir = curvesFlags.String("outdir", ".", "Output directory of the curves")
+)
+
+// curvePoint is the confusion matrix of the rule classifying the images
+// having a score of at least the threshold as forged.
+type curvePoint struct {
+	Threshold float64 `json:"threshold"`
+	TP        int     `json:"tp"`
+	FP        int     `json:"fp"`
+	TN        int     `json:"tn"`
+	FN        int     `json:"fn"`
+	TPR       float64 `json:"tpr"`
+	FPR       float64 `json:"fpr"`
+	Precision float64 `json:"precision"`
+	F1        float64 `json:"f1"`
+}
+
+// operatingPoint is a remarkable point of the curves: the default verdict (a score above 50),
+// the point maximizing the Youden index (TPR - FPR) and the one maximizing the F1 score.
+type operatingPoint struct {
+	Name string `json:"name"`
+	curvePoint
+}
+
+// curveReport contains the ROC and precision-recall curves of an evaluation.
+type curveReport struct {
+	Images    int     `json:"images"`
+	Forged    int     `json:"forged"`
+	Authentic int     `json:"authentic"`
+	AUC       float64 `json:"auc"`
+	// AP is the average precision, the area under the precision-recall curve.
+	AP     float64          `json:"ap"`
+	Points []operatingPoint `json:"operating_points"`
+	Curve  []curvePoint     `json:"curve"`
+}
+
+// newCurvePoint computes the rates of the confusion matrix.
+func newCurvePoint(threshold float64, tp, fp, tn, fn int) curvePoint {
+	p := curvePoint{Threshold: threshold, TP: tp, FP: fp, TN: tn, FN: fn}
+	p.TPR = ratio(tp, tp+fn)
+	p.FPR = ratio(fp, fp+tn)
+	p.Precision = ratio(tp, tp+fp)
+	p.F1 = ratio(2*tp, 2*tp+fp+fn)
+	return p
+}
+
+// computeCurves sweeps the decision threshold over the scores of the evaluated images, from the highest
+// to the lowest one, and computes the area under the ROC curve, the average precision and the operating points.
+// The failed images are not taken into account.
+func computeCurves(entries []evalEntry) (*curveReport, error) {
+	var scored []evalEntry
+	r := new(curveReport)
+	for _, e := range entries {
+		if e.Status != "ok" {
+			continue
+		}
+		scored = append(scored, e)
+		if e.Label {
+			r.Forged++
+		} else {
+			r.Authentic++
+		}
+	}
+	r.Images = len(scored)
+	if r.Forged == 0 || r.Authentic == 0 {
+		return nil, fmt.Errorf("the curves need both forged and authentic images")
+	}
+	sort.SliceStable(scored, func(i, j int) bool {
+		return scored[i].Score > scored[j].Score
+	})
+
+	var tp, fp int
+	for i, e := range scored {
+		if e.Label {
+			tp++
+		} else {
+			fp++
+		}
+		// The images having the same score are on the same side of the threshold.
+		if i+1 < len(scored) && scored[i+1].Score == e.Score {
+			continue
+		}
+		p := newCurvePoint(e.Score, tp, fp, r.Authentic-fp, r.Forged-tp)
+		prev := curvePoint{}
+		if n := len(r.Curve); n > 0 {
+			prev = r.Curve[n-1]
+		}
+		r.AUC += (p.FPR - prev.FPR) * (p.TPR + prev.TPR) / 2
+		r.AP += (p.TPR - prev.TPR) * p.Precision
+		r.Curve = append(r.Curve, p)
+	}
+
+	tp, fp = 0, 0
+	for _, e := range scored {
+		if e.Score > 50 {
+			if e.Label {
+				tp++
+			} else {
+				fp++
+			}
+		}
+	}
+	r.Points = append(r.Points, operatingPoint{"default", newCurvePoint(50, tp, fp, r.Authentic-fp, r.Forged-tp)})
+	youden, f1 := r.Curve[0], r.Curve[0]
+	for _, p := range r.Curve[1:] {
+		if p.TPR-p.FPR > youden.TPR-youden.FPR {
+			youden = p
+		}
+		if p.F1 > f1.F1 {
+			f1 = p
+		}
+	}
+	r.Points = append(r.Points, operatingPoint{"youden", youden}, operatingPoint{"max-f1", f1})
+	return r, nil
+}
+
+// writeCurveCSV writes the points of the curves, one per threshold.
+func writeCurveCSV(path string, points []curvePoint) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := csv.NewWriter(f)
+	w.Write([]string{"threshold", "tp", "fp", "tn", "fn", "tpr", "fpr", "precision", "recall", "f1"})
+	for _, p := range points {
+		w.Write([]string{
+			strconv.FormatFloat(p.Threshold, 'g', 6, 64),
+			strconv.Itoa(p.TP),
+			strconv.Itoa(p.FP),
+			strconv.Itoa(p.TN),
+			strconv.Itoa(p.FN),
+			strconv.FormatFloat(p.TPR, 'f', 4, 64),
+			strconv.FormatFloat(p.FPR, 'f', 4, 64),
+			strconv.FormatFloat(p.Precision, 'f', 4, 64),
+			strconv.FormatFloat(p.TPR, 'f', 4, 64),
+			strconv.FormatFloat(p.F1, 'f', 4, 64),
+		})
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// plot is a curve drawn in the unit square, with the operating points marked on it.
+type plot struct {
+	title  string
+	xLabel string
+	yLabel string
+	curve  [][2]float64
+	// diagonal draws the line of the random classifier.
+	diagonal bool
+	marks    []plotMark
+}
+
+// plotMark is a marked point of the plot.
+type plotMark struct {
+	name  string
+	x, y  float64
+	color color.NRGBA
+}
+
+// Geometry of the plots in pixels: the plot area is a square of plotSide pixels with the given margins.
+const (
+	plotSide   = 400
+	plotLeft   = 60
+	plotTop    = 40
+	plotRight  = 130
+	plotBottom = 50
+)
+
+var (
+	curveColor = color.NRGBA{0x1f, 0x77, 0xb4, 0xff}
+	gridColor  = color.NRGBA{0xdd, 0xdd, 0xdd, 0xff}
+	axisColor  = color.NRGBA{0x33, 0x33, 0x33, 0xff}
+	// markColors are the colors of the operating points, in the order of the report.
+	markColors = []color.NRGBA{{0xd6, 0x27, 0x28, 0xff}, {0x2c, 0xa0, 0x2c, 0xff}, {0xff, 0x7f, 0x0e, 0xff}}
+)
+
+// rocPlot returns the ROC curve, starting from the origin.
+func (r *curveReport) rocPlot() *plot {
+	pl := &plot{
+		title:    fmt.Sprintf("ROC curve (AUC %.3f)", r.AUC),
+		xLabel:   "False positive rate",
+		yLabel:   "True positive rate",
+		curve:    [][2]float64{{0, 0}},
+		diagonal: true,
+	}
+	for _, p := range r.Curve {
+		pl.curve = append(pl.curve, [2]float64{p.FPR, p.TPR})
+	}
+	for i, p := range r.Points {
+		pl.marks = append(pl.marks, plotMark{p.Name, p.FPR, p.TPR, markColors[i%len(markColors)]})
+	}
+	return pl
+}
+
+// prPlot returns the precision-recall curve, starting from a full precision at a null recall.
+func (r *curveReport) prPlot() *plot {
+	pl := &plot{
+		title:  fmt.Sprintf("Precision-recall curve (AP %.3f)", r.AP),
+		xLabel: "Recall",
+		yLabel: "Precision",
+		curve:  [][2]float64{{0, 1}},
+	}
+	for _, p := range r.Curve {
+		pl.curve = append(pl.curve, [2]float64{p.TPR, p.Precision})
+	}
+	for i, p := range r.Points {
+		pl.marks = append(pl.marks, plotMark{p.Name, p.TPR, p.Precision, markColors[i%len(markColors)]})
+	}
+	return pl
+}
+
+// pixel returns the image coordinates of a point of the unit square.
+func (pl *plot) pixel(x, y float64) (float64, float64) {
+	return plotLeft + x*plotSide, plotTop + (1-y)*plotSide
+}
+
+// writeSVG writes the plot as an SVG image.
+func (pl *plot) writeSVG(w io.Writer) error {
+	width, height := plotLeft+plotSide+plotRight, plotTop+plotSide+plotBottom
+	hex := func(c color.NRGBA) string {
+		return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "<svg xmlns=\"http://www.w3.org/2000/svg\" width=\"%d\" height=\"%d\" viewBox=\"0 0 %d %d\" font-family=\"sans-serif\" font-size=\"12\">\n",
+		width, height, width, height)
+	fmt.Fprintf(&b, "<rect width=\"%d\" height=\"%d\" fill=\"white\"/>\n", width, height)
+	fmt.Fprintf(&b, "<text x=\"%d\" y=\"%d\" text-anchor=\"middle\" font-size=\"14\">%s</text>\n", plotLeft+plotSide/2, plotTop/2+5, pl.title)
+	for i := 0; i <= 10; i += 2 {
+		v := float64(i) / 10
+		x, y := pl.pixel(v, v)
+		fmt.Fprintf(&b, "<line x1=\"%g\" y1=\"%d\" x2=\"%g\" y2=\"%d\" stroke=\"%s\"/>\n", x, plotTop, x, plotTop+plotSide, hex(gridColor))
+		fmt.Fprintf(&b, "<line x1=\"%d\" y1=\"%g\" x2=\"%d\" y2=\"%g\" stroke=\"%s\"/>\n", plotLeft, y, plotLeft+plotSide, y, hex(gridColor))
+		fmt.Fprintf(&b, "<text x=\"%g\" y=\"%d\" text-anchor=\"middle\">%.1f</text>\n", x, plotTop+plotSide+16, v)
+		fmt.Fprintf(&b, "<text x=\"%d\" y=\"%g\" text-anchor=\"end\">%.1f</text>\n", plotLeft-6, y+4, v)
+	}
+	fmt.Fprintf(&b, "<rect x=\"%d\" y=\"%d\" width=\"%d\" height=\"%d\" fill=\"none\" stroke=\"%s\"/>\n", plotLeft, plotTop, plotSide, plotSide, hex(axisColor))
+	fmt.Fprintf(&b, "<text x=\"%d\" y=\"%d\" text-anchor=\"middle\">%s</text>\n", plotLeft+plotSide/2, plotTop+plotSide+40, pl.xLabel)
+	fmt.Fprintf(&b, "<text x=\"16\" y=\"%d\" text-anchor=\"middle\" transform=\"rotate(-90 16 %d)\">%s</text>\n", plotTop+plotSide/2, plotTop+plotSide/2, pl.yLabel)
+	if pl.diagonal {
+		fmt.Fprintf(&b, "<line x1=\"%d\" y1=\"%d\" x2=\"%d\" y2=\"%d\" stroke=\"%s\" stroke-dasharray=\"4 4\"/>\n",
+			plotLeft, plotTop+plotSide, plotLeft+plotSide, plotTop, hex(axisColor))
+	}
+
+	points := make([]string, len(pl.curve))
+	for i, p := range pl.curve {
+		x, y := pl.pixel(p[0], p[1])
+		points[i] = fmt.Sprintf("%.1f,%.1f", x, y)
+	}
+	fmt.Fprintf(&b, "<polyline points=\"%s\" fill=\"none\" stroke=\"%s\" stroke-width=\"2\"/>\n", strings.Join(points, " "), hex(curveColor))
+	for i, m := range pl.marks {
+		x, y := pl.pixel(m.x, m.y)
+		fmt.Fprintf(&b, "<circle cx=\"%.1f\" cy=\"%.1f\" r=\"5\" fill=\"%s\"/>\n", x, y, hex(m.color))
+		ly := plotTop + 20 + 20*i
+		fmt.Fprintf(&b, "<circle cx=\"%d\" cy=\"%d\" r=\"5\" fill=\"%s\"/>\n", plotLeft+plotSide+16, ly-4, hex(m.color))
+		fmt.Fprintf(&b, "<text x=\"%d\" y=\"%d\">%s</text>\n", plotLeft+plotSide+26, ly, m.name)
+	}
+	b.WriteString("</svg>\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// digitGlyphs is a 3x5 pixel font for the tick labels of the PNG plots.
+var digitGlyphs = map[rune][5]string{
+	'0': {"111", "101", "101", "101", "111"},
+	'1': {"010", "110", "010", "010", "111"},
+	'2': {"111", "001", "111", "100", "111"},
+	'3': {"111", "001", "111", "001", "111"},
+	'4': {"101", "101", "111", "001", "001"},
+	'5': {"111", "100", "111", "001", "111"},
+	'6': {"111", "100", "111", "101", "111"},
+	'7': {"111", "001", "001", "001", "001"},
+	'8': {"111", "101", "111", "101", "111"},
+	'9': {"111", "101", "111", "001", "111"},
+	'.': {"000", "000", "000", "000", "010"},
+}
+
+// image renders the plot. Having no font at hand, the title, the axis labels and the legend
+// are left out, the curve and the operating points having the same colors as in the SVG plot.
+func (pl *plot) image() *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, plotLeft+plotSide+plotRight, plotTop+plotSide+plotBottom))
+	for i := range img.Pix {
+		img.Pix[i] = 0xff
+	}
+	fill := func(x0, y0, x1, y1 int, c color.NRGBA) {
+		for y := y0; y < y1; y++ {
+			for x := x0; x < x1; x++ {
+				img.SetNRGBA(x, y, c)
+			}
+		}
+	}
+	// line draws a segment with a width of two pixels, skipping the gaps if dashed.
+	line := func(x0, y0, x1, y1 float64, c color.NRGBA, dashed bool) {
+		n := int(math.Max(math.Abs(x1-x0), math.Abs(y1-y0))) + 1
+		for i := 0; i <= n; i++ {
+			if dashed && (i/4)%2 == 1 {
+				continue
+			}
+			t := float64(i) / float64(n)
+			x, y := int(x0+t*(x1-x0)), int(y0+t*(y1-y0))
+			fill(x-1, y-1, x+1, y+1, c)
+		}
+	}
+	text := func(x, y int, s string) {
+		for _, r := range s {
+			for gy, row := range digitGlyphs[r] {
+				for gx, on := range row {
+					if on == '1' {
+						fill(x+2*gx, y+2*gy, x+2*gx+2, y+2*gy+2, axisColor)
+					}
+				}
+			}
+			x += 8
+		}
+	}
+
+	for i := 0; i <= 10; i += 2 {
+		v := float64(i) / 10
+		x, y := pl.pixel(v, v)
+		fill(int(x), plotTop, int(x)+1, plotTop+plotSide, gridColor)
+		fill(plotLeft, int(y), plotLeft+plotSide, int(y)+1, gridColor)
+		label := strconv.FormatFloat(v, 'f', 1, 64)
+		text(int(x)-12, plotTop+plotSide+8, label)
+		text(plotLeft-32, int(y)-5, label)
+	}
+	fill(plotLeft, plotTop, plotLeft+plotSide+1, plotTop+1, axisColor)
+	fill(plotLeft, plotTop+plotSide, plotLeft+plotSide+1, plotTop+plotSide+1, axisColor)
+	fill(plotLeft, plotTop, plotLeft+1, plotTop+plotSide+1, axisColor)
+	fill(plotLeft+plotSide, plotTop, plotLeft+plotSide+1, plotTop+plotSide+1, axisColor)
+	if pl.diagonal {
+		line(plotLeft, plotTop+plotSide, plotLeft+plotSide, plotTop, axisColor, true)
+	}
+
+	for i := 1; i < len(pl.curve); i++ {
+		x0, y0 := pl.pixel(pl.curve[i-1][0], pl.curve[i-1][1])
+		x1, y1 := pl.pixel(pl.curve[i][0], pl.curve[i][1])
+		line(x0, y0, x1, y1, curveColor, false)
+	}
+	for _, m := range pl.marks {
+		x, y := pl.pixel(m.x, m.y)
+		fill(int(x)-4, int(y)-4, int(x)+5, int(y)+5, m.color)
+	}
+	return img
+}
+
+// writeCurves writes the points of the curves (curves.csv) and the ROC and precision-recall
+// plots (roc.svg, roc.png, pr.svg and pr.png) into the output directory.
+func writeCurves(dir string, r *curveReport) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	if err := writeCurveCSV(filepath.Join(dir, "curves.csv"), r.Curve); err != nil {
+		return err
+	}
+	for name, pl := range map[string]*plot{"roc": r.rocPlot(), "pr": r.prPlot()} {
+		f, err := os.Create(filepath.Join(dir, name+".svg"))
+		if err != nil {
+			return err
+		}
+		err = pl.writeSVG(f)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return err
+		}
+		if err := writePNG(filepath.Join(dir, name+".png"), pl.image()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// printCurves prints the areas under the curves and the operating points.
+func printCurves(r *curveReport) {
+	fmt.Printf("ROC AUC %.3f, average precision %.3f\n", r.AUC, r.AP)
+	for _, p := range r.Points {
+		rule := fmt.Sprintf("score >= %.6g", p.Threshold)
+		if p.Name == "default" {
+			rule = "score > 50"
+		}
+		fmt.Printf("  %-8s %-15s TPR %.3f, FPR %.3f, precision %.3f, F1 %.3f\n", p.Name, rule, p.TPR, p.FPR, p.Precision, p.F1)
+	}
+}
+
+// readEvalCSV reads the per-image results written by the eval command, with the evidence of the detection if recorded.
+func readEvalCSV(path string) ([]evalEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	rows, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("%s: empty file", path)
+	}
+	columns := make(map[string]int)
+	for i, name := range rows[0] {
+		columns[name] = i
+	}
+	for _, name := range []string{"image", "label", "status", "score"} {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("%s: missing column %s", path, name)
+		}
+	}
+
+	var entries []evalEntry
+	for n, row := range rows[1:] {
+		e := evalEntry{Image: row[columns["image"]], Status: row[columns["status"]]}
+		if e.Label, err = strconv.ParseBool(row[columns["label"]]); err != nil {
+			return nil, fmt.Errorf("%s:%d: invalid label: %s", path, n+2, row[columns["label"]])
+		}
+		if e.Score, err = strconv.ParseFloat(row[columns["score"]], 64); err != nil {
+			return nil, fmt.Errorf("%s:%d: invalid score: %s", path, n+2, row[columns["score"]])
+		}
+		if i, ok := columns["raw_score"]; ok && row[i] != "" && e.Status == "ok" {
+			if e.Evidence, err = parseEvidence(row, columns); err != nil {
+				return nil, fmt.Errorf("%s:%d: %v", path, n+2, err)
+			}
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// parseEvidence reads the evidence columns of a row of the evaluation results.
+func parseEvidence(row []string, columns map[string]int) (*evidence, error) {
+	ev := new(evidence)
+	floats := map[string]*float64{"raw_score": &ev.Score, "area": &ev.Area, "coherence": &ev.Coherence}
+	ints := map[string]*int{"regions": &ev.Regions, "clusters": &ev.Clusters, "votes": &ev.Votes}
+	for name, v := range floats {
+		i, ok := columns[name]
+		if !ok {
+			return nil, fmt.Errorf("missing column %s", name)
+		}
+		f, err := strconv.ParseFloat(row[i], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %s", name, row[i])
+		}
+		*v = f
+	}
+	for name, v := range ints {
+		i, ok := columns[name]
+		if !ok {
+			return nil, fmt.Errorf("missing column %s", name)
+		}
+		n, err := strconv.Atoi(row[i])
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %s", name, row[i])
+		}
+		*v = n
+	}
+	// The scores of the detectors are recorded only if they are fused.
+	for _, name := range detectors[1:] {
+		i, ok := columns[name]
+		if !ok || row[i] == "" {
+			continue
+		}
+		score, err := strconv.ParseFloat(row[i], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %s", name, row[i])
+		}
+		if ev.Detectors == nil {
+			ev.Detectors = make(map[string]float64)
+		}
+		ev.Detectors[name] = score
+	}
+	return ev, nil
+}
+
+// runCurves computes the ROC and precision-recall curves of the evaluation results given as argument.
+func runCurves(args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+	entries, err := readEvalCSV(args[0])
+	if err != nil {
+		return err
+	}
+	r, err := computeCurves(entries)
+	if err != nil {
+		return err
+	}
+	if err := writeCurves(*curvesOutDir, r); err != nil {
+		return err
+	}
+	if outputFormat == "json" {
+		return printJSON(r)
+	}
+	fmt.Printf("Images: %d (%d forged, %d authentic)\n", r.Images, r.Forged, r.Authentic)
+	printCurves(r)
+	return nil
+}
@@ -0,0 +1,509 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The chain-of-custody manifest records everything needed to establish the integrity of an analysis
+// and to reproduce it: the hashes of the inputs, the build of the tool, the effective parameters,
+// the platform, the timestamps and the hashes of the output files. Each run is also appended to the
+// run log, whose lines are chained by their hashes, so that a removed or modified line is detected.
+
+var (
+	// Replay flags
+	replayFlags = flag.NewFlagSet("replay", flag.ExitOnError)
+
+	replayOutDir = replayFlags.String("outdir", "", "Output directory of the replayed analyses (default <manifest dir>/replay)")
+	replayLog    = replayFlags.String("runlog", "", "Append-only run log (default custody.log in the directory of the manifest)")
+)
+
+// custodyFile identifies a file by its hashes. The SHA-512 hash is only computed for the analyzed images.
+type custodyFile struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+	SHA512 string `json:"sha512,omitempty"`
+}
+
+// toolBuild identifies the build of the tool. The revision is the VCS revision the binary was built from,
+// if known, and the executable is the SHA-256 hash of the binary.
+type toolBuild struct {
+	Name       string `json:"name"`
+	Version    string `json:"version"`
+	Revision   string `json:"revision,omitempty"`
+	Modified   bool   `json:"modified,omitempty"`
+	Go         string `json:"go"`
+	Executable string `json:"executable,omitempty"`
+}
+
+// custodyRecord is the analysis of an image in the manifest.
+type custodyRecord struct {
+	Input custodyFile `json:"input"`
+	// Files are the other files the result depends on, i.e. the configuration and the calibration files.
+	Files []custodyFile `json:"files,omitempty"`
+	// Params are the effective parameters, after the preset, the configuration file and the automatic mode.
+	Params   *params       `json:"params"`
+	Status   string        `json:"status"`
+	Error    string        `json:"error,omitempty"`
+	Score    float64       `json:"score"`
+	Forged   bool          `json:"forged"`
+	Duration float64       `json:"duration"`
+	Outputs  []custodyFile `json:"outputs"`
+}
+
+// manifest is the chain-of-custody record of a run of the detection.
+type manifest struct {
+	Tool toolBuild `json:"tool"`
+	OS   string    `json:"os"`
+	Arch string    `json:"arch"`
+	// Command is the command line of the run and Dir its working directory, which the relative paths refer to.
+	Command  []string        `json:"command"`
+	Dir      string          `json:"dir"`
+	Debug    bool            `json:"debug,omitempty"`
+	Started  time.Time       `json:"started"`
+	Finished time.Time       `json:"finished"`
+	Images   []custodyRecord `json:"images"`
+	// Outputs are the files of the whole run, i.e. the batch summary and the HTML report.
+	Outputs []custodyFile `json:"outputs,omitempty"`
+}
+
+// hashFile computes the SHA-256 hash of the file and, if strong is set, its SHA-512 hash.
+func hashFile(path string, strong bool) (custodyFile, error) {
+	cf := custodyFile{Path: path}
+	f, err := os.Open(path)
+	if err != nil {
+		return cf, err
+	}
+	defer f.Close()
+
+	h256, h512 := sha256.New(), sha512.New()
+	w := io.Writer(h256)
+	if strong {
+		w = io.MultiWriter(h256, h512)
+	}
+	if cf.Size, err = io.Copy(w, f); err != nil {
+		return cf, err
+	}
+	cf.SHA256 = hex.EncodeToString(h256.Sum(nil))
+	if strong {
+		cf.SHA512 = hex.EncodeToString(h512.Sum(nil))
+	}
+	return cf, nil
+}
+
+// currentBuild returns the build information of the running binary.
+func currentBuild() toolBuild {
+	b := toolBuild{Name: "forensic", Version: Version, Go: runtime.Version()}
+	if b.Version == "" {
+		b.Version = "devel"
+	}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range info.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				b.Revision = s.Value
+			case "vcs.modified":
+				b.Modified = s.Value == "true"
+			}
+		}
+	}
+	if exe, err := os.Executable(); err == nil {
+		if cf, err := hashFile(exe, false); err == nil {
+			b.Executable = cf.SHA256
+		}
+	}
+	return b
+}
+
+// newManifest starts the manifest of the run started at the given time.
+func newManifest(started time.Time) *manifest {
+	dir, _ := os.Getwd()
+	return &manifest{
+		Tool:    currentBuild(),
+		OS:      runtime.GOOS,
+		Arch:    runtime.GOARCH,
+		Command: os.Args,
+		Dir:     dir,
+		Debug:   *debugOutput,
+		Started: started.UTC(),
+	}
+}
+
+// add records the analysis of an image, with the hashes of its input and output files.
+func (m *manifest) add(entry batchEntry) error {
+	rec := custodyRecord{
+		Params:   entry.Config,
+		Status:   entry.Status,
+		Error:    entry.Error,
+		Score:    entry.Score,
+		Forged:   entry.Forged,
+		Duration: entry.Duration,
+		Outputs:  []custodyFile{},
+	}
+	var err error
+	if rec.Input, err = hashFile(entry.Input, true); err != nil {
+		return err
+	}
+	if p := entry.Config; p != nil {
+		for _, path := range []string{p.File, p.Calibration} {
+			if path == "" {
+				continue
+			}
+			cf, err := hashFile(path, false)
+			if err != nil {
+				return err
+			}
+			rec.Files = append(rec.Files, cf)
+		}
+	}
+	for _, path := range entry.files {
+		cf, err := hashFile(path, false)
+		if err != nil {
+			return err
+		}
+		rec.Outputs = append(rec.Outputs, cf)
+	}
+	m.Images = append(m.Images, rec)
+	return nil
+}
+
+// addOutput records an output file of the whole run.
+func (m *manifest) addOutput(path string) error {
+	cf, err := hashFile(path, false)
+	if err != nil {
+		return err
+	}
+	m.Outputs = append(m.Outputs, cf)
+	return nil
+}
+
+// write sets the end time of the run and writes the manifest. It returns the written data.
+func (m *manifest) write(path string) ([]byte, error) {
+	m.Finished = time.Now().UTC()
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	data = append(data, '\n')
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// readManifest reads the manifest file.
+func readManifest(path string) (*manifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	m := new(manifest)
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return m, nil
+}
+
+// manifestName returns the default manifest of a run: next to the output image in single mode,
+// in the output directory in batch mode.
+func manifestName(destination, outDir string) string {
+	if outDir != "" {
+		return filepath.Join(outDir, "manifest.json")
+	}
+	return strings.TrimSuffix(destination, filepath.Ext(destination)) + "_manifest.json"
+}
+
+// runLogName returns the default run log, in the directory of the manifest.
+func runLogName(manifest string) string {
+	return filepath.Join(filepath.Dir(manifest), "custody.log")
+}
+
+// logEvent is a line of the run log. Prev is the SHA-256 hash of the previous line, empty for the first line.
+type logEvent struct {
+	Time     time.Time `json:"time"`
+	Event    string    `json:"event"`
+	Manifest string    `json:"manifest,omitempty"`
+	File     string    `json:"file,omitempty"`
+	SHA256   string    `json:"sha256,omitempty"`
+	Status   string    `json:"status,omitempty"`
+	Prev     string    `json:"prev"`
+}
+
+// lastLine returns the last line of the file, without its newline, or nil if the file is empty or doesn't exist.
+// The file is read backwards from its end, so that the size of the run log doesn't matter.
+func lastLine(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	var tail []byte
+	chunk := make([]byte, 4096)
+	for pos := fi.Size(); pos > 0; {
+		n := int64(len(chunk))
+		if n > pos {
+			n = pos
+		}
+		pos -= n
+		if _, err := f.ReadAt(chunk[:n], pos); err != nil {
+			return nil, err
+		}
+		tail = append(append([]byte(nil), chunk[:n]...), tail...)
+		line := bytes.TrimRight(tail, "\n")
+		if i := bytes.LastIndexByte(line, '\n'); i >= 0 {
+			return line[i+1:], nil
+		}
+	}
+	return bytes.TrimRight(tail, "\n"), nil
+}
+
+// runLogMu serializes the appends to the run logs, since the jobs of the server share their log.
+var runLogMu sync.Mutex
+
+// appendLog appends the events to the run log, chaining each line to the hash of the previous one.
+// The file is only opened in append mode, the existing lines are never rewritten.
+func appendLog(path string, events ...logEvent) error {
+	runLogMu.Lock()
+	defer runLogMu.Unlock()
+	prev := ""
+	last, err := lastLine(path)
+	if err != nil {
+		return err
+	}
+	if len(last) > 0 {
+		sum := sha256.Sum256(last)
+		prev = hex.EncodeToString(sum[:])
+	}
+
+	var buf bytes.Buffer
+	for _, e := range events {
+		e.Time = e.Time.UTC()
+		e.Prev = prev
+		line, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		sum := sha256.Sum256(line)
+		prev = hex.EncodeToString(sum[:])
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(buf.Bytes()); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// recordRun writes the manifest of the run and appends the run to the log: an event per analyzed image,
+// followed by the hash of the manifest. It returns the written manifest.
+func recordRun(m *manifest, path, runLog string) ([]byte, error) {
+	data, err := m.write(path)
+	if err != nil {
+		return nil, fmt.Errorf("Error writing the manifest: %v", err)
+	}
+	sum := sha256.Sum256(data)
+	if runLog == "" {
+		runLog = runLogName(path)
+	}
+	events := []logEvent{{Time: m.Started, Event: "start", Manifest: path}}
+	for _, rec := range m.Images {
+		events = append(events, logEvent{Time: m.Finished, Event: "image", File: rec.Input.Path, SHA256: rec.Input.SHA256, Status: rec.Status})
+	}
+	events = append(events, logEvent{Time: m.Finished, Event: "finish", Manifest: path, SHA256: hex.EncodeToString(sum[:])})
+	if err := appendLog(runLog, events...); err != nil {
+		return nil, fmt.Errorf("Error writing the run log: %v", err)
+	}
+	return data, nil
+}
+
+// replayResult compares the outputs of a replayed analysis with the outputs recorded in the manifest.
+type replayResult struct {
+	Input      string   `json:"input"`
+	Output     string   `json:"output,omitempty"`
+	Status     string   `json:"status"`
+	Error      string   `json:"error,omitempty"`
+	Identical  int      `json:"identical"`
+	Outputs    int      `json:"outputs"`
+	Mismatches []string `json:"mismatches,omitempty"`
+}
+
+// runReplay re-runs the analyses of a manifest with the recorded parameters, after checking the hashes
+// of their inputs, and compares the hashes of the outputs with the recorded ones.
+func runReplay(args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+	path := args[0]
+	m, err := readManifest(path)
+	if err != nil {
+		return err
+	}
+	outDir := *replayOutDir
+	if outDir == "" {
+		outDir = filepath.Join(filepath.Dir(path), "replay")
+	}
+	if err := os.MkdirAll(outDir, 0755); err != nil {
+		return err
+	}
+
+	build := currentBuild()
+	if build.Version != m.Tool.Version || build.Revision != m.Tool.Revision || build.Executable != m.Tool.Executable {
+		logger.Warn("the tool differs from the build recorded in the manifest", "version", m.Tool.Version,
+			"revision", m.Tool.Revision, "executable", m.Tool.Executable)
+	}
+	if build.Go != m.Tool.Go || runtime.GOOS != m.OS || runtime.GOARCH != m.Arch {
+		logger.Warn("the platform differs from the one recorded in the manifest", "go", m.Tool.Go, "os", m.OS, "arch", m.Arch)
+	}
+
+	replay := newManifest(time.Now())
+	var results []replayResult
+	reproduced := true
+	for i, rec := range m.Images {
+		res := replayResult{Input: rec.Input.Path, Outputs: len(rec.Outputs)}
+		if rec.Status != "ok" || rec.Params == nil || len(rec.Outputs) == 0 {
+			res.Status = "skipped"
+			res.Error = "the recorded analysis failed"
+			results = append(results, res)
+			continue
+		}
+		if err := m.checkFiles(append([]custodyFile{rec.Input}, rec.Files...)); err != nil {
+			return err
+		}
+
+		// The recorded parameters are the effective ones, they are not derived again from the image.
+		p := *rec.Params
+		p.Auto = false
+		if p.Calibration != "" {
+			p.Calibration = m.path(p.Calibration)
+		}
+		if err := p.validate(); err != nil {
+			return fmt.Errorf("%s: %v", rec.Input.Path, err)
+		}
+		// The outputs of an image are written next to each other, so they are found under the same
+		// names in the replay directory. The index avoids the collisions between the images of a batch.
+		dir := outDir
+		if len(m.Images) > 1 {
+			dir = filepath.Join(outDir, fmt.Sprintf("%04d", i+1))
+		}
+		res.Output = filepath.Join(dir, filepath.Base(rec.Outputs[0].Path))
+		entry, _ := analyzeFile(context.Background(), m.path(rec.Input.Path), res.Output,
+			func(string) (*params, error) { return &p, nil }, analysisOptions{debug: m.Debug})
+		res.Status, res.Error = entry.Status, entry.Error
+		if entry.Status == "ok" {
+			for _, out := range rec.Outputs {
+				cf, err := hashFile(filepath.Join(dir, filepath.Base(out.Path)), false)
+				if err == nil && cf.SHA256 == out.SHA256 {
+					res.Identical++
+				} else {
+					res.Mismatches = append(res.Mismatches, out.Path)
+				}
+			}
+		}
+		if res.Identical != res.Outputs {
+			reproduced = false
+		}
+		if err := replay.add(entry); err != nil {
+			return err
+		}
+		results = append(results, res)
+	}
+
+	runLog := *replayLog
+	if runLog == "" {
+		runLog = runLogName(path)
+	}
+	if _, err := recordRun(replay, filepath.Join(outDir, "manifest.json"), runLog); err != nil {
+		return err
+	}
+	if err := appendLog(runLog, logEvent{Time: time.Now(), Event: "replay", Manifest: path, Status: replayStatus(reproduced)}); err != nil {
+		return fmt.Errorf("Error writing the run log: %v", err)
+	}
+
+	if outputFormat == "json" {
+		if err := printJSON(results); err != nil {
+			return err
+		}
+	} else {
+		for _, r := range results {
+			switch {
+			case r.Status != "ok":
+				fmt.Printf("%s: %s (%s)\n", r.Input, r.Status, r.Error)
+			case len(r.Mismatches) > 0:
+				fmt.Printf("%s: %d/%d outputs identical, differing: %s\n", r.Input, r.Identical, r.Outputs, strings.Join(r.Mismatches, ", "))
+			default:
+				fmt.Printf("%s: %d/%d outputs identical\n", r.Input, r.Identical, r.Outputs)
+			}
+		}
+	}
+	if !reproduced {
+		return fmt.Errorf("the replay does not reproduce the manifest %s", path)
+	}
+	return nil
+}
+
+// path returns the path of a file of the manifest. The relative paths refer to the working directory of the recorded run.
+func (m *manifest) path(p string) string {
+	if filepath.IsAbs(p) || m.Dir == "" {
+		return p
+	}
+	return filepath.Join(m.Dir, p)
+}
+
+// checkFile verifies that the file still matches its hashes in the manifest.
+func (m *manifest) checkFile(f custodyFile) error {
+	cf, err := hashFile(m.path(f.Path), f.SHA512 != "")
+	if err != nil {
+		return err
+	}
+	if cf.SHA256 != f.SHA256 || cf.SHA512 != f.SHA512 {
+		return fmt.Errorf("the file %s does not match the hashes of the manifest", f.Path)
+	}
+	return nil
+}
+
+// checkFiles verifies that the files still match their hashes in the manifest.
+func (m *manifest) checkFiles(files []custodyFile) error {
+	for _, f := range files {
+		if err := m.checkFile(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// replayStatus returns the outcome of a replay in the run log.
+func replayStatus(reproduced bool) string {
+	if reproduced {
+		return "reproduced"
+	}
+	return "differs"
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestManifestName(t *testing.T) {
+	if name := manifestName(filepath.Join("out", "result.png"), ""); name != filepath.Join("out", "result_manifest.json") {
+		t.Errorf("single image: got %s", name)
+	}
+	if name := manifestName("", "results"); name != filepath.Join("results", "manifest.json") {
+		t.Errorf("batch: got %s", name)
+	}
+}
+
+func TestLastLine(t *testing.T) {
+	dir := t.TempDir()
+	long := strings.Repeat("x", 10000)
+	for _, tc := range []struct {
+		name, content, want string
+	}{
+		{"empty", "", ""},
+		{"single", "a\n", "a"},
+		{"no newline", "a\nb", "b"},
+		{"trailing newlines", "a\nb\n\n", "b"},
+		{"long last line", "a\n" + long + "\n", long},
+		{"long first line", long + "\nb\n", "b"},
+		{"long single line", long, long},
+	} {
+		path := filepath.Join(dir, strings.ReplaceAll(tc.name, " ", "_"))
+		if err := os.WriteFile(path, []byte(tc.content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		line, err := lastLine(path)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if string(line) != tc.want {
+			t.Errorf("%s: got a line of %d bytes, want %d bytes", tc.name, len(line), len(tc.want))
+		}
+	}
+	if line, err := lastLine(filepath.Join(dir, "missing")); err != nil || line != nil {
+		t.Errorf("missing file: got %q, %v", line, err)
+	}
+}
+
+func TestAppendLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "custody.log")
+	now := time.Now()
+	if err := appendLog(path, logEvent{Time: now, Event: "start"}, logEvent{Time: now, Event: "image", File: strings.Repeat("a", 5000)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := appendLog(path, logEvent{Time: now, Event: "finish"}); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1<<20)
+	prev := ""
+	var events []string
+	for scanner.Scan() {
+		var e logEvent
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			t.Fatal(err)
+		}
+		if e.Prev != prev {
+			t.Errorf("the %s event is chained to %q, want %q", e.Event, e.Prev, prev)
+		}
+		sum := sha256.Sum256(scanner.Bytes())
+		prev = hex.EncodeToString(sum[:])
+		events = append(events, e.Event)
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(events, ",") != "start,image,finish" {
+		t.Errorf("got the events %v", events)
+	}
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"strings"
+)
+
+const (
+	// dqCoefficients is the number of low-frequency AC coefficients analyzed, in zigzag order.
+	dqCoefficients = 9
+	// dqRange bounds the quantized values counted in the histograms.
+	dqRange = 64
+	// dqMaxPeriod is the longest period of the double quantization looked for in the histograms.
+	dqMaxPeriod = 16
+	// dqMinStrength is the variance of the folded histogram above which it is periodic.
+	dqMinStrength = 0.05
+	// dqMinCount is the mean count of the bins around a value below which its ratio is not reliable.
+	dqMinCount = 5
+	// dqMinRatio bounds the evidence of a value falling in a gap of the histogram.
+	dqMinRatio = 0.05
+)
+
+// dqCosines are the terms of the 8x8 DCT of the JPEG blocks, by frequency and position.
+var dqCosines = func() (c [8][8]float64) {
+	for u := 0; u < 8; u++ {
+		for x := 0; x < 8; x++ {
+			c[u][x] = math.Cos(float64((2*x+1)*u)*math.Pi/16) / 2
+			if u == 0 {
+				c[u][x] /= math.Sqrt2
+			}
+		}
+	}
+	return
+}()
+
+// dqHistogram counts the quantized values of a DCT coefficient, from -dqRange to dqRange.
+type dqHistogram struct {
+	counts [2*dqRange + 1]float64
+	// period is the period of the double quantization, or 0 if the histogram is not periodic.
+	period int
+}
+
+// ratio returns the count of the value divided by the mean count over the period p centered on it.
+// It returns false for 0, which is as frequent in the single compressed images, and if the neighborhood
+// of the value is out of the histogram or too sparse. The variance of the ratio is also returned.
+func (h *dqHistogram) ratio(k, p int) (float64, float64, bool) {
+	if k == 0 || k-p/2 < -dqRange || k+p/2 > dqRange {
+		return 0, 0, false
+	}
+	var sum float64
+	for j := k - p/2; j <= k+p/2; j++ {
+		c := h.counts[j+dqRange]
+		if p%2 == 0 && (j == k-p/2 || j == k+p/2) {
+			c /= 2
+		}
+		sum += c
+	}
+	mean := sum / float64(p)
+	if mean < dqMinCount {
+		return 0, 0, false
+	}
+	// The counts are roughly Poisson distributed.
+	return h.counts[k+dqRange] / mean, 1 / mean, true
+}
+
+// findPeriod looks for the period of the double quantization: the JPEG compression of an image already
+// compressed with a coarser quantization step leaves periodic peaks and gaps in the histogram of the values.
+// The ratios of the values are folded over each candidate period, and their variance is compared to the
+// one expected from the sampling noise. The shortest period almost as strong as the strongest one is kept,
+// since the multiples of the period are as strong.
+func (h *dqHistogram) findPeriod() {
+	var strength [dqMaxPeriod + 1]float64
+	var best float64
+	for p := 2; p <= dqMaxPeriod; p++ {
+		sum, noise, n := make([]float64, p), make([]float64, p), make([]float64, p)
+		for k := -dqRange; k <= dqRange; k++ {
+			r, v, ok := h.ratio(k, p)
+			if !ok {
+				continue
+			}
+			phase := (k%p + p) % p
+			sum[phase] += r
+			noise[phase] += v
+			n[phase]++
+		}
+		var mean float64
+		for i := range sum {
+			if n[i] < 2 {
+				mean = math.NaN()
+				break
+			}
+			sum[i] /= n[i]
+			noise[i] /= n[i] * n[i]
+			mean += sum[i] / float64(p)
+		}
+		if math.IsNaN(mean) {
+			continue
+		}
+		for i := range sum {
+			strength[p] += ((sum[i]-mean)*(sum[i]-mean) - noise[i]) / float64(p)
+		}
+		best = math.Max(best, strength[p])
+	}
+	if best < dqMinStrength {
+		return
+	}
+	for p := 2; p <= dqMaxPeriod; p++ {
+		if strength[p] >= 0.8*best {
+			h.period = p
+			return
+		}
+	}
+}
+
+// jpegLuminance returns the luminance plane of the decoded JPEG image in row-major order, as stored in the file
+// if the image has not been converted.
+func jpegLuminance(img image.Image) []float64 {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	lum := make([]float64, w*h)
+	switch m := img.(type) {
+	case *image.YCbCr:
+		for y := 0; y < h; y++ {
+			for x := 0; x < w; x++ {
+				lum[y*w+x] = float64(m.Y[m.YOffset(b.Min.X+x, b.Min.Y+y)])
+			}
+		}
+	case *image.Gray:
+		for y := 0; y < h; y++ {
+			for x := 0; x < w; x++ {
+				lum[y*w+x] = float64(m.Pix[m.PixOffset(b.Min.X+x, b.Min.Y+y)])
+			}
+		}
+	default:
+		lum = luminance(imgToNRGBA(img))
+	}
+	return lum
+}
+
+// doubleQuantization detects the blocks of a JPEG image which were compressed only once, in an image compressed
+// twice: the regions pasted from another image, or retouched, before the last compression. The low-frequency DCT
+// coefficients of the 8x8 blocks of the luminance are quantized with the steps of the luminance table of the image
+// (in natural order), and the histograms of the quantized values are searched for the periodic pattern of the double
+// quantization. The values of the single compressed blocks fall in the gaps of the pattern as often as in its peaks,
+// so each value adds minus the log of its ratio (see dqHistogram.ratio) to the log-odds of a single compression
+// of its block. The log-odds are added up over the 3x3 neighboring blocks.
+//
+// It returns the heat of the single compressed blocks in the [0, 1] range, at the size of the image and in row-major
+// order, and the periods found for the analyzed coefficients, 0 if the histogram is not periodic. The heat is 0 if no
+// period is found, and on the pixels of the incomplete blocks at the right and bottom borders.
+func doubleQuantization(img image.Image, table []int) ([]float64, []int) {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	bw, bh := w/8, h/8
+	lum := jpegLuminance(img)
+
+	// The quantized values of the analyzed coefficients, by coefficient and block.
+	values := make([][]int, dqCoefficients)
+	hists := make([]dqHistogram, dqCoefficients)
+	for c := range values {
+		values[c] = make([]int, bw*bh)
+		pos := jpegZigzag[c+1]
+		u, v := pos%8, pos/8
+		q := float64(table[pos])
+		for by := 0; by < bh; by++ {
+			for bx := 0; bx < bw; bx++ {
+				var sum float64
+				for y := 0; y < 8; y++ {
+					row := (by*8+y)*w + bx*8
+					for x := 0; x < 8; x++ {
+						sum += dqCosines[v][y] * dqCosines[u][x] * lum[row+x]
+					}
+				}
+				k := int(math.Round(sum / q))
+				values[c][by*bw+bx] = k
+				if k >= -dqRange && k <= dqRange {
+					hists[c].counts[k+dqRange]++
+				}
+			}
+		}
+		// A unit step leaves no trace of the former quantization.
+		if q > 1 {
+			hists[c].findPeriod()
+		}
+	}
+
+	periods := make([]int, dqCoefficients)
+	logOdds := make([]float64, bw*bh)
+	var found bool
+	for c := range hists {
+		p := hists[c].period
+		periods[c] = p
+		if p == 0 {
+			continue
+		}
+		found = true
+		for i, k := range values[c] {
+			if r, _, ok := hists[c].ratio(k, p); ok {
+				logOdds[i] -= math.Log(math.Max(r, dqMinRatio))
+			}
+		}
+	}
+
+	heat := make([]float64, w*h)
+	if !found || bw == 0 || bh == 0 {
+		return heat, periods
+	}
+	// The blocks of a neighborhood are assumed to share their compression history, so their evidence adds up.
+	logOdds = boxMean(logOdds, bw, bh, 1)
+	for i := range logOdds {
+		logOdds[i] *= 9
+	}
+	for by := 0; by < bh; by++ {
+		for bx := 0; bx < bw; bx++ {
+			v := math.Max(2*sigmoid(logOdds[by*bw+bx])-1, 0)
+			for y := by * 8; y < by*8+8; y++ {
+				for x := bx * 8; x < bx*8+8; x++ {
+					heat[y*w+x] = v
+				}
+			}
+		}
+	}
+	return heat, periods
+}
+
+// dqClues describes the periods of the double quantization found in the histograms of the DCT coefficients.
+func dqClues(periods []int) []string {
+	var found []string
+	for _, p := range periods {
+		if p > 0 {
+			found = append(found, fmt.Sprint(p))
+		}
+	}
+	if len(found) == 0 {
+		return []string{"no double compression found"}
+	}
+	return []string{fmt.Sprintf("double compression, periods %s", strings.Join(found, ", "))}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// splicedJPEG pastes the rectangle of another image into the image compressed with the first quality,
+// and compresses the result with the second quality. The first compression is skipped if its quality is 0.
+func splicedJPEG(t *testing.T, r image.Rectangle, first, second int) []byte {
+	t.Helper()
+	var base image.Image = smoothImage(256, 256, 1)
+	if first > 0 {
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, base, &jpeg.Options{Quality: first}); err != nil {
+			t.Fatal(err)
+		}
+		dec, err := jpeg.Decode(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		base = dec
+	}
+	img := imgToNRGBA(base)
+	draw.Draw(img, r, smoothImage(256, 256, 2), r.Min, draw.Src)
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: second}); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// meanHeat returns the mean heat of the 256 pixels wide heatmap inside and outside the rectangle.
+// The blocks overlapping its border are left out.
+func meanHeat(heat []float64, r image.Rectangle) (float64, float64) {
+	inner, outer := r.Inset(8), r.Inset(-16)
+	var in, out, nin, nout float64
+	for i, v := range heat {
+		p := image.Pt(i%256, i/256)
+		if p.In(inner) {
+			in += v
+			nin++
+		} else if !p.In(outer) {
+			out += v
+			nout++
+		}
+	}
+	return in / nin, out / nout
+}
+
+func TestDoubleQuantization(t *testing.T) {
+	r := image.Rect(100, 100, 180, 170)
+	for _, tc := range []struct {
+		first, second int
+		double        bool
+	}{
+		{60, 90, true},
+		{50, 85, true},
+		{0, 90, false},
+		{90, 90, false},
+	} {
+		data := splicedJPEG(t, r, tc.first, tc.second)
+		m := new(metadata)
+		m.readJPEG(data)
+		if len(m.luminanceTable) != 64 {
+			t.Fatalf("q%d/q%d: the luminance table has %d steps", tc.first, tc.second, len(m.luminanceTable))
+		}
+		img, err := jpeg.Decode(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		heat, periods := doubleQuantization(img, m.luminanceTable)
+		var found int
+		for _, p := range periods {
+			if p > 0 {
+				found++
+			}
+		}
+		in, out := meanHeat(heat, r)
+		if !tc.double {
+			if found > 0 || in > 0 || out > 0 {
+				t.Errorf("q%d/q%d: single compression seen as double: periods %v, heat %.2f inside, %.2f outside", tc.first, tc.second, periods, in, out)
+			}
+			continue
+		}
+		if found < dqCoefficients/2 {
+			t.Errorf("q%d/q%d: periods %v, want most coefficients periodic", tc.first, tc.second, periods)
+		}
+		if in < 0.5 || out > 0.1 {
+			t.Errorf("q%d/q%d: the heat is %.2f inside the pasted region and %.2f outside", tc.first, tc.second, in, out)
+		}
+	}
+
+	// The period of the first coefficient is the one of the steps 9 and 2 of the tables of the qualities 60 and 90.
+	data := splicedJPEG(t, r, 60, 90)
+	m := new(metadata)
+	m.readJPEG(data)
+	img, _ := jpeg.Decode(bytes.NewReader(data))
+	if _, periods := doubleQuantization(img, m.luminanceTable); periods[0] != 9 {
+		t.Errorf("the period of the first coefficient is %d, want 9", periods[0])
+	}
+}
+
+func TestFuseDoubleQuantization(t *testing.T) {
+	dir := t.TempDir()
+	r := image.Rect(100, 100, 180, 170)
+	input := filepath.Join(dir, "spliced.jpg")
+	if err := os.WriteFile(input, splicedJPEG(t, r, 60, 90), 0644); err != nil {
+		t.Fatal(err)
+	}
+	p, err := defaultParams().with(map[string]string{"fuse": "dq"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry, _ := analyzeFile(context.Background(), input, filepath.Join(dir, "out.png"), func(string) (*params, error) { return p, nil }, analysisOptions{})
+	if entry.Status != "ok" {
+		t.Fatal(entry.Error)
+	}
+	d := entry.Fusion.Detectors[0]
+	if d.Name != "dq" || !d.Fired || len(d.Regions) == 0 || len(d.Clues) != 1 {
+		t.Fatalf("unexpected dq detector %+v", d)
+	}
+	reg := d.Regions[0]
+	found := image.Rect(reg.X, reg.Y, reg.X+reg.Width, reg.Y+reg.Height)
+	if in := found.Intersect(r); in.Dx()*in.Dy() < r.Dx()*r.Dy()/2 {
+		t.Errorf("the region %v misses the pasted region %v", found, r)
+	}
+}
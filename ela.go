@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"math"
+	"os"
+)
+
+var (
+	// Error level analysis flags
+	elaFlags = flag.NewFlagSet("ela", flag.ExitOnError)
+
+	elaDestination = elaFlags.String("out", "", "Output image")
+	elaQuality     = elaFlags.Int("q", 90, "JPEG quality of the recompression")
+	elaScale       = elaFlags.Float64("scale", 0, "Amplification of the error levels (0 stretches the maximum error to white)")
+)
+
+// elaResult is the summary of the error level analysis.
+type elaResult struct {
+	Input   string  `json:"input"`
+	Output  string  `json:"output"`
+	Quality int     `json:"quality"`
+	Mean    float64 `json:"mean"`
+	Max     float64 `json:"max"`
+	Scale   float64 `json:"scale"`
+}
+
+// errorLevels recompresses the image with the given JPEG quality and returns the absolute
+// difference between the original and the recompressed pixels, amplified by the scale factor.
+// The regions pasted from another image, or saved with a different quality, usually stand out
+// with higher error levels than the rest of the image. If scale is zero, the error levels
+// are stretched to the full intensity range. It returns the error image, the mean and the maximum
+// error level (per channel, before amplification) and the applied scale factor.
+func errorLevels(src image.Image, quality int, scale float64) (*image.NRGBA, float64, float64, float64, error) {
+	img := imgToNRGBA(src)
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}); err != nil {
+		return nil, 0, 0, 0, err
+	}
+	dec, err := jpeg.Decode(&buf)
+	if err != nil {
+		return nil, 0, 0, 0, err
+	}
+	recompressed := imgToNRGBA(dec)
+
+	diff := make([]float64, len(img.Pix))
+	var sum, max float64
+	for i := range img.Pix {
+		if i%4 == 3 {
+			continue
+		}
+		d := math.Abs(float64(img.Pix[i]) - float64(recompressed.Pix[i]))
+		diff[i] = d
+		sum += d
+		max = math.Max(max, d)
+	}
+	mean := sum / float64(len(img.Pix)/4*3)
+
+	if scale == 0 {
+		scale = 1
+		if max > 0 {
+			scale = 255 / max
+		}
+	}
+
+	res := image.NewNRGBA(img.Bounds())
+	for i := range res.Pix {
+		if i%4 == 3 {
+			res.Pix[i] = 0xff
+			continue
+		}
+		res.Pix[i] = clamp255(diff[i] * scale)
+	}
+	return res, mean, max, scale, nil
+}
+
+// runELA runs the error level analysis of the image given as argument.
+func runELA(args []string) error {
+	if len(args) != 1 || len(*elaDestination) == 0 {
+		return errUsage
+	}
+	if *elaQuality < 1 || *elaQuality > 100 {
+		return fmt.Errorf("the JPEG quality must be between 1 and 100")
+	}
+
+	// The image is not resized, since resampling would hide the compression artifacts.
+	input, err := os.Open(args[0])
+	if err != nil {
+		return fmt.Errorf("Error reading the image file: %v", err)
+	}
+	defer input.Close()
+
+	src, _, err := image.Decode(input)
+	if err != nil {
+		return fmt.Errorf("Error decoding the image: %v", err)
+	}
+
+	res, mean, max, scale, err := errorLevels(src, *elaQuality, *elaScale)
+	if err != nil {
+		return err
+	}
+
+	out, err := os.Create(*elaDestination)
+	if err != nil {
+		return fmt.Errorf("Error creating output file: %v", err)
+	}
+	defer out.Close()
+
+	if err := png.Encode(out, res); err != nil {
+		return fmt.Errorf("Error encoding image file: %v", err)
+	}
+
+	result := elaResult{
+		Input:   args[0],
+		Output:  *elaDestination,
+		Quality: *elaQuality,
+		Mean:    mean,
+		Max:     max,
+		Scale:   scale,
+	}
+	if outputFormat == "json" {
+		return printJSON(result)
+	}
+	fmt.Printf("Mean error level: %.2f\nMaximum error level: %.0f\n", result.Mean, result.Max)
+	if interactive {
+		fmt.Printf("Recompression quality: %d, amplification: %.2f\n", result.Quality, result.Scale)
+	}
+	return nil
+}
@@ -0,0 +1,643 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var (
+	// Evaluation flags
+	evalFlags = flag.NewFlagSet("eval", flag.ExitOnError)
+
+	evalLayout  = evalFlags.String("layout", "auto", "Dataset layout: auto, comofod, grip, labels")
+	evalLabels  = evalFlags.String("labels", "", "Labels file (image, label and optional mask on each line), looked up in the dataset directory if empty")
+	evalOutDir  = evalFlags.String("outdir", "", "Output directory of the detection results (temporary if empty)")
+	evalCSV     = evalFlags.String("csv", "eval.csv", "Per-image results file")
+	evalConfig  = evalFlags.String("config", "", "Configuration file (YAML, JSON or TOML) of the detection parameters")
+	evalPreset  = evalFlags.String("preset", "", "Parameter preset: strict, balanced, sensitive, high-res")
+	evalMaskThr = evalFlags.Float64("mask-threshold", 127, "Intensity above which the pixels of the ground-truth masks are forged")
+	evalCurves  = evalFlags.String("curves", "", "Output directory of the ROC and precision-recall curves (not computed if empty)")
+)
+
+func init() {
+	defaultParams().register(evalFlags)
+}
+
+// maskDirs are the directory names holding the ground-truth masks in the grip layout.
+var maskDirs = []string{"gt", "masks", "mask", "groundtruth"}
+
+// maskSuffixes are the suffixes of the ground-truth masks stored next to the images in the grip layout.
+var maskSuffixes = []string{"_gt", "_mask"}
+
+// comofodName matches the file names of the CoMoFoD dataset: forged (F), original (O),
+// colored mask (M) and binary mask (B) images, optionally followed by the post-processing.
+var comofodName = regexp.MustCompile(`(?i)^(\d+)_([FOMB])(_[a-z]+\d*)?$`)
+
+// sample is an image of an evaluation dataset together with its ground truth.
+type sample struct {
+	path   string
+	forged bool
+	// mask is the ground-truth mask of the forged image, empty if not known.
+	mask string
+}
+
+// pixelScores are the pixel-level metrics of a forged image having a ground-truth mask.
+type pixelScores struct {
+	TP        int     `json:"tp"`
+	FP        int     `json:"fp"`
+	FN        int     `json:"fn"`
+	Precision float64 `json:"precision"`
+	Recall    float64 `json:"recall"`
+	F1        float64 `json:"f1"`
+	IoU       float64 `json:"iou"`
+}
+
+// evalEntry is the evaluation of a single image.
+type evalEntry struct {
+	Image    string       `json:"image"`
+	Label    bool         `json:"label"`
+	Mask     string       `json:"mask,omitempty"`
+	Status   string       `json:"status"`
+	Error    string       `json:"error,omitempty"`
+	Score    float64      `json:"score"`
+	Forged   bool         `json:"forged"`
+	Regions  int          `json:"regions"`
+	Duration float64      `json:"duration"`
+	Pixels   *pixelScores `json:"pixels,omitempty"`
+	Evidence *evidence    `json:"evidence,omitempty"`
+}
+
+// evalSummary contains the image-level and pixel-level metrics of an evaluation.
+// The pixel-level metrics are averaged over the forged images having a mask.
+type evalSummary struct {
+	Images    int     `json:"images"`
+	Forged    int     `json:"forged"`
+	Authentic int     `json:"authentic"`
+	Failed    int     `json:"failed"`
+	TP        int     `json:"tp"`
+	FP        int     `json:"fp"`
+	TN        int     `json:"tn"`
+	FN        int     `json:"fn"`
+	TPR       float64 `json:"tpr"`
+	FPR       float64 `json:"fpr"`
+	Accuracy  float64 `json:"accuracy"`
+	Masks     int     `json:"masks"`
+	Precision float64 `json:"precision"`
+	Recall    float64 `json:"recall"`
+	F1        float64 `json:"f1"`
+	IoU       float64 `json:"iou"`
+}
+
+// evalReport is the JSON output of the eval command.
+type evalReport struct {
+	Dataset string      `json:"dataset"`
+	Summary evalSummary `json:"summary"`
+	Images  []evalEntry `json:"images"`
+	// Curves are the ROC and precision-recall curves, if requested.
+	Curves *curveReport `json:"curves,omitempty"`
+}
+
+// loadDataset returns the images of the dataset directory with their labels. In auto mode the labels file
+// is used if there is one, otherwise the CoMoFoD layout if the file names follow its convention,
+// otherwise the grip layout (the masks stored next to the images or in a separate directory).
+func loadDataset(dir, layout, labels string) ([]sample, error) {
+	if layout == "auto" {
+		if labels == "" {
+			labels = findLabels(dir)
+		}
+		switch {
+		case labels != "":
+			layout = "labels"
+		case isComofod(dir):
+			layout = "comofod"
+		default:
+			layout = "grip"
+		}
+	}
+
+	switch layout {
+	case "labels":
+		if labels == "" {
+			if labels = findLabels(dir); labels == "" {
+				return nil, fmt.Errorf("no labels file found in %s", dir)
+			}
+		}
+		return readLabels(dir, labels)
+	case "comofod":
+		return comofodSamples(dir)
+	case "grip":
+		return gripSamples(dir)
+	}
+	return nil, fmt.Errorf("unsupported dataset layout: %s", layout)
+}
+
+// findLabels returns the labels file of the dataset directory, if any: labels.csv, labels.txt
+// or a groundtruth*.txt file, like the one of the MICC-F220 dataset.
+func findLabels(dir string) string {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return ""
+	}
+	for _, f := range files {
+		name := strings.ToLower(f.Name())
+		if f.IsDir() {
+			continue
+		}
+		if name == "labels.csv" || name == "labels.txt" || (strings.HasPrefix(name, "groundtruth") && strings.HasSuffix(name, ".txt")) {
+			return filepath.Join(dir, f.Name())
+		}
+	}
+	return ""
+}
+
+// readLabels reads the labels file. Each line contains the image path, its label (1, true, forged or
+// tampered for the forged images, 0, false, original or authentic for the other ones) and optionally
+// the path of its mask, separated by commas, semicolons, tabs or spaces. The paths are relative to the
+// dataset directory. A first line with an unknown label is considered as header.
+func readLabels(dir, path string) ([]sample, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var samples []sample
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.FieldsFunc(line, func(r rune) bool {
+			return r == ',' || r == ';' || r == '\t' || r == ' '
+		})
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("%s:%d: missing label", path, n)
+		}
+		forged, ok := parseLabel(fields[1])
+		if !ok {
+			if n == 1 {
+				continue
+			}
+			return nil, fmt.Errorf("%s:%d: invalid label: %s", path, n, fields[1])
+		}
+		s := sample{path: filepath.Join(dir, fields[0]), forged: forged}
+		if len(fields) > 2 && forged {
+			s.mask = filepath.Join(dir, fields[2])
+		}
+		samples = append(samples, s)
+	}
+	return samples, scanner.Err()
+}
+
+// parseLabel parses the label of an image.
+func parseLabel(s string) (forged, ok bool) {
+	switch strings.ToLower(s) {
+	case "1", "true", "forged", "tampered", "fake":
+		return true, true
+	case "0", "false", "original", "authentic", "pristine", "real":
+		return false, true
+	}
+	return false, false
+}
+
+// isComofod reports whether the directory contains images named as in the CoMoFoD dataset.
+func isComofod(dir string) bool {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return false
+	}
+	for _, f := range files {
+		if !f.IsDir() && imageExtensions[strings.ToLower(filepath.Ext(f.Name()))] && comofodName.MatchString(baseName(f.Name())) {
+			return true
+		}
+	}
+	return false
+}
+
+// comofodSamples returns the forged (NNN_F*) and original (NNN_O*) images of a CoMoFoD directory.
+// The forged images, including the post-processed versions, share the binary mask NNN_B.
+func comofodSamples(dir string) ([]sample, error) {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	masks := make(map[string]string)
+	for _, f := range files {
+		if m := comofodName.FindStringSubmatch(baseName(f.Name())); m != nil && strings.EqualFold(m[2], "B") && m[3] == "" {
+			masks[m[1]] = filepath.Join(dir, f.Name())
+		}
+	}
+
+	var samples []sample
+	for _, f := range files {
+		if f.IsDir() || !imageExtensions[strings.ToLower(filepath.Ext(f.Name()))] {
+			continue
+		}
+		m := comofodName.FindStringSubmatch(baseName(f.Name()))
+		if m == nil {
+			continue
+		}
+		switch strings.ToUpper(m[2]) {
+		case "F":
+			samples = append(samples, sample{path: filepath.Join(dir, f.Name()), forged: true, mask: masks[m[1]]})
+		case "O":
+			samples = append(samples, sample{path: filepath.Join(dir, f.Name())})
+		}
+	}
+	return samples, nil
+}
+
+// gripSamples returns the images of the directory tree. An image is forged if it has a mask, either
+// next to it with the _gt or _mask suffix, or with the same name in a gt, masks, mask or groundtruth directory.
+func gripSamples(dir string) ([]sample, error) {
+	var samples []sample
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			for _, d := range maskDirs {
+				if path != dir && strings.EqualFold(info.Name(), d) {
+					return filepath.SkipDir
+				}
+			}
+			return nil
+		}
+		if !imageExtensions[strings.ToLower(filepath.Ext(path))] {
+			return nil
+		}
+		name := baseName(path)
+		for _, suffix := range maskSuffixes {
+			if strings.HasSuffix(strings.ToLower(name), suffix) {
+				return nil
+			}
+		}
+		s := sample{path: path, mask: findMask(filepath.Dir(path), name)}
+		s.forged = s.mask != ""
+		samples = append(samples, s)
+		return nil
+	})
+	return samples, err
+}
+
+// findMask looks for the ground-truth mask of the image in the grip layout.
+func findMask(dir, name string) string {
+	var candidates []string
+	for _, suffix := range maskSuffixes {
+		candidates = append(candidates, filepath.Join(dir, name+suffix))
+	}
+	for _, d := range maskDirs {
+		candidates = append(candidates, filepath.Join(dir, d, name), filepath.Join(dir, "..", d, name))
+	}
+	for _, c := range candidates {
+		for _, ext := range []string{".png", ".jpg", ".jpeg"} {
+			if _, err := os.Stat(c + ext); err == nil {
+				return c + ext
+			}
+		}
+	}
+	return ""
+}
+
+// baseName returns the file name without directory and extension.
+func baseName(path string) string {
+	name := filepath.Base(path)
+	return strings.TrimSuffix(name, filepath.Ext(name))
+}
+
+// loadMask reads the ground-truth mask. The pixels brighter than the threshold are forged.
+func loadMask(path string, threshold float64) (*image.Alpha, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	src, _, err := image.Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("Error decoding the mask %s: %v", path, err)
+	}
+	b := src.Bounds()
+	mask := image.NewAlpha(image.Rect(0, 0, b.Dx(), b.Dy()))
+	for y := 0; y < b.Dy(); y++ {
+		for x := 0; x < b.Dx(); x++ {
+			if float64(color.GrayModel.Convert(src.At(b.Min.X+x, b.Min.Y+y)).(color.Gray).Y) > threshold {
+				mask.Pix[mask.PixOffset(x, y)] = 0xff
+			}
+		}
+	}
+	return mask, nil
+}
+
+// comparePixels compares the detected mask with the ground truth. The detection might have run
+// on a downscaled image, so the detected mask is sampled at the resolution of the ground truth.
+func comparePixels(detected, truth *image.Alpha) *pixelScores {
+	db, tb := detected.Bounds(), truth.Bounds()
+	s := new(pixelScores)
+	for y := 0; y < tb.Dy(); y++ {
+		dy := db.Min.Y + y*db.Dy()/tb.Dy()
+		for x := 0; x < tb.Dx(); x++ {
+			dx := db.Min.X + x*db.Dx()/tb.Dx()
+			d := detected.Pix[detected.PixOffset(dx, dy)] != 0
+			t := truth.Pix[truth.PixOffset(tb.Min.X+x, tb.Min.Y+y)] != 0
+			switch {
+			case d && t:
+				s.TP++
+			case d:
+				s.FP++
+			case t:
+				s.FN++
+			}
+		}
+	}
+	s.Precision = ratio(s.TP, s.TP+s.FP)
+	s.Recall = ratio(s.TP, s.TP+s.FN)
+	if s.Precision+s.Recall > 0 {
+		s.F1 = 2 * s.Precision * s.Recall / (s.Precision + s.Recall)
+	}
+	s.IoU = ratio(s.TP, s.TP+s.FP+s.FN)
+	return s
+}
+
+// ratio returns a/b, or 0 if b is 0.
+func ratio(a, b int) float64 {
+	if b == 0 {
+		return 0
+	}
+	return float64(a) / float64(b)
+}
+
+// evaluate runs the detection on the samples concurrently, writing the results into the output directory,
+// and compares the results with the ground truth. The entries are in the order of the samples.
+// The done callback, if not nil, is called after each image with the number of evaluated images.
+func evaluate(samples []sample, outDir string, resolve func(string) (*params, error), maskThreshold float64,
+	done func(n, total int, e evalEntry)) []evalEntry {
+	entries := make([]evalEntry, len(samples))
+	outputs := make([]string, len(samples))
+	used := make(map[string]bool)
+	for i, s := range samples {
+		name := outputName(s.path)
+		for n := 2; used[name]; n++ {
+			name = fmt.Sprintf("%s_%d", outputName(s.path), n)
+		}
+		used[name] = true
+		outputs[i] = filepath.Join(outDir, name+".png")
+	}
+
+	jobs := make(chan int)
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		finished int
+	)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				s := samples[i]
+				res, det := analyzeFile(context.Background(), s.path, outputs[i], resolve, analysisOptions{})
+				e := evalEntry{
+					Image:    s.path,
+					Label:    s.forged,
+					Mask:     s.mask,
+					Status:   res.Status,
+					Error:    res.Error,
+					Score:    res.Score,
+					Forged:   res.Forged,
+					Regions:  res.Regions,
+					Duration: res.Duration,
+					Evidence: res.Evidence,
+				}
+				if det != nil && s.mask != "" {
+					if truth, err := loadMask(s.mask, maskThreshold); err != nil {
+						e.Status, e.Error = "error", err.Error()
+					} else {
+						e.Pixels = comparePixels(det.mask, truth)
+					}
+				}
+				entries[i] = e
+
+				mu.Lock()
+				finished++
+				if done != nil {
+					done(finished, len(samples), e)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for i := range samples {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	return entries
+}
+
+// printEvalEntry prints the verdict of an evaluated image.
+func printEvalEntry(n, total int, e evalEntry) {
+	if e.Status == "ok" {
+		fmt.Printf("[%d/%d] %s: %s\n", n, total, e.Image, verdict(e.Score))
+	} else {
+		fmt.Printf("[%d/%d] %s: %s\n", n, total, e.Image, e.Error)
+	}
+}
+
+// summarize computes the metrics of the evaluation. The failed images are not taken into account.
+func summarize(entries []evalEntry) evalSummary {
+	var s evalSummary
+	for _, e := range entries {
+		s.Images++
+		if e.Label {
+			s.Forged++
+		} else {
+			s.Authentic++
+		}
+		if e.Status != "ok" {
+			s.Failed++
+			continue
+		}
+		switch {
+		case e.Label && e.Forged:
+			s.TP++
+		case e.Label:
+			s.FN++
+		case e.Forged:
+			s.FP++
+		default:
+			s.TN++
+		}
+		if e.Pixels != nil {
+			s.Masks++
+			s.Precision += e.Pixels.Precision
+			s.Recall += e.Pixels.Recall
+			s.F1 += e.Pixels.F1
+			s.IoU += e.Pixels.IoU
+		}
+	}
+	s.TPR = ratio(s.TP, s.TP+s.FN)
+	s.FPR = ratio(s.FP, s.FP+s.TN)
+	s.Accuracy = ratio(s.TP+s.TN, s.TP+s.TN+s.FP+s.FN)
+	if s.Masks > 0 {
+		n := float64(s.Masks)
+		s.Precision /= n
+		s.Recall /= n
+		s.F1 /= n
+		s.IoU /= n
+	}
+	return s
+}
+
+// writeEvalCSV writes the per-image results of the evaluation, followed by the evidence of the detection.
+// The scores of the detectors are left empty if they are not fused.
+func writeEvalCSV(path string, entries []evalEntry) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := csv.NewWriter(f)
+	header := []string{"image", "label", "mask", "status", "error", "score", "forged", "regions",
+		"tp", "fp", "fn", "precision", "recall", "f1", "iou", "duration",
+		"raw_score", "area", "clusters", "coherence", "votes"}
+	w.Write(append(header, detectors[1:]...))
+	for _, e := range entries {
+		pixels := make([]string, 7)
+		if p := e.Pixels; p != nil {
+			pixels = []string{
+				strconv.Itoa(p.TP),
+				strconv.Itoa(p.FP),
+				strconv.Itoa(p.FN),
+				strconv.FormatFloat(p.Precision, 'f', 4, 64),
+				strconv.FormatFloat(p.Recall, 'f', 4, 64),
+				strconv.FormatFloat(p.F1, 'f', 4, 64),
+				strconv.FormatFloat(p.IoU, 'f', 4, 64),
+			}
+		}
+		row := []string{
+			e.Image,
+			strconv.FormatBool(e.Label),
+			e.Mask,
+			e.Status,
+			e.Error,
+			strconv.FormatFloat(e.Score, 'f', 2, 64),
+			strconv.FormatBool(e.Forged),
+			strconv.Itoa(e.Regions),
+		}
+		row = append(row, pixels...)
+		row = append(row, strconv.FormatFloat(e.Duration, 'f', 3, 64))
+		evidence := make([]string, 4+len(detectors))
+		if ev := e.Evidence; ev != nil {
+			evidence = []string{
+				strconv.FormatFloat(ev.Score, 'f', 4, 64),
+				strconv.FormatFloat(ev.Area, 'f', 6, 64),
+				strconv.Itoa(ev.Clusters),
+				strconv.FormatFloat(ev.Coherence, 'f', 4, 64),
+				strconv.Itoa(ev.Votes),
+			}
+			for _, name := range detectors[1:] {
+				var score string
+				if v, ok := ev.Detectors[name]; ok {
+					score = strconv.FormatFloat(v, 'f', 4, 64)
+				}
+				evidence = append(evidence, score)
+			}
+		}
+		row = append(row, evidence...)
+		w.Write(row)
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// runEval evaluates the detection on the dataset directory given as argument.
+func runEval(args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+	dir := args[0]
+	if _, ok := presets[*evalPreset]; *evalPreset != "" && !ok {
+		return fmt.Errorf("unknown preset: %s", *evalPreset)
+	}
+	resolver := newParamsResolver(evalFlags, *evalPreset, *evalConfig)
+	p := defaultParams()
+	if err := p.apply(resolver.explicit); err != nil {
+		return err
+	}
+	if err := p.validate(); err != nil {
+		return err
+	}
+
+	samples, err := loadDataset(dir, *evalLayout, *evalLabels)
+	if err != nil {
+		return err
+	}
+	if len(samples) == 0 {
+		return fmt.Errorf("no images found in %s", dir)
+	}
+	sort.Slice(samples, func(i, j int) bool {
+		return samples[i].path < samples[j].path
+	})
+
+	outDir := *evalOutDir
+	if outDir == "" {
+		if outDir, err = os.MkdirTemp("", "forensic-eval"); err != nil {
+			return err
+		}
+		defer os.RemoveAll(outDir)
+	} else if err := os.MkdirAll(outDir, 0755); err != nil {
+		return err
+	}
+
+	var done func(n, total int, e evalEntry)
+	if outputFormat == "text" && verbosity > 0 {
+		done = printEvalEntry
+	}
+	entries := evaluate(samples, outDir, resolver.resolve, *evalMaskThr, done)
+	summary := summarize(entries)
+	if *evalCSV != "" {
+		if err := writeEvalCSV(*evalCSV, entries); err != nil {
+			return err
+		}
+	}
+
+	var curves *curveReport
+	if *evalCurves != "" {
+		if curves, err = computeCurves(entries); err != nil {
+			return err
+		}
+		if err := writeCurves(*evalCurves, curves); err != nil {
+			return err
+		}
+	}
+
+	if outputFormat == "json" {
+		return printJSON(evalReport{Dataset: dir, Summary: summary, Images: entries, Curves: curves})
+	}
+	fmt.Printf("Images: %d (%d forged, %d authentic), failed: %d\n", summary.Images, summary.Forged, summary.Authentic, summary.Failed)
+	fmt.Printf("Image level: TPR %.3f, FPR %.3f, accuracy %.3f (TP %d, FP %d, TN %d, FN %d)\n",
+		summary.TPR, summary.FPR, summary.Accuracy, summary.TP, summary.FP, summary.TN, summary.FN)
+	if summary.Masks > 0 {
+		fmt.Printf("Pixel level (%d masks): precision %.3f, recall %.3f, F1 %.3f, IoU %.3f\n",
+			summary.Masks, summary.Precision, summary.Recall, summary.F1, summary.IoU)
+	}
+	if curves != nil {
+		printCurves(curves)
+	}
+	return nil
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"time"
+)
+
+// featureExtractor computes the feature vectors of the overlapping image blocks.
+type featureExtractor interface {
+	// extract returns the feature vector of each block of the image, reporting the progress to the tracker.
+	// It returns the error of the context if it is done before the end of the extraction.
+	extract(ctx context.Context, img *image.NRGBA, t *tracker) ([]feature, error)
+	// transform returns the feature vector of the block obtained by transforming
+	// the block having the provided feature vector.
+	transform(c []float64, t transform) []float64
+	// invariant reports whether the features are invariant to the transformation.
+	invariant(t transform) bool
+}
+
+// newFeatureExtractor returns the feature extractor with the given name.
+func newFeatureExtractor(name string, blockSize int) (featureExtractor, error) {
+	switch name {
+	case "dct":
+		return dctExtractor{blockSize: blockSize}, nil
+	case "fmt":
+		return newFourierMellinExtractor(blockSize), nil
+	}
+	return nil, fmt.Errorf("unsupported feature extractor: %s", name)
+}
+
+// dctExtractor computes the block features from the DCT coefficients
+// of the R,G,B,Y components and the average R,G,B values.
+type dctExtractor struct {
+	blockSize int
+}
+
+// extract returns the DCT features of each block of the image.
+func (e dctExtractor) extract(ctx context.Context, img *image.NRGBA, t *tracker) ([]feature, error) {
+	blockSize := e.blockSize
+
+	// Convert image to YUV color space
+	start := time.Now()
+	yuv := convertRGBImageToYUV(img)
+	newImg := image.NewRGBA(yuv.Bounds())
+	draw.Draw(newImg, image.Rect(0, 0, yuv.Bounds().Dx(), yuv.Bounds().Dy()), yuv, image.ZP, draw.Src)
+	stats.observeStage("yuv", time.Since(start))
+
+	dx, dy := yuv.Bounds().Max.X, yuv.Bounds().Max.Y
+	bdx, bdy := (dx - blockSize + 1), (dy - blockSize + 1)
+	n := float64(blockSize)
+
+	var blocks []imageBlock
+	for i := 0; i < bdx; i++ {
+		for j := 0; j < bdy; j++ {
+			r := image.Rect(i, j, i+blockSize, j+blockSize)
+			block := newImg.SubImage(r).(*image.RGBA)
+			blocks = append(blocks, imageBlock{x: i, y: j, img: block})
+		}
+	}
+
+	bar := startProgress(t, len(blocks), "generate")
+
+	features := make([]feature, 0, len(blocks))
+	for _, block := range blocks {
+		// Average RGB value.
+		var avr, avg, avb float64
+
+		blk := block.img.(*image.RGBA)
+
+		dctPixels := make(dctPx, blockSize)
+		for u := 0; u < blockSize; u++ {
+			dctPixels[u] = make([]pixel, blockSize)
+			for v := 0; v < blockSize; v++ {
+				var cr, cg, cb, cy float64
+
+				for x := 0; x < blockSize; x++ {
+					for y := 0; y < blockSize; y++ {
+						i := blk.PixOffset(blk.Rect.Min.X+x, blk.Rect.Min.Y+y)
+						// Obtain the pixels converted to YUV color space
+						yc, uc, vc := blk.Pix[i+0], blk.Pix[i+1], blk.Pix[i+2]
+						// Convert YUV to RGB and obtain the R,G,B value
+						r, g, b := color.YCbCrToRGB(yc, uc, vc)
+
+						// Compute Discrete Cosine coefficients
+						d := dct(float64(x), float64(y), float64(u), float64(v), n)
+						cr += d * float64(r)
+						cg += d * float64(g)
+						cb += d * float64(b)
+						cy += d * float64(yc)
+
+						if u == 0 && v == 0 {
+							avr += float64(r)
+							avg += float64(g)
+							avb += float64(b)
+						}
+					}
+				}
+
+				// Normalize alpha channel.
+				alpha := func(a float64) float64 {
+					if a == 0 {
+						return math.Sqrt(1.0 / n)
+					}
+					return math.Sqrt(2.0 / n)
+				}
+
+				cu, cv := float64(u), float64(v)
+				cr *= alpha(cu) * alpha(cv)
+				cg *= alpha(cu) * alpha(cv)
+				cb *= alpha(cu) * alpha(cv)
+				cy *= alpha(cu) * alpha(cv)
+
+				dctPixels[u][v] = pixel{cr, cg, cb, cy}
+
+				// Obtain the quantized DCT coefficients.
+				if blockSize <= 4 {
+					dctPixels[u][v].r = dctPixels[u][v].r / q4x4[u][v]
+					dctPixels[u][v].g = dctPixels[u][v].g / q4x4[u][v]
+					dctPixels[u][v].b = dctPixels[u][v].b / q4x4[u][v]
+					dctPixels[u][v].y = dctPixels[u][v].y / q4x4[u][v]
+				}
+			}
+		}
+		avr /= float64(blockSize * blockSize)
+		avg /= float64(blockSize * blockSize)
+		avb /= float64(blockSize * blockSize)
+
+		coef := []float64{
+			dctPixels[0][0].y, dctPixels[0][1].y, dctPixels[1][0].y,
+			dctPixels[0][0].r, dctPixels[0][0].g, dctPixels[0][0].b,
+			// Append average R,G,B values to the features vector.
+			avr, avb, avg,
+		}
+		features = append(features, feature{x: block.x, y: block.y, coef: coef, key: coef})
+		if bar.Increment()%checkInterval == 0 && ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+	}
+	bar.Finish()
+
+	return features, nil
+}
+
+// invariant reports whether the DCT features are invariant to the transformation.
+func (e dctExtractor) invariant(t transform) bool {
+	return t == identity
+}
+
+// transform returns the feature vector of the transformed block without recomputing the DCT.
+// Flipping a block horizontally multiplies its DCT coefficients C(u,v) by (-1)^u,
+// flipping it vertically multiplies them by (-1)^v, while transposing it swaps C(u,v) with C(v,u).
+// The DC coefficients and the average colors are invariant to all these transformations.
+// When the coefficients are quantized the swapped values need to be rescaled.
+func (e dctExtractor) transform(c []float64, t transform) []float64 {
+	res := make([]float64, len(c))
+	copy(res, c)
+
+	// c[1] and c[2] are the C(0,1) and C(1,0) coefficients of the Y channel.
+	c01, c10 := c[1], c[2]
+	q01, q10 := 1.0, 1.0
+	if e.blockSize <= 4 {
+		q01, q10 = q4x4[0][1], q4x4[1][0]
+	}
+
+	switch t {
+	case hflip:
+		res[2] = -c10
+	case vflip:
+		res[1] = -c01
+	case rot90:
+		res[1] = c10 * q10 / q01
+		res[2] = -c01 * q01 / q10
+	case rot180:
+		res[1], res[2] = -c01, -c10
+	}
+	return res
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"math"
+	"math/rand"
+	"path/filepath"
+	"testing"
+)
+
+// extract returns the features of the image, failing the test on error.
+func extract(t *testing.T, e featureExtractor, img *image.NRGBA) []feature {
+	t.Helper()
+	features, err := e.extract(context.Background(), img, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return features
+}
+
+// texturedImage returns a deterministic image with a random texture, so that no two blocks are alike.
+func texturedImage(w, h int, seed int64) *image.NRGBA {
+	rng := rand.New(rand.NewSource(seed))
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for i := 0; i < len(img.Pix); i += 4 {
+		img.Pix[i+0] = uint8(rng.Intn(256))
+		img.Pix[i+1] = uint8(rng.Intn(256))
+		img.Pix[i+2] = uint8(rng.Intn(256))
+		img.Pix[i+3] = 0xff
+	}
+	return img
+}
+
+// referenceDCT computes the orthonormal 2-D DCT-II coefficient (u, v) of the n×n block at (x0, y0),
+// u being the horizontal and v the vertical frequency.
+func referenceDCT(value func(x, y int) float64, x0, y0, n, u, v int) float64 {
+	alpha := func(k int) float64 {
+		if k == 0 {
+			return math.Sqrt(1 / float64(n))
+		}
+		return math.Sqrt(2 / float64(n))
+	}
+	var sum float64
+	for y := 0; y < n; y++ {
+		for x := 0; x < n; x++ {
+			sum += value(x0+x, y0+y) *
+				math.Cos(float64(2*x+1)*float64(u)*math.Pi/float64(2*n)) *
+				math.Cos(float64(2*y+1)*float64(v)*math.Pi/float64(2*n))
+		}
+	}
+	return alpha(u) * alpha(v) * sum
+}
+
+func TestDCTFeatures(t *testing.T) {
+	img := texturedImage(24, 20, 1)
+	yuv := imgToNRGBA(convertRGBImageToYUV(img))
+	channel := func(c int) func(x, y int) float64 {
+		return func(x, y int) float64 {
+			i := yuv.PixOffset(x, y)
+			r, g, b := color.YCbCrToRGB(yuv.Pix[i], yuv.Pix[i+1], yuv.Pix[i+2])
+			return float64([]uint8{yuv.Pix[i], r, g, b}[c])
+		}
+	}
+
+	for _, n := range []int{4, 8} {
+		features := extract(t, dctExtractor{blockSize: n}, img)
+		if want := (24 - n + 1) * (20 - n + 1); len(features) != want {
+			t.Fatalf("block size %d: got %d features, want %d", n, len(features), want)
+		}
+		quant := func(u, v int) float64 {
+			if n <= 4 {
+				return q4x4[u][v]
+			}
+			return 1
+		}
+		for _, f := range features {
+			var avg [4]float64
+			for c := 1; c < 4; c++ {
+				for y := 0; y < n; y++ {
+					for x := 0; x < n; x++ {
+						avg[c] += channel(c)(f.x+x, f.y+y)
+					}
+				}
+				avg[c] /= float64(n * n)
+			}
+			want := []float64{
+				referenceDCT(channel(0), f.x, f.y, n, 0, 0) / quant(0, 0),
+				referenceDCT(channel(0), f.x, f.y, n, 0, 1) / quant(0, 1),
+				referenceDCT(channel(0), f.x, f.y, n, 1, 0) / quant(1, 0),
+				referenceDCT(channel(1), f.x, f.y, n, 0, 0) / quant(0, 0),
+				referenceDCT(channel(2), f.x, f.y, n, 0, 0) / quant(0, 0),
+				referenceDCT(channel(3), f.x, f.y, n, 0, 0) / quant(0, 0),
+				avg[1], avg[3], avg[2],
+			}
+			for k := range want {
+				if math.Abs(f.coef[k]-want[k]) > 1e-9 {
+					t.Fatalf("block size %d, block (%d,%d): coefficient %d is %v, want %v", n, f.x, f.y, k, f.coef[k], want[k])
+				}
+			}
+		}
+	}
+}
+
+func TestDCTFeaturesTransform(t *testing.T) {
+	// The features of a transformed block are derived from the features of the block without recomputing the DCT.
+	img := texturedImage(4, 4, 2)
+	e := dctExtractor{blockSize: 4}
+	orig := extract(t, e, img)[0].coef
+	for _, tr := range []transform{hflip, vflip, rot90, rot180} {
+		got := e.transform(orig, tr)
+		res := image.NewNRGBA(img.Bounds())
+		for y := 0; y < 4; y++ {
+			for x := 0; x < 4; x++ {
+				tx, ty := tr.apply(float64(x)-1.5, float64(y)-1.5)
+				res.SetNRGBA(int(tx+1.5), int(ty+1.5), img.NRGBAAt(x, y))
+			}
+		}
+		want := extract(t, e, res)[0].coef
+		for k := range want {
+			if math.Abs(got[k]-want[k]) > 1e-9 {
+				t.Errorf("%s: coefficient %d is %v, want %v", tr, k, got[k], want[k])
+			}
+		}
+	}
+}
+
+func TestFourierMellinInvariance(t *testing.T) {
+	// The features of an unblurred textured block don't change when the block is transformed around its center.
+	e := newFourierMellinExtractor(8)
+	for seed := int64(1); seed <= 3; seed++ {
+		img := texturedImage(8, 8, seed)
+		orig := extract(t, e, img)[0].coef
+		for _, tr := range []transform{hflip, vflip, rot90, rot180} {
+			if !e.invariant(tr) {
+				t.Errorf("%s: the features are not invariant", tr)
+			}
+			res := image.NewNRGBA(img.Bounds())
+			for y := 0; y < 8; y++ {
+				for x := 0; x < 8; x++ {
+					tx, ty := tr.apply(float64(x)-3.5, float64(y)-3.5)
+					res.SetNRGBA(int(tx+3.5), int(ty+3.5), img.NRGBAAt(x, y))
+				}
+			}
+			got := extract(t, e, res)[0].coef
+			for k := range orig {
+				if math.Abs(got[k]-orig[k]) > 1e-6 {
+					t.Errorf("seed %d, %s: feature %d is %v, want %v", seed, tr, k, got[k], orig[k])
+				}
+			}
+		}
+	}
+}
+
+func TestDCTDetection(t *testing.T) {
+	// Copy a 40×40 region of a textured image 60 pixels to the right and 50 pixels down.
+	img := texturedImage(160, 140, 3)
+	src := image.Rect(20, 20, 60, 60)
+	dst := src.Add(image.Pt(60, 50))
+	for y := src.Min.Y; y < src.Max.Y; y++ {
+		for x := src.Min.X; x < src.Max.X; x++ {
+			img.SetNRGBA(x+60, y+50, img.NRGBAAt(x, y))
+		}
+	}
+
+	p := defaultParams()
+	if err := p.validate(); err != nil {
+		t.Fatal(err)
+	}
+	d, err := process(context.Background(), img, filepath.Join(t.TempDir(), "out.png"), p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(d.regions) != 2 {
+		t.Fatalf("got %d regions, want 2", len(d.regions))
+	}
+	for _, want := range []image.Rectangle{src, dst} {
+		var found bool
+		for _, r := range d.regions {
+			if overlap(r.bounds, want) > 0.9 {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("region %v not detected, regions: %v", want, d.regions)
+		}
+	}
+	if d.score <= 50 {
+		t.Errorf("the forgery probability is %.1f%%, want more than 50%%", d.score)
+	}
+}
+
+func TestTransformDetection(t *testing.T) {
+	// Paste a 40×40 region transformed around its center, for each transform and feature extractor.
+	src := image.Rect(20, 20, 60, 60)
+	dst := src.Add(image.Pt(70, 60))
+	for _, fe := range []string{"dct", "fmt"} {
+		for _, tr := range []transform{hflip, vflip, rot90, rot180} {
+			img := smoothImage(160, 140, 4)
+			for y := src.Min.Y; y < src.Max.Y; y++ {
+				for x := src.Min.X; x < src.Max.X; x++ {
+					tx, ty := tr.apply(float64(x)-39.5, float64(y)-39.5)
+					img.SetNRGBA(int(tx+39.5)+70, int(ty+39.5)+60, img.NRGBAAt(x, y))
+				}
+			}
+
+			p, err := defaultParams().with(map[string]string{"fe": fe})
+			if err != nil {
+				t.Fatal(err)
+			}
+			d, err := process(context.Background(), img, filepath.Join(t.TempDir(), "out.png"), p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if d.score <= 50 {
+				t.Errorf("%s, %s: the forgery probability is %.1f%%", fe, tr, d.score)
+			}
+			// The Fourier-Mellin features also match some of the blocks straddling the border of the copy.
+			for _, want := range []image.Rectangle{src, dst} {
+				var found bool
+				for _, r := range d.regions {
+					found = found || overlap(r.bounds, want) > 0.7
+				}
+				if !found {
+					t.Errorf("%s, %s: region %v not detected, regions: %v", fe, tr, want, d.regions)
+				}
+			}
+			var matched bool
+			for _, pair := range d.pairs {
+				matched = matched || pair.transform == tr
+			}
+			if !matched {
+				t.Errorf("%s, %s: no clone pair of the transform: %v", fe, tr, d.pairs)
+			}
+		}
+	}
+}
+
+// overlap returns the intersection over union of the rectangles.
+func overlap(a, b image.Rectangle) float64 {
+	area := func(r image.Rectangle) float64 { return float64(r.Dx() * r.Dy()) }
+	inter := area(a.Intersect(b))
+	return inter / (area(a) + area(b) - inter)
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"math"
+	"math/cmplx"
+)
+
+// fft computes in place the discrete Fourier transform of the input,
+// using the iterative radix-2 Cooley-Tukey algorithm.
+// The length of the input must be a power of 2.
+func fft(x []complex128) {
+	n := len(x)
+	if n&(n-1) != 0 {
+		panic("fft: the input length must be a power of 2")
+	}
+
+	// Bit reversal permutation.
+	for i, j := 1, 0; i < n; i++ {
+		bit := n >> 1
+		for ; j&bit != 0; bit >>= 1 {
+			j ^= bit
+		}
+		j ^= bit
+		if i < j {
+			x[i], x[j] = x[j], x[i]
+		}
+	}
+
+	for size := 2; size <= n; size <<= 1 {
+		w := cmplx.Exp(complex(0, -2*math.Pi/float64(size)))
+		for start := 0; start < n; start += size {
+			wk := complex(1, 0)
+			for k := 0; k < size/2; k++ {
+				even, odd := x[start+k], x[start+k+size/2]*wk
+				x[start+k] = even + odd
+				x[start+k+size/2] = even - odd
+				wk *= w
+			}
+		}
+	}
+}
+
+// fft2 computes in place the two dimensional discrete Fourier transform
+// of a matrix with w columns and h rows stored in row-major order.
+// Both dimensions must be powers of 2.
+func fft2(x []complex128, w, h int) {
+	for y := 0; y < h; y++ {
+		fft(x[y*w : (y+1)*w])
+	}
+	col := make([]complex128, h)
+	for c := 0; c < w; c++ {
+		for y := 0; y < h; y++ {
+			col[y] = x[y*w+c]
+		}
+		fft(col)
+		for y := 0; y < h; y++ {
+			x[y*w+c] = col[y]
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"math"
+	"math/cmplx"
+	"math/rand"
+	"testing"
+)
+
+// dft computes the discrete Fourier transform of the input by its definition.
+func dft(x []complex128) []complex128 {
+	n := len(x)
+	res := make([]complex128, n)
+	for k := range res {
+		for i, v := range x {
+			res[k] += v * cmplx.Exp(complex(0, -2*math.Pi*float64(k*i)/float64(n)))
+		}
+	}
+	return res
+}
+
+func TestFFT(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for _, n := range []int{1, 2, 4, 8, 64} {
+		x := make([]complex128, n)
+		for i := range x {
+			x[i] = complex(rng.NormFloat64(), rng.NormFloat64())
+		}
+		want := dft(x)
+		fft(x)
+		for k := range x {
+			if cmplx.Abs(x[k]-want[k]) > 1e-9 {
+				t.Errorf("n=%d: X[%d] is %v, want %v", n, k, x[k], want[k])
+			}
+		}
+	}
+}
+
+func TestFFT2(t *testing.T) {
+	rng := rand.New(rand.NewSource(2))
+	w, h := 8, 4
+	x := make([]complex128, w*h)
+	for i := range x {
+		x[i] = complex(rng.Float64(), 0)
+	}
+	want := make([]complex128, w*h)
+	for v := 0; v < h; v++ {
+		for u := 0; u < w; u++ {
+			for y := 0; y < h; y++ {
+				for c := 0; c < w; c++ {
+					phase := -2 * math.Pi * (float64(u*c)/float64(w) + float64(v*y)/float64(h))
+					want[v*w+u] += x[y*w+c] * cmplx.Exp(complex(0, phase))
+				}
+			}
+		}
+	}
+	fft2(x, w, h)
+	for i := range x {
+		if cmplx.Abs(x[i]-want[i]) > 1e-9 {
+			t.Errorf("X[%d,%d] is %v, want %v", i%w, i/w, x[i], want[i])
+		}
+	}
+}
+
+func TestFFTLength(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("the transform of 6 values didn't panic")
+		}
+	}()
+	fft(make([]complex128, 6))
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"image"
+	"math"
+	"math/cmplx"
+)
+
+const (
+	// logPolarRadii is the number of log-polar samples along the radius.
+	logPolarRadii = 16
+	// logPolarAngles is the number of log-polar samples along the angle.
+	logPolarAngles = 16
+	// fmtFrequencies is the number of low frequencies kept on both axes of the Fourier spectrum.
+	fmtFrequencies = 3
+	// fmtQuantization is the quantization step of the Fourier-Mellin features used for sorting.
+	fmtQuantization = 1.0
+)
+
+// fourierMellinExtractor computes the block features from the magnitude of the Fourier
+// transform of the block resampled in log-polar coordinates around its center.
+// A rotation of the block becomes a circular shift along the angle axis, while a scaling
+// becomes a shift along the log-radius axis, neither of them changing the magnitude of
+// the Fourier transform (the latter only approximately, since the shift is not circular).
+// A flip reverses the angle axis, which swaps the magnitudes of the opposite angular
+// frequencies, so the features add them up.
+type fourierMellinExtractor struct {
+	blockSize int
+	// xs and ys are the log-polar sampling positions relative to the block's upper left corner.
+	xs, ys []float64
+}
+
+// newFourierMellinExtractor returns a fourierMellinExtractor for the given block size.
+func newFourierMellinExtractor(blockSize int) fourierMellinExtractor {
+	e := fourierMellinExtractor{blockSize: blockSize}
+
+	center := float64(blockSize-1) / 2
+	rmin, rmax := 0.5, math.Max(center, 0.5)
+	for i := 0; i < logPolarRadii; i++ {
+		r := rmin * math.Pow(rmax/rmin, float64(i)/float64(logPolarRadii-1))
+		for j := 0; j < logPolarAngles; j++ {
+			theta := 2 * math.Pi * float64(j) / float64(logPolarAngles)
+			e.xs = append(e.xs, center+r*math.Cos(theta))
+			e.ys = append(e.ys, center+r*math.Sin(theta))
+		}
+	}
+	return e
+}
+
+// extract returns the Fourier-Mellin features of each block of the image.
+func (e fourierMellinExtractor) extract(ctx context.Context, img *image.NRGBA, t *tracker) ([]feature, error) {
+	dx, dy := img.Bounds().Dx(), img.Bounds().Dy()
+	bdx, bdy := (dx - e.blockSize + 1), (dy - e.blockSize + 1)
+	if bdx <= 0 || bdy <= 0 {
+		return nil, nil
+	}
+	lum := luminance(img)
+
+	// sample returns the bilinearly interpolated luminance value at (x, y).
+	sample := func(x, y float64) float64 {
+		x0, y0 := int(x), int(y)
+		x1, y1 := x0+1, y0+1
+		if x1 >= dx {
+			x1 = dx - 1
+		}
+		if y1 >= dy {
+			y1 = dy - 1
+		}
+		fx, fy := x-float64(x0), y-float64(y0)
+		top := lum[y0*dx+x0]*(1-fx) + lum[y0*dx+x1]*fx
+		bottom := lum[y1*dx+x0]*(1-fx) + lum[y1*dx+x1]*fx
+		return top*(1-fy) + bottom*fy
+	}
+
+	bar := startProgress(t, bdx*bdy, "generate")
+
+	n := float64(logPolarRadii * logPolarAngles)
+	buf := make([]complex128, logPolarRadii*logPolarAngles)
+	features := make([]feature, 0, bdx*bdy)
+	for i := 0; i < bdx; i++ {
+		for j := 0; j < bdy; j++ {
+			for k := range buf {
+				buf[k] = complex(sample(float64(i)+e.xs[k], float64(j)+e.ys[k]), 0)
+			}
+			fft2(buf, logPolarAngles, logPolarRadii)
+
+			coef := make([]float64, 0, fmtFrequencies*fmtFrequencies)
+			key := make([]float64, 0, fmtFrequencies*fmtFrequencies)
+			for r := 0; r < fmtFrequencies; r++ {
+				for a := 0; a < fmtFrequencies; a++ {
+					c := cmplx.Abs(buf[r*logPolarAngles+a]) / n
+					if a > 0 {
+						c += cmplx.Abs(buf[r*logPolarAngles+logPolarAngles-a]) / n
+					}
+					coef = append(coef, c)
+					key = append(key, math.Floor(c/fmtQuantization))
+				}
+			}
+			// The small differences caused by the resampling would scatter the almost identical
+			// blocks in the lexicographic order, so the blocks are sorted on the quantized features.
+			features = append(features, feature{x: i, y: j, coef: coef, key: key})
+			if bar.Increment()%checkInterval == 0 && ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+		}
+	}
+	bar.Finish()
+
+	return features, nil
+}
+
+// transform returns the feature vector unchanged, since the Fourier-Mellin features
+// are invariant to the supported flips and rotations.
+func (e fourierMellinExtractor) transform(c []float64, t transform) []float64 {
+	return c
+}
+
+// invariant reports whether the Fourier-Mellin features are invariant to the transformation.
+// Rotating a block around its center shifts circularly the log-polar samples along the angle axis,
+// which doesn't change the magnitude of the spectrum, while flipping it reverses their order,
+// which swaps the magnitudes of the opposite angular frequencies added up by the features.
+func (e fourierMellinExtractor) invariant(t transform) bool {
+	return true
+}
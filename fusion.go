@@ -0,0 +1,488 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// detectors are the forgery detectors which can be fused, in the order of the reports.
+// The copy-move detection always runs, the scores of the others are added to its evidence:
+//   - copymove: the copy-move detection, its score is the probability of a forgery;
+//   - ela: the error level analysis, looking for the regions having unusual recompression errors;
+//   - noise: the regions having a different noise level than the rest of the image;
+//   - dq: the blocks of a double compressed JPEG image which were compressed only once (see doubleQuantization);
+//   - meta: the traces left in the metadata by the editing software, without heatmap.
+var detectors = []string{"copymove", "ela", "noise", "dq", "meta"}
+
+// fusionRules are the rules combining the scores and the heatmaps of the detectors.
+var fusionRules = []string{"weighted", "max", "calibration"}
+
+// detectorWeight is a detector taking part in the fusion, with its weight.
+type detectorWeight struct {
+	name   string
+	weight float64
+}
+
+// parseDetectors parses the comma separated list of the detectors and their weights, in the name=weight form.
+// The weight is 1 if omitted.
+func parseDetectors(s string) ([]detectorWeight, error) {
+	var res []detectorWeight
+	seen := make(map[string]bool)
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		name, value, weighted := strings.Cut(item, "=")
+		d := detectorWeight{name: strings.TrimSpace(name), weight: 1}
+		if !contains(detectors, d.name) {
+			return nil, fmt.Errorf("unknown detector: %s", d.name)
+		}
+		if seen[d.name] {
+			return nil, fmt.Errorf("duplicate detector: %s", d.name)
+		}
+		seen[d.name] = true
+		if weighted {
+			w, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+			if err != nil || w < 0 {
+				return nil, fmt.Errorf("invalid weight of the %s detector: %s", d.name, value)
+			}
+			d.weight = w
+		}
+		res = append(res, d)
+	}
+	var total float64
+	for _, d := range res {
+		total += d.weight
+	}
+	if len(res) > 0 && total == 0 {
+		return nil, fmt.Errorf("at least one detector must have a positive weight")
+	}
+	sort.SliceStable(res, func(i, j int) bool {
+		return indexOf(detectors, res[i].name) < indexOf(detectors, res[j].name)
+	})
+	return res, nil
+}
+
+// contains reports whether the list contains the value.
+func contains(list []string, value string) bool {
+	return indexOf(list, value) >= 0
+}
+
+// indexOf returns the position of the value in the list, or -1.
+func indexOf(list []string, value string) int {
+	for i, v := range list {
+		if v == value {
+			return i
+		}
+	}
+	return -1
+}
+
+// detectorReport is the outcome of a detector in the fusion.
+type detectorReport struct {
+	Name   string  `json:"name"`
+	Weight float64 `json:"weight"`
+	// Score is the normalized score of the detector, in the [0, 1] range.
+	Score float64 `json:"score"`
+	// Fired is set if the score is above 0.5.
+	Fired bool `json:"fired"`
+	// Regions are the regions of the image flagged by the detector.
+	Regions []regionReport `json:"regions,omitempty"`
+	// Clues explain the score of the detectors without heatmap.
+	Clues []string `json:"clues,omitempty"`
+
+	// heat is the normalized heatmap of the detector in the [0, 1] range, at the size of the analyzed image.
+	heat []float64
+}
+
+// fusion is the combination of the detectors into a single score and heatmap.
+type fusion struct {
+	Rule string `json:"rule"`
+	// Score is the fused probability of a forgery, in the [0, 1] range.
+	Score     float64          `json:"score"`
+	Detectors []detectorReport `json:"detectors"`
+	// Regions are the regions of the composite heatmap.
+	Regions []regionReport `json:"regions,omitempty"`
+	// Heatmap is the image of the composite heatmap, written next to the output image.
+	Heatmap string `json:"heatmap,omitempty"`
+}
+
+// fuse runs the detectors of the parameters on the image file and combines them with the copy-move detection.
+// The ela, noise and dq detectors analyze the image at its original resolution, since the resampling would hide
+// their traces, and their heatmaps are averaged down to the size of the analyzed image. The scores of the detectors
+// are added to the evidence of the detection, whose probability is computed again, since the calibration might use them.
+// The composite heatmap is written next to the output image.
+func fuse(path string, img image.Image, res *detection, destination string, p *params) (*fusion, error) {
+	start := time.Now()
+	defer func() { stats.observeStage("fusion", time.Since(start)) }()
+
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	f := &fusion{Rule: p.Fusion}
+
+	var original *image.NRGBA
+	full := func() (*image.NRGBA, error) {
+		if original == nil {
+			src, err := loadImage(path, math.MaxInt32)
+			if err != nil {
+				return nil, err
+			}
+			original = imgToNRGBA(src)
+		}
+		return original, nil
+	}
+
+	var meta *metadata
+	info := func() (*metadata, error) {
+		if meta == nil {
+			m, err := readMetadata(path)
+			if err != nil {
+				return nil, err
+			}
+			meta = m
+		}
+		return meta, nil
+	}
+
+	scores := make(map[string]float64)
+	for _, d := range p.detectors {
+		r := detectorReport{Name: d.name, Weight: d.weight}
+		switch d.name {
+		case "copymove":
+			r.Score = res.evidence.Probability
+			r.heat = make([]float64, w*h)
+			for y := 0; y < h; y++ {
+				for x := 0; x < w; x++ {
+					r.heat[y*w+x] = float64(res.mask.Pix[res.mask.PixOffset(b.Min.X+x, b.Min.Y+y)]) / 255
+				}
+			}
+			for _, reg := range res.regions {
+				r.Regions = append(r.Regions, reg.report())
+			}
+		case "ela", "noise":
+			src, err := full()
+			if err != nil {
+				return nil, err
+			}
+			var values []float64
+			if d.name == "ela" {
+				values, err = errorMap(src)
+				if err != nil {
+					return nil, err
+				}
+			} else {
+				values = noiseMap(src)
+			}
+			sw, sh := src.Bounds().Dx(), src.Bounds().Dy()
+			values = boxMean(downsample(values, sw, sh, w, h), w, h, p.BlockSize)
+			if d.name == "ela" {
+				r.heat = anomalies(values, false, nil)
+			} else {
+				// Both a lower and a higher noise level betray a region pasted from another image,
+				// but the flat areas, like the overexposed skies, have no noise at all.
+				var flat *image.Alpha
+				if blocks := lowTexture(imgToNRGBA(img), p.BlockSize, p.TextureThreshold); blocks != nil {
+					flat = blockFootprint(image.Rect(0, 0, w, h), blocks, p.BlockSize)
+				}
+				r.heat = anomalies(values, true, flat)
+			}
+			var regions []region
+			r.Score, regions = hotRegions(r.heat, w, h, p)
+			for _, reg := range regions {
+				r.Regions = append(r.Regions, reg.report())
+			}
+		case "dq":
+			m, err := info()
+			if err != nil {
+				return nil, err
+			}
+			if m.luminanceTable == nil {
+				r.Clues = []string{"not a JPEG image"}
+				break
+			}
+			// The luminance is analyzed as decoded, on the grid of the JPEG blocks.
+			src, err := loadImage(path, math.MaxInt32)
+			if err != nil {
+				return nil, err
+			}
+			values, periods := doubleQuantization(src, m.luminanceTable)
+			r.Clues = dqClues(periods)
+			r.heat = downsample(values, src.Bounds().Dx(), src.Bounds().Dy(), w, h)
+			var regions []region
+			r.Score, regions = hotRegions(r.heat, w, h, p)
+			for _, reg := range regions {
+				r.Regions = append(r.Regions, reg.report())
+			}
+		case "meta":
+			m, err := info()
+			if err != nil {
+				return nil, err
+			}
+			r.Score, r.Clues = metadataClues(m)
+		}
+		r.Fired = r.Score > 0.5
+		if d.name != "copymove" {
+			scores[d.name] = r.Score
+		}
+		f.Detectors = append(f.Detectors, r)
+	}
+
+	res.evidence.Detectors = scores
+	p.calibration.apply(res.evidence)
+
+	// The composite heatmap combines the heatmaps of the detectors having one.
+	heat := make([]float64, w*h)
+	var total, weights float64
+	for _, r := range f.Detectors {
+		switch f.Rule {
+		case "max":
+			f.Score = math.Max(f.Score, math.Min(r.Weight*r.Score, 1))
+		default:
+			f.Score += r.Weight * r.Score
+			total += r.Weight
+		}
+		if r.heat == nil {
+			continue
+		}
+		weights += r.Weight
+		for i, v := range r.heat {
+			if f.Rule == "max" {
+				heat[i] = math.Max(heat[i], math.Min(r.Weight*v, 1))
+			} else {
+				heat[i] += r.Weight * v
+			}
+		}
+	}
+	switch f.Rule {
+	case "weighted":
+		f.Score /= total
+	case "calibration":
+		f.Score = res.evidence.Probability
+	}
+	if f.Rule != "max" && weights > 0 {
+		for i := range heat {
+			heat[i] /= weights
+		}
+	}
+	_, regions := hotRegions(heat, w, h, p)
+	for _, reg := range regions {
+		f.Regions = append(f.Regions, reg.report())
+	}
+
+	f.Heatmap = debugName(destination, "fusion")
+	if err := writePNG(f.Heatmap, renderHeatmap(img, heat)); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// errorMap returns the error levels of the JPEG recompression of the image with the default quality of the ela command
+// (see errorLevels), averaged over the color channels, in row-major order.
+func errorMap(img *image.NRGBA) ([]float64, error) {
+	ela, _, _, _, err := errorLevels(img, 90, 1)
+	if err != nil {
+		return nil, err
+	}
+	values := make([]float64, len(ela.Pix)/4)
+	for i := range values {
+		values[i] = (float64(ela.Pix[4*i]) + float64(ela.Pix[4*i+1]) + float64(ela.Pix[4*i+2])) / 3
+	}
+	return values, nil
+}
+
+// noiseMap returns the absolute response of the Laplacian filter on the luminance, in row-major order,
+// which measures the local noise level on the smooth areas of the image.
+func noiseMap(img *image.NRGBA) []float64 {
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	lum := luminance(img)
+	values := make([]float64, w*h)
+	for y := 1; y < h-1; y++ {
+		for x := 1; x < w-1; x++ {
+			i := y*w + x
+			values[i] = math.Abs(4*lum[i] - lum[i-1] - lum[i+1] - lum[i-w] - lum[i+w])
+		}
+	}
+	return values
+}
+
+// downsample averages the values of the sw x sh grid over the cells of the w x h grid.
+func downsample(values []float64, sw, sh, w, h int) []float64 {
+	res := make([]float64, w*h)
+	for y := 0; y < h; y++ {
+		y0, y1 := y*sh/h, (y+1)*sh/h
+		if y1 <= y0 {
+			y1 = y0 + 1
+		}
+		for x := 0; x < w; x++ {
+			x0, x1 := x*sw/w, (x+1)*sw/w
+			if x1 <= x0 {
+				x1 = x0 + 1
+			}
+			var sum float64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					sum += values[sy*sw+sx]
+				}
+			}
+			res[y*w+x] = sum / float64((y1-y0)*(x1-x0))
+		}
+	}
+	return res
+}
+
+// boxMean returns the mean of the values over the (2r+1) x (2r+1) window centered on each cell,
+// using an integral image. The window is clipped at the borders.
+func boxMean(values []float64, w, h, r int) []float64 {
+	sum := make([]float64, (w+1)*(h+1))
+	for y := 0; y < h; y++ {
+		var row float64
+		for x := 0; x < w; x++ {
+			row += values[y*w+x]
+			i := (y+1)*(w+1) + x + 1
+			sum[i] = sum[i-w-1] + row
+		}
+	}
+	res := make([]float64, w*h)
+	for y := 0; y < h; y++ {
+		y0, y1 := int(math.Max(float64(y-r), 0)), int(math.Min(float64(y+r+1), float64(h)))
+		for x := 0; x < w; x++ {
+			x0, x1 := int(math.Max(float64(x-r), 0)), int(math.Min(float64(x+r+1), float64(w)))
+			s := sum[y1*(w+1)+x1] - sum[y1*(w+1)+x0] - sum[y0*(w+1)+x1] + sum[y0*(w+1)+x0]
+			res[y*w+x] = s / float64((y1-y0)*(x1-x0))
+		}
+	}
+	return res
+}
+
+// anomalies normalizes the values into a heatmap, by their deviation from the median in units of the
+// median absolute deviation. The deviations below 2 are ignored and the ones above 6 saturate the heatmap.
+// Only the values above the median are anomalous, unless twoSided is set. The values of the pixels
+// set in the excluded mask, which might be nil, are left out.
+func anomalies(values []float64, twoSided bool, excluded *image.Alpha) []float64 {
+	heat := make([]float64, len(values))
+	skip := func(i int) bool {
+		return excluded != nil && excluded.Pix[i] != 0
+	}
+	var sorted []float64
+	for i, v := range values {
+		if !skip(i) {
+			sorted = append(sorted, v)
+		}
+	}
+	if len(sorted) == 0 {
+		return heat
+	}
+	sort.Float64s(sorted)
+	median := sorted[len(sorted)/2]
+	for i := range sorted {
+		sorted[i] = math.Abs(sorted[i] - median)
+	}
+	sort.Float64s(sorted)
+	// 1.4826 scales the median absolute deviation to the standard deviation of a normal distribution.
+	scale := 1.4826*sorted[len(sorted)/2] + 1e-6
+
+	for i, v := range values {
+		if skip(i) {
+			continue
+		}
+		z := (v - median) / scale
+		if twoSided {
+			z = math.Abs(z)
+		}
+		heat[i] = math.Min(math.Max((z-2)/4, 0), 1)
+	}
+	return heat
+}
+
+// hotRegions extracts the regions of the heatmap above 0.5, post-processed like the detection mask.
+// The score is the mean heat over the regions, or 0 if there are none.
+func hotRegions(heat []float64, w, h int, p *params) (float64, []region) {
+	mask := image.NewAlpha(image.Rect(0, 0, w, h))
+	for i, v := range heat {
+		if v >= 0.5 {
+			mask.Pix[i] = 0xff
+		}
+	}
+	mask, regions := postProcess(mask, p.CloseRadius, p.OpenRadius, p.MinArea)
+	var sum float64
+	var n int
+	for i, v := range mask.Pix {
+		if v != 0 {
+			sum += heat[i]
+			n++
+		}
+	}
+	if n == 0 {
+		return 0, nil
+	}
+	return sum / float64(n), regions
+}
+
+// editingSoftware are the names of the image editors looked up in the Software tag, in lower case.
+var editingSoftware = []string{"photoshop", "gimp", "affinity", "paint.net", "pixelmator", "krita", "snapseed", "picsart", "lightroom"}
+
+// metadataClues returns the score of the traces of editing found in the metadata and their description.
+// The clues are combined as independent probabilities.
+func metadataClues(m *metadata) (float64, []string) {
+	var clues []string
+	notForged := 1.0
+	add := func(p float64, format string, args ...interface{}) {
+		notForged *= 1 - p
+		clues = append(clues, fmt.Sprintf(format, args...))
+	}
+	if sw := m.Tags["Software"]; sw != "" {
+		for _, name := range editingSoftware {
+			if strings.Contains(strings.ToLower(sw), name) {
+				add(0.6, "edited with %s", sw)
+				break
+			}
+		}
+	}
+	if m.Tags["Photoshop"] != "" {
+		add(0.4, "Photoshop resources present")
+	}
+	if mod, orig := m.Tags["DateTime"], m.Tags["DateTimeOriginal"]; mod != "" && orig != "" && mod != orig {
+		add(0.3, "modified on %s, taken on %s", mod, orig)
+	}
+	return 1 - notForged, clues
+}
+
+// renderHeatmap draws the heatmap in red over the image.
+func renderHeatmap(img image.Image, heat []float64) *image.RGBA {
+	b := img.Bounds()
+	res := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(res, res.Bounds(), img, b.Min, draw.Src)
+	mask := image.NewAlpha(res.Bounds())
+	for i, v := range heat {
+		mask.Pix[i] = uint8(math.Round(200 * v))
+	}
+	draw.DrawMask(res, res.Bounds(), &image.Uniform{color.RGBA{255, 0, 0, 255}}, image.ZP, mask, image.ZP, draw.Over)
+	return res
+}
+
+// printFusion prints the fused verdict and the detectors which fired, with the regions they flagged.
+func printFusion(f *fusion) {
+	fmt.Printf("Fusion (%s rule, heatmap %s):\n", f.Rule, f.Heatmap)
+	for _, r := range f.Detectors {
+		state := "-"
+		if r.Fired {
+			state = "fired"
+		}
+		line := fmt.Sprintf("  %-10s weight %.2f  score %.2f  %-5s", r.Name, r.Weight, r.Score, state)
+		for _, reg := range r.Regions {
+			line += fmt.Sprintf(" (%d,%d)-(%d,%d)", reg.X, reg.Y, reg.X+reg.Width, reg.Y+reg.Height)
+		}
+		if len(r.Clues) > 0 {
+			line += " " + strings.Join(r.Clues, "; ")
+		}
+		fmt.Println(strings.TrimRight(line, " "))
+	}
+}
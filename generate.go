@@ -0,0 +1,354 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	// Forgery generator flags
+	generateFlags = flag.NewFlagSet("generate", flag.ExitOnError)
+
+	genOutDir     = generateFlags.String("outdir", "", "Output directory")
+	genCount      = generateFlags.Int("n", 1, "Number of forgeries generated from each image")
+	genSeed       = generateFlags.Int64("seed", 1, "Seed of the random generator")
+	genMinSize    = generateFlags.Float64("min-size", 0.15, "Minimum side of the copied region, as fraction of the smaller image side")
+	genMaxSize    = generateFlags.Float64("max-size", 0.3, "Maximum side of the copied region, as fraction of the smaller image side")
+	genMinShift   = generateFlags.Float64("min-shift", 32, "Minimum translation of the copy in pixels")
+	genRotate     = generateFlags.Float64("rotate", 0, "Maximum rotation angle of the copy in degrees")
+	genMinScale   = generateFlags.Float64("min-scale", 1, "Minimum scale factor of the copy")
+	genMaxScale   = generateFlags.Float64("max-scale", 1, "Maximum scale factor of the copy")
+	genMirror     = generateFlags.Float64("mirror", 0, "Probability of mirroring the copy horizontally")
+	genBrightness = generateFlags.Float64("brightness", 0, "Maximum brightness change of the copy")
+	genNoise      = generateFlags.Float64("noise", 0, "Standard deviation of the gaussian noise added to the forged image")
+	genBlur       = generateFlags.Int("blur", 0, "Blur radius applied to the forged image")
+	genQuality    = generateFlags.Int("q", 0, "JPEG quality of the forged image (0 writes PNG images)")
+)
+
+// box is a rectangle of the image.
+type box struct {
+	X      int `json:"x"`
+	Y      int `json:"y"`
+	Width  int `json:"width"`
+	Height int `json:"height"`
+}
+
+// forgery describes a generated copy-move forgery.
+type forgery struct {
+	Source string `json:"source"`
+	Image  string `json:"image"`
+	Mask   string `json:"mask"`
+	Seed   int64  `json:"seed"`
+	// Region is the copied region and Target the bounds of the pasted copy.
+	Region box `json:"region"`
+	Target box `json:"target"`
+	// Shift is the translation between the centers of the region and of the copy.
+	Shift      [2]float64 `json:"shift"`
+	Rotation   float64    `json:"rotation"`
+	Scale      float64    `json:"scale"`
+	Mirror     bool       `json:"mirror"`
+	Brightness float64    `json:"brightness"`
+	Noise      float64    `json:"noise"`
+	Blur       int        `json:"blur"`
+	Quality    int        `json:"quality,omitempty"`
+	// Area is the number of pasted pixels, marked in the mask.
+	Area int `json:"area"`
+}
+
+// forgeOptions are the ranges of the random forgery parameters.
+type forgeOptions struct {
+	minSize, maxSize   float64
+	minShift           float64
+	rotate             float64
+	minScale, maxScale float64
+	mirror             float64
+	brightness         float64
+	noise              float64
+	blur               int
+	quality            int
+}
+
+// errNoPlacement is returned if the copy can't be placed in the image.
+var errNoPlacement = errors.New("the copied region doesn't fit into the image")
+
+// forge copies a random region of the image onto another place, transformed by a random rotation,
+// scaling, mirroring and brightness change, then blurs the image and adds gaussian noise to it,
+// as the post-processing hiding the forgery. The mask marks the pasted pixels.
+func forge(src *image.NRGBA, opts forgeOptions, rng *rand.Rand) (*image.NRGBA, *image.Gray, *forgery, error) {
+	w, h := src.Bounds().Dx(), src.Bounds().Dy()
+	side := math.Min(float64(w), float64(h))
+
+	// symmetric draws a value of [-max, max], rounded to the hundredth. Adding zero avoids the negative zero.
+	symmetric := func(max float64) float64 {
+		return math.Round((2*rng.Float64()-1)*max*100)/100 + 0
+	}
+	f := &forgery{
+		Rotation:   symmetric(opts.rotate),
+		Scale:      opts.minScale + rng.Float64()*(opts.maxScale-opts.minScale),
+		Mirror:     rng.Float64() < opts.mirror,
+		Brightness: symmetric(opts.brightness),
+		Noise:      opts.noise,
+		Blur:       opts.blur,
+		Quality:    opts.quality,
+	}
+	rw := int(side * (opts.minSize + rng.Float64()*(opts.maxSize-opts.minSize)))
+	rh := int(side * (opts.minSize + rng.Float64()*(opts.maxSize-opts.minSize)))
+	if rw < 2 || rh < 2 || rw >= w || rh >= h {
+		return nil, nil, nil, errNoPlacement
+	}
+	f.Region = box{X: rng.Intn(w - rw), Y: rng.Intn(h - rh), Width: rw, Height: rh}
+
+	// The copy maps the offset d from the region center to S*R*M*d.
+	theta := f.Rotation * math.Pi / 180
+	sin, cos := math.Sin(theta), math.Cos(theta)
+	mx := 1.0
+	if f.Mirror {
+		mx = -1
+	}
+	forward := func(x, y float64) (float64, float64) {
+		x *= mx
+		return f.Scale * (cos*x - sin*y), f.Scale * (sin*x + cos*y)
+	}
+	inverse := func(x, y float64) (float64, float64) {
+		x, y = x/f.Scale, y/f.Scale
+		return mx * (cos*x + sin*y), -sin*x + cos*y
+	}
+
+	// Bounds of the transformed region around its center.
+	hw, hh := float64(rw)/2, float64(rh)/2
+	minX, minY, maxX, maxY := math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)
+	for _, c := range [][2]float64{{-hw, -hh}, {hw, -hh}, {-hw, hh}, {hw, hh}} {
+		x, y := forward(c[0], c[1])
+		minX, minY = math.Min(minX, x), math.Min(minY, y)
+		maxX, maxY = math.Max(maxX, x), math.Max(maxY, y)
+	}
+	tw, th := int(math.Ceil(maxX-minX)), int(math.Ceil(maxY-minY))
+	if tw >= w || th >= h {
+		return nil, nil, nil, errNoPlacement
+	}
+
+	// Place the copy at a random position far enough from the region.
+	sx, sy := float64(f.Region.X)+hw, float64(f.Region.Y)+hh
+	placed := false
+	for try := 0; try < 100 && !placed; try++ {
+		f.Target = box{X: rng.Intn(w - tw), Y: rng.Intn(h - th), Width: tw, Height: th}
+		f.Shift = [2]float64{float64(f.Target.X) - minX - sx, float64(f.Target.Y) - minY - sy}
+		placed = math.Hypot(f.Shift[0], f.Shift[1]) >= opts.minShift
+	}
+	if !placed {
+		return nil, nil, nil, errNoPlacement
+	}
+
+	dst := image.NewNRGBA(src.Bounds())
+	copy(dst.Pix, src.Pix)
+	mask := image.NewGray(src.Bounds())
+	cx, cy := sx+f.Shift[0], sy+f.Shift[1]
+	for y := f.Target.Y; y < f.Target.Y+th; y++ {
+		for x := f.Target.X; x < f.Target.X+tw; x++ {
+			dx, dy := inverse(float64(x)+0.5-cx, float64(y)+0.5-cy)
+			if dx < -hw || dx >= hw || dy < -hh || dy >= hh {
+				continue
+			}
+			c := bilinear(src, sx+dx-0.5, sy+dy-0.5)
+			i := dst.PixOffset(x, y)
+			for k := 0; k < 3; k++ {
+				dst.Pix[i+k] = clamp255(c[k] + f.Brightness)
+			}
+			dst.Pix[i+3] = 0xff
+			mask.Pix[mask.PixOffset(x, y)] = 0xff
+			f.Area++
+		}
+	}
+
+	if opts.blur > 0 {
+		dst = StackBlur(dst, uint32(opts.blur))
+	}
+	if opts.noise > 0 {
+		for i := range dst.Pix {
+			if i%4 != 3 {
+				dst.Pix[i] = clamp255(float64(dst.Pix[i]) + rng.NormFloat64()*opts.noise)
+			}
+		}
+	}
+	return dst, mask, f, nil
+}
+
+// bilinear returns the bilinearly interpolated color channels of the image at (x, y).
+func bilinear(img *image.NRGBA, x, y float64) [3]float64 {
+	b := img.Bounds()
+	x = math.Max(0, math.Min(x, float64(b.Dx()-1)))
+	y = math.Max(0, math.Min(y, float64(b.Dy()-1)))
+	x0, y0 := int(x), int(y)
+	x1, y1 := x0+1, y0+1
+	if x1 >= b.Dx() {
+		x1 = x0
+	}
+	if y1 >= b.Dy() {
+		y1 = y0
+	}
+	fx, fy := x-float64(x0), y-float64(y0)
+
+	var c [3]float64
+	for k := 0; k < 3; k++ {
+		at := func(x, y int) float64 {
+			return float64(img.Pix[img.PixOffset(b.Min.X+x, b.Min.Y+y)+k])
+		}
+		top := at(x0, y0)*(1-fx) + at(x1, y0)*fx
+		bottom := at(x0, y1)*(1-fx) + at(x1, y1)*fx
+		c[k] = top*(1-fy) + bottom*fy
+	}
+	return c
+}
+
+// writeImage encodes the image as JPEG with the given quality, or as PNG if the quality is 0.
+func writeImage(path string, img image.Image, quality int) error {
+	if quality == 0 {
+		return writePNG(path, img)
+	}
+	out, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("Error creating output file: %v", err)
+	}
+	defer out.Close()
+	if err := jpeg.Encode(out, img, &jpeg.Options{Quality: quality}); err != nil {
+		return fmt.Errorf("Error encoding image file: %v", err)
+	}
+	return nil
+}
+
+// runGenerate generates the forgeries of the clean images given as arguments. Besides the forged images,
+// their masks (<name>_gt.png) and descriptions (<name>.json), the original images are written into
+// the output directory, re-encoded like the forgeries, together with the labels.csv file of the dataset.
+func runGenerate(args []string) error {
+	if len(args) == 0 || *genOutDir == "" {
+		return errUsage
+	}
+	opts := forgeOptions{
+		minSize:    *genMinSize,
+		maxSize:    *genMaxSize,
+		minShift:   *genMinShift,
+		rotate:     *genRotate,
+		minScale:   *genMinScale,
+		maxScale:   *genMaxScale,
+		mirror:     *genMirror,
+		brightness: *genBrightness,
+		noise:      *genNoise,
+		blur:       *genBlur,
+		quality:    *genQuality,
+	}
+	switch {
+	case opts.minSize <= 0 || opts.maxSize < opts.minSize || opts.maxSize >= 1:
+		return fmt.Errorf("the region size must satisfy 0 < min-size <= max-size < 1")
+	case opts.minScale <= 0 || opts.maxScale < opts.minScale:
+		return fmt.Errorf("the scale factors must satisfy 0 < min-scale <= max-scale")
+	case opts.quality < 0 || opts.quality > 100:
+		return fmt.Errorf("the JPEG quality must be between 0 and 100")
+	case *genCount < 1:
+		return fmt.Errorf("the number of forgeries must be at least 1")
+	}
+	ext := ".png"
+	if opts.quality > 0 {
+		ext = ".jpg"
+	}
+
+	files, err := expandInputs(args)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("no images found")
+	}
+	// The originals are re-encoded into the output directory, possibly under their own name.
+	outDir, err := filepath.Abs(*genOutDir)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		path, err := filepath.Abs(file.path)
+		if err != nil {
+			return err
+		}
+		if rel, err := filepath.Rel(outDir, path); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return fmt.Errorf("the output directory %s contains the input image %s", *genOutDir, file.path)
+		}
+	}
+
+	var labels [][]string
+	var forgeries []*forgery
+	seed := *genSeed
+	for _, file := range files {
+		img, err := loadImage(file.path, math.MaxInt32)
+		if err != nil {
+			return err
+		}
+		src := imgToNRGBA(img)
+		if err := os.MkdirAll(filepath.Join(*genOutDir, filepath.Dir(file.rel)), 0755); err != nil {
+			return err
+		}
+
+		original := file.rel + ext
+		if err := writeImage(filepath.Join(*genOutDir, original), src, opts.quality); err != nil {
+			return err
+		}
+		labels = append(labels, []string{original, "0", ""})
+
+		for k := 1; k <= *genCount; k++ {
+			rng := rand.New(rand.NewSource(seed))
+			forged, mask, f, err := forge(src, opts, rng)
+			if err != nil {
+				return fmt.Errorf("%s: %v", file.path, err)
+			}
+			name := fmt.Sprintf("%s_f%d", file.rel, k)
+			f.Source, f.Image, f.Mask, f.Seed = file.path, name+ext, name+"_gt.png", seed
+			seed++
+
+			if err := writeImage(filepath.Join(*genOutDir, f.Image), forged, opts.quality); err != nil {
+				return err
+			}
+			if err := writePNG(filepath.Join(*genOutDir, f.Mask), mask); err != nil {
+				return err
+			}
+			desc, err := json.MarshalIndent(f, "", "  ")
+			if err != nil {
+				return err
+			}
+			if err := os.WriteFile(filepath.Join(*genOutDir, name+".json"), desc, 0644); err != nil {
+				return err
+			}
+			labels = append(labels, []string{f.Image, "1", f.Mask})
+			forgeries = append(forgeries, f)
+
+			if outputFormat == "text" && verbosity > 0 {
+				fmt.Printf("%s: region %dx%d at (%d,%d), shift (%.0f, %.0f), rotation %.1f°, scale %.2f, mirror %v, %d px\n",
+					f.Image, f.Region.Width, f.Region.Height, f.Region.X, f.Region.Y, f.Shift[0], f.Shift[1], f.Rotation, f.Scale, f.Mirror, f.Area)
+			}
+		}
+	}
+
+	out, err := os.Create(filepath.Join(*genOutDir, "labels.csv"))
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	w := csv.NewWriter(out)
+	w.Write([]string{"image", "label", "mask"})
+	w.WriteAll(labels)
+	if err := w.Error(); err != nil {
+		return err
+	}
+
+	if outputFormat == "json" {
+		return printJSON(forgeries)
+	}
+	return nil
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"context"
+	"image"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// smoothImage returns a deterministic image with a random texture, smoothed so that it survives the resampling
+// of the transformed copies, the added noise and the blur of the detection.
+func smoothImage(w, h int, seed int64) *image.NRGBA {
+	img := StackBlur(texturedImage(w, h, seed), 2)
+	// Stretch the contrast lost by the blur.
+	for i := range img.Pix {
+		if i%4 != 3 {
+			img.Pix[i] = clamp255((float64(img.Pix[i])-128)*4 + 128)
+		}
+	}
+	return img
+}
+
+// coverage returns the fraction of the pixels of the ground truth mask which are set in the detection mask.
+func coverage(detected *image.Alpha, truth *image.Gray) float64 {
+	var set, found int
+	for i, v := range truth.Pix {
+		if v != 0 {
+			set++
+			if detected.Pix[i] != 0 {
+				found++
+			}
+		}
+	}
+	return float64(found) / float64(set)
+}
+
+// sourceMask returns the mask of the region copied by the forgery.
+func sourceMask(bounds image.Rectangle, f *forgery) *image.Gray {
+	mask := image.NewGray(bounds)
+	for y := f.Region.Y; y < f.Region.Y+f.Region.Height; y++ {
+		for x := f.Region.X; x < f.Region.X+f.Region.Width; x++ {
+			mask.Pix[mask.PixOffset(x, y)] = 0xff
+		}
+	}
+	return mask
+}
+
+func TestForge(t *testing.T) {
+	src := smoothImage(160, 140, 1)
+	opts := forgeOptions{minSize: 0.2, maxSize: 0.3, minShift: 32, minScale: 1, maxScale: 1}
+	forged, mask, f, err := forge(src, opts, rand.New(rand.NewSource(1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dx, dy := int(f.Shift[0]), int(f.Shift[1])
+	if float64(dx) != f.Shift[0] || float64(dy) != f.Shift[1] {
+		t.Fatalf("the shift (%v, %v) of an unscaled copy isn't a whole number of pixels", f.Shift[0], f.Shift[1])
+	}
+	if f.Area != f.Region.Width*f.Region.Height {
+		t.Errorf("the area is %d, want %d", f.Area, f.Region.Width*f.Region.Height)
+	}
+	target := image.Rect(f.Target.X, f.Target.Y, f.Target.X+f.Target.Width, f.Target.Y+f.Target.Height)
+	var area int
+	for y := 0; y < 140; y++ {
+		for x := 0; x < 160; x++ {
+			want := src.NRGBAAt(x, y)
+			if mask.GrayAt(x, y).Y != 0 {
+				area++
+				if !image.Pt(x, y).In(target) {
+					t.Fatalf("the pasted pixel (%d,%d) is outside of the target %v", x, y, target)
+				}
+				// Without rotation, scaling and brightness change, the copy is exact.
+				want = src.NRGBAAt(x-dx, y-dy)
+			}
+			if got := forged.NRGBAAt(x, y); got != want {
+				t.Fatalf("the pixel (%d,%d) is %v, want %v", x, y, got, want)
+			}
+		}
+	}
+	if area != f.Area {
+		t.Errorf("the mask has %d pixels, want %d", area, f.Area)
+	}
+
+	// The forgeries are reproducible from the seed.
+	again, _, g, err := forge(src, opts, rand.New(rand.NewSource(1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *g != *f || string(again.Pix) != string(forged.Pix) {
+		t.Errorf("the forgery generated with the same seed differs: %+v, %+v", g, f)
+	}
+}
+
+func TestForgeDetection(t *testing.T) {
+	if testing.Short() {
+		t.Skip("the detection of the generated forgeries is slow")
+	}
+	translation := forgeOptions{minSize: 0.25, maxSize: 0.3, minShift: 32, minScale: 1, maxScale: 1}
+	mirror, noise := translation, translation
+	mirror.mirror = 1
+	noise.noise = 1
+
+	for _, tc := range []struct {
+		name   string
+		opts   forgeOptions
+		params map[string]string
+		// coverage is the minimum fraction of the forged pixels to detect.
+		coverage float64
+	}{
+		{"dct", translation, nil, 0.8},
+		{"fmt", translation, map[string]string{"fe": "fmt"}, 0.8},
+		{"patchmatch", translation, map[string]string{"method": "patchmatch"}, 0.8},
+		{"mirror", mirror, nil, 0.8},
+		{"mirror fmt", mirror, map[string]string{"fe": "fmt"}, 0.8},
+		// The noise scatters the matches of the copy.
+		{"noise", noise, map[string]string{"dt": "1"}, 0.6},
+	} {
+		p, err := defaultParams().with(tc.params)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for seed := int64(1); seed <= 3; seed++ {
+			src := smoothImage(160, 140, seed)
+			forged, mask, f, err := forge(src, tc.opts, rand.New(rand.NewSource(seed)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			d, err := process(context.Background(), forged, filepath.Join(t.TempDir(), "out.png"), p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if d.score <= 50 {
+				t.Errorf("%s, seed %d: the forgery probability is %.1f%%", tc.name, seed, d.score)
+			}
+			// The blur of the detection shrinks the regions by a pixel.
+			for _, truth := range []*image.Gray{mask, sourceMask(mask.Bounds(), f)} {
+				if c := coverage(d.mask, truth); c < tc.coverage {
+					t.Errorf("%s, seed %d: %.0f%% of the forged pixels detected", tc.name, seed, 100*c)
+				}
+			}
+
+			clean, err := process(context.Background(), src, filepath.Join(t.TempDir(), "out.png"), p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if clean.score > 50 || len(clean.regions) > 0 {
+				t.Errorf("%s, seed %d: the clean image has %d regions, with a forgery probability of %.1f%%",
+					tc.name, seed, len(clean.regions), clean.score)
+			}
+		}
+	}
+}
+
+func TestFusionDetection(t *testing.T) {
+	dir := t.TempDir()
+	src := smoothImage(160, 140, 1)
+	opts := forgeOptions{minSize: 0.25, maxSize: 0.3, minShift: 32, minScale: 1, maxScale: 1}
+	forged, _, _, err := forge(src, opts, rand.New(rand.NewSource(1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	input := filepath.Join(dir, "forged.png")
+	if err := writePNG(input, forged); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, rule := range fusionRules {
+		p, err := defaultParams().with(map[string]string{"fuse": "copymove=2,ela,noise,dq,meta", "fusion": rule})
+		if err != nil {
+			t.Fatal(err)
+		}
+		output := filepath.Join(dir, rule, "out.png")
+		entry, res := analyzeFile(context.Background(), input, output, func(string) (*params, error) { return p, nil }, analysisOptions{})
+		if entry.Status != "ok" {
+			t.Fatalf("%s: %s", rule, entry.Error)
+		}
+		f := entry.Fusion
+		if f == nil || len(f.Detectors) != 5 {
+			t.Fatalf("%s: unexpected fusion %+v", rule, f)
+		}
+		if d := f.Detectors[0]; d.Name != "copymove" || d.Weight != 2 || !d.Fired || len(d.Regions) != 2 {
+			t.Errorf("%s: unexpected copy-move detector %+v", rule, d)
+		}
+		if d := f.Detectors[3]; d.Name != "dq" || d.Score != 0 || len(d.Clues) != 1 || d.Clues[0] != "not a JPEG image" {
+			t.Errorf("%s: unexpected dq detector on a PNG image %+v", rule, d)
+		}
+		for _, name := range []string{"ela", "noise", "dq", "meta"} {
+			if _, ok := res.evidence.Detectors[name]; !ok {
+				t.Errorf("%s: the %s score is missing from the evidence", rule, name)
+			}
+		}
+		var want, total float64
+		for _, d := range f.Detectors {
+			switch rule {
+			case "weighted":
+				want += d.Weight * d.Score
+				total += d.Weight
+			case "max":
+				want = math.Max(want, math.Min(d.Weight*d.Score, 1))
+			}
+		}
+		switch rule {
+		case "weighted":
+			want /= total
+		case "calibration":
+			want = res.evidence.Probability
+		}
+		if math.Abs(f.Score-want) > 1e-9 || entry.Score != 100*f.Score {
+			t.Errorf("%s: the fused score is %.4f (%.2f%%), want %.4f", rule, f.Score, entry.Score, want)
+		}
+		if _, err := os.Stat(f.Heatmap); err != nil {
+			t.Errorf("%s: %v", rule, err)
+		}
+	}
+}
+
+func TestGenerateOutputDir(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "photos", "clean.png")
+	if err := os.MkdirAll(filepath.Dir(input), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := writePNG(input, smoothImage(160, 140, 1)); err != nil {
+		t.Fatal(err)
+	}
+	before, err := os.ReadFile(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func(out string) { *genOutDir = out }(*genOutDir)
+
+	// The output directory can't hold the inputs, directly or in a subdirectory.
+	for _, out := range []string{filepath.Dir(input), dir} {
+		*genOutDir = out
+		if err := runGenerate([]string{input}); err == nil {
+			t.Errorf("generated the dataset into %s, containing the input", out)
+		}
+	}
+	if after, err := os.ReadFile(input); err != nil || string(after) != string(before) {
+		t.Fatalf("the input image was overwritten (%v)", err)
+	}
+
+	*genOutDir = filepath.Join(dir, "synthetic")
+	if err := runGenerate([]string{input}); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"clean.png", "clean_f1.png", "clean_f1_gt.png", "labels.csv"} {
+		if _, err := os.Stat(filepath.Join(*genOutDir, name)); err != nil {
+			t.Error(err)
+		}
+	}
+}
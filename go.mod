@@ -1,10 +1,18 @@
 module github.com/esimov/forensic
 
-go 1.13
+go 1.21
 
 require (
-	github.com/mattn/go-runewidth v0.0.2 // indirect
 	github.com/nfnt/resize v0.0.0-20180221191011-83c6a9932646
-	golang.org/x/sys v0.0.0-20180418212419-3ccc7e577979 // indirect
+	google.golang.org/grpc v1.64.1
+	google.golang.org/protobuf v1.34.2
 	gopkg.in/cheggaaa/pb.v1 v1.0.22
 )
+
+require (
+	github.com/mattn/go-runewidth v0.0.2 // indirect
+	golang.org/x/net v0.26.0 // indirect
+	golang.org/x/sys v0.21.0 // indirect
+	golang.org/x/text v0.16.0 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20240318140521-94a12d6c2237 // indirect
+)
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/esimov/forensic/api/forensicpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// progressInterval is the interval the progress of the analyses streamed by StreamDetect is sampled at.
+const progressInterval = 100 * time.Millisecond
+
+// detectionMethods are the detection methods listed by the gRPC API.
+var detectionMethods = []*forensicpb.Option{
+	{Name: "dct", Description: "Block matching of the feature vectors selected with fe"},
+	{Name: "patchmatch", Description: "Dense matching of the PatchMatch nearest-neighbour field"},
+}
+
+// featureExtractors are the block feature extractors listed by the gRPC API.
+var featureExtractors = []*forensicpb.Option{
+	{Name: "dct", Description: "Quantized DCT coefficients and average colors of the blocks"},
+	{Name: "fmt", Description: "Fourier-Mellin transform of the blocks, invariant to rotation"},
+}
+
+// grpcService is the gRPC API of the forgery detection (see api/forensic.proto). It shares the job queue,
+// the workers and the result directory with the HTTP API of the server.
+type grpcService struct {
+	forensicpb.UnimplementedForensicServer
+	s *server
+}
+
+// newGRPCServer creates the gRPC server exposing the detection of the server.
+func newGRPCServer(s *server) *grpc.Server {
+	gs := grpc.NewServer()
+	forensicpb.RegisterForensicServer(gs, &grpcService{s: s})
+	return gs
+}
+
+// Detect analyzes the image streamed by the client and returns the result.
+// The job is canceled if the client gives up.
+func (g *grpcService) Detect(stream forensicpb.Forensic_DetectServer) error {
+	j, err := g.receive(stream.Recv)
+	if err != nil {
+		return err
+	}
+	if err := g.wait(stream.Context(), j, nil); err != nil {
+		return err
+	}
+	res, err := g.result(j)
+	if err != nil {
+		return err
+	}
+	return stream.SendAndClose(res)
+}
+
+// StreamDetect analyzes the image streamed by the client, sending the progress of the analysis
+// whenever it changes, followed by the result. The job is canceled if the client gives up.
+func (g *grpcService) StreamDetect(stream forensicpb.Forensic_StreamDetectServer) error {
+	j, err := g.receive(stream.Recv)
+	if err != nil {
+		return err
+	}
+	err = g.wait(stream.Context(), j, func(p *forensicpb.Progress) error {
+		return stream.Send(&forensicpb.DetectEvent{Event: &forensicpb.DetectEvent_Progress{Progress: p}})
+	})
+	if err != nil {
+		return err
+	}
+	res, err := g.result(j)
+	if err != nil {
+		return err
+	}
+	return stream.Send(&forensicpb.DetectEvent{Event: &forensicpb.DetectEvent_Result{Result: res}})
+}
+
+// ListMethods returns the detection methods, the feature extractors and the parameter presets.
+func (g *grpcService) ListMethods(ctx context.Context, req *forensicpb.ListMethodsRequest) (*forensicpb.ListMethodsResponse, error) {
+	names := make([]string, 0, len(presets))
+	for name := range presets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return &forensicpb.ListMethodsResponse{
+		Methods:  detectionMethods,
+		Features: featureExtractors,
+		Presets:  names,
+	}, nil
+}
+
+// receive reads the image streamed in chunks and submits its analysis to the queue.
+// The file name and the parameters are taken from the first message.
+func (g *grpcService) receive(recv func() (*forensicpb.DetectRequest, error)) (*job, error) {
+	first, err := recv()
+	if err == io.EOF {
+		return nil, status.Error(codes.InvalidArgument, "missing image")
+	}
+	if err != nil {
+		return nil, err
+	}
+	body := &chunkReader{recv: recv, chunk: first.Chunk, limit: g.s.maxUpload}
+	j, code, err := g.s.create(first.Filename, first.Params, body)
+	if err != nil {
+		return nil, status.Error(grpcCode(code), err.Error())
+	}
+	return j, nil
+}
+
+// wait waits for the end of the job, reporting its progress if report is not nil.
+// The job is canceled if the context is done first.
+func (g *grpcService) wait(ctx context.Context, j *job, report func(*forensicpb.Progress) error) error {
+	ticker := time.NewTicker(progressInterval)
+	defer ticker.Stop()
+
+	var last job
+	for {
+		select {
+		case <-j.done:
+			return nil
+		case <-ctx.Done():
+			g.s.cancel(j)
+			return status.FromContextError(ctx.Err()).Err()
+		case <-ticker.C:
+			if report == nil {
+				continue
+			}
+			snap := g.s.snapshot(j)
+			if snap.Status != jobRunning || snap.Stage == "" || (snap.Stage == last.Stage && snap.Current == last.Current) {
+				continue
+			}
+			last = snap
+			p := &forensicpb.Progress{Stage: snap.Stage, Current: int64(snap.Current), Total: int64(snap.Total)}
+			if err := report(p); err != nil {
+				g.s.cancel(j)
+				return err
+			}
+		}
+	}
+}
+
+// result returns the result of the finished job, with the overlay, mask and heatmap images.
+func (g *grpcService) result(j *job) (*forensicpb.DetectResponse, error) {
+	snap := g.s.snapshot(j)
+	switch snap.Status {
+	case jobDone:
+	case jobCanceled:
+		return nil, status.Error(codes.Canceled, "the analysis was canceled")
+	default:
+		return nil, status.Error(grpcCode(http.StatusUnprocessableEntity), snap.Error)
+	}
+
+	r := snap.Result
+	res := &forensicpb.DetectResponse{
+		Id:       r.ID,
+		Filename: r.Filename,
+		Score:    r.Score,
+		Forged:   r.Forged,
+		Verdict:  r.Verdict,
+		Regions:  regionMessages(r.Regions),
+		Excluded: int32(r.Excluded),
+		Duration: r.Duration,
+		Config:   r.Config.values(),
+		Auto:     r.Auto,
+	}
+	if e := r.Evidence; e != nil {
+		res.Evidence = &forensicpb.Evidence{
+			Score:         e.Score,
+			Area:          e.Area,
+			Regions:       int32(e.Regions),
+			Clusters:      int32(e.Clusters),
+			Coherence:     e.Coherence,
+			Votes:         int32(e.Votes),
+			Probability:   e.Probability,
+			Contributions: e.Contributions,
+			Calibration:   e.Calibration,
+			Detectors:     e.Detectors,
+		}
+	}
+
+	dir := filepath.Join(g.s.results, j.ID)
+	// The files of the result directory, by name.
+	images := map[string]*[]byte{
+		"overlay.png":   &res.Overlay,
+		"mask.png":      &res.Mask,
+		"manifest.json": &res.Manifest,
+	}
+	if f := r.Fusion; f != nil {
+		res.Fusion = &forensicpb.Fusion{
+			Rule:    f.Rule,
+			Score:   f.Score,
+			Regions: regionMessages(f.Regions),
+		}
+		for _, d := range f.Detectors {
+			res.Fusion.Detectors = append(res.Fusion.Detectors, &forensicpb.Detector{
+				Name:    d.Name,
+				Weight:  d.Weight,
+				Score:   d.Score,
+				Fired:   d.Fired,
+				Regions: regionMessages(d.Regions),
+				Clues:   d.Clues,
+			})
+		}
+		if f.Heatmap != "" {
+			images[filepath.Base(f.Heatmap)] = &res.Fusion.Heatmap
+		}
+	}
+	for name, data := range images {
+		var err error
+		if *data, err = os.ReadFile(filepath.Join(dir, name)); err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+	}
+	return res, nil
+}
+
+// regionMessages converts the region reports into their protobuf messages.
+func regionMessages(regions []regionReport) []*forensicpb.Region {
+	res := make([]*forensicpb.Region, len(regions))
+	for i, r := range regions {
+		res[i] = &forensicpb.Region{
+			Label:  int32(r.Label),
+			X:      int32(r.X),
+			Y:      int32(r.Y),
+			Width:  int32(r.Width),
+			Height: int32(r.Height),
+			Area:   int32(r.Area),
+			Cx:     r.CX,
+			Cy:     r.CY,
+		}
+	}
+	return res
+}
+
+// grpcCode returns the gRPC status code matching the HTTP status code of an error of the API.
+func grpcCode(status int) codes.Code {
+	switch status {
+	case http.StatusBadRequest, http.StatusUnprocessableEntity:
+		return codes.InvalidArgument
+	case http.StatusRequestEntityTooLarge:
+		return codes.ResourceExhausted
+	case http.StatusServiceUnavailable:
+		return codes.Unavailable
+	default:
+		return codes.Internal
+	}
+}
+
+// chunkReader reads the image streamed in the chunks of the detection requests,
+// failing once more than limit bytes have been read.
+type chunkReader struct {
+	recv  func() (*forensicpb.DetectRequest, error)
+	chunk []byte
+	limit int64
+	read  int64
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	for len(r.chunk) == 0 {
+		req, err := r.recv()
+		if err != nil {
+			return 0, err
+		}
+		r.chunk = req.Chunk
+	}
+	n := copy(p, r.chunk)
+	r.chunk = r.chunk[n:]
+	if r.read += int64(n); r.read > r.limit {
+		return n, &http.MaxBytesError{Limit: r.limit}
+	}
+	return n, nil
+}
+
+// stopGRPC stops the gRPC server gracefully, or right away once the context is done.
+func stopGRPC(ctx context.Context, gs *grpc.Server) {
+	done := make(chan struct{})
+	go func() {
+		gs.GracefulStop()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		gs.Stop()
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"image"
+	"image/png"
+	"net"
+	"testing"
+
+	"github.com/esimov/forensic/api/forensicpb"
+	"github.com/esimov/forensic/client"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// startGRPC starts the gRPC API of a server accepting the uploads up to maxUpload bytes, and returns its client.
+func startGRPC(t *testing.T, maxUpload int64) *client.Client {
+	t.Helper()
+	p := defaultParams()
+	if err := p.validate(); err != nil {
+		t.Fatal(err)
+	}
+	s, err := newServer(t.TempDir(), maxUpload, 1, 10, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.work()
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gs := newGRPCServer(s)
+	go gs.Serve(lis)
+	t.Cleanup(gs.Stop)
+
+	c, err := client.Dial(lis.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+// forgedPNG returns a PNG encoded textured image, with a 40×40 region copied 60 pixels to the right and 50 pixels down.
+func forgedPNG(t *testing.T) []byte {
+	t.Helper()
+	img := texturedImage(160, 140, 3)
+	for y := 20; y < 60; y++ {
+		for x := 20; x < 60; x++ {
+			img.SetNRGBA(x+60, y+50, img.NRGBAAt(x, y))
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestGRPCDetect(t *testing.T) {
+	data := forgedPNG(t)
+	c := startGRPC(t, 1<<20)
+	ctx := context.Background()
+
+	// The callback is typed as the progress hook of the client package.
+	var events []*forensicpb.Progress
+	var progress client.ProgressFunc = func(p *forensicpb.Progress) {
+		events = append(events, p)
+	}
+	res, err := c.StreamDetect(ctx, "forged.png", bytes.NewReader(data), map[string]string{"preset": "balanced"}, progress)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range events {
+		if p.Stage != "generate" && p.Stage != "analyze" && p.Stage != "detect" || p.Current > p.Total {
+			t.Errorf("unexpected progress event %v", p)
+		}
+	}
+	if !res.Forged || len(res.Regions) != 2 {
+		t.Errorf("got forged=%v with %d regions, want a forgery with 2 regions", res.Forged, len(res.Regions))
+	}
+	if res.Filename != "forged.png" || res.Config["preset"] != "balanced" || res.Evidence == nil {
+		t.Errorf("unexpected response: filename %q, config %v, evidence %v", res.Filename, res.Config, res.Evidence)
+	}
+	mask, err := png.Decode(bytes.NewReader(res.Mask))
+	if err != nil {
+		t.Fatalf("invalid mask: %v", err)
+	}
+	if mask.Bounds() != image.Rect(0, 0, 160, 140) {
+		t.Errorf("the mask bounds are %v", mask.Bounds())
+	}
+	if _, err := png.Decode(bytes.NewReader(res.Overlay)); err != nil {
+		t.Errorf("invalid overlay: %v", err)
+	}
+	var m manifest
+	if err := json.Unmarshal(res.Manifest, &m); err != nil {
+		t.Fatalf("invalid manifest: %v", err)
+	}
+	sum := sha512.Sum512(data)
+	if len(m.Images) != 1 || m.Images[0].Input.SHA512 != hex.EncodeToString(sum[:]) || m.Images[0].Status != "ok" || len(m.Images[0].Outputs) == 0 {
+		t.Errorf("unexpected manifest records %+v", m.Images)
+	}
+
+	// The synchronous detection gives the same result.
+	det, err := c.Detect(ctx, "forged.png", bytes.NewReader(data), map[string]string{"preset": "balanced"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if det.Score != res.Score || len(det.Regions) != len(res.Regions) {
+		t.Errorf("Detect scored %.2f with %d regions, StreamDetect %.2f with %d regions", det.Score, len(det.Regions), res.Score, len(res.Regions))
+	}
+}
+
+func TestGRPCErrors(t *testing.T) {
+	data := forgedPNG(t)
+	ctx := context.Background()
+	c := startGRPC(t, int64(len(data)-1))
+
+	for _, tc := range []struct {
+		name   string
+		data   []byte
+		params map[string]string
+		code   codes.Code
+	}{
+		{"too large", data, nil, codes.ResourceExhausted},
+		{"calibration", data[:100], map[string]string{"calibration": "model.json"}, codes.InvalidArgument},
+		{"block size", data[:100], map[string]string{"bs": "16"}, codes.InvalidArgument},
+		{"not an image", data[:100], nil, codes.InvalidArgument},
+	} {
+		_, err := c.Detect(ctx, "image.png", bytes.NewReader(tc.data), tc.params)
+		if got := status.Code(err); got != tc.code {
+			t.Errorf("%s: got the %v status (%v), want %v", tc.name, got, err, tc.code)
+		}
+	}
+}
+
+func TestGRPCListMethods(t *testing.T) {
+	c := startGRPC(t, 1<<20)
+	res, err := c.ListMethods(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Methods) != 2 || len(res.Features) != 2 || len(res.Presets) != len(presets) {
+		t.Errorf("got %d methods, %d features and %d presets", len(res.Methods), len(res.Features), len(res.Presets))
+	}
+}
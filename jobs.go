@@ -0,0 +1,305 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Job statuses
+const (
+	jobQueued   = "queued"
+	jobRunning  = "running"
+	jobDone     = "done"
+	jobFailed   = "failed"
+	jobCanceled = "canceled"
+)
+
+// jobFile is the file of the result directory storing the state of the job.
+const jobFile = "job.json"
+
+// job is the analysis of an uploaded image. Its state is stored in the result directory
+// whenever its status changes, so that the jobs survive the restarts of the server.
+type job struct {
+	ID       string `json:"id"`
+	Status   string `json:"status"`
+	Filename string `json:"filename,omitempty"`
+	// Input is the name of the uploaded image in the result directory.
+	Input  string            `json:"input"`
+	Params map[string]string `json:"params,omitempty"`
+
+	Created  time.Time  `json:"created"`
+	Started  *time.Time `json:"started,omitempty"`
+	Finished *time.Time `json:"finished,omitempty"`
+
+	// Stage, Current and Total are the counters of the progress bar of the running stage.
+	// They are not stored, since they are lost anyway on restart.
+	Stage   string `json:"stage,omitempty"`
+	Current int    `json:"current,omitempty"`
+	Total   int    `json:"total,omitempty"`
+
+	Error  string          `json:"error,omitempty"`
+	Result *detectResponse `json:"result,omitempty"`
+
+	// done is closed once the job is finished.
+	done   chan struct{}
+	cancel context.CancelFunc
+}
+
+// finished reports whether the job is done, failed or canceled.
+func (j *job) finished() bool {
+	return j.Finished != nil
+}
+
+// loadJobs reads the jobs stored in the result directory and returns the unfinished ones,
+// in the order of their submission. The jobs interrupted by the shutdown are run again.
+func (s *server) loadJobs() ([]*job, error) {
+	dirs, err := os.ReadDir(s.results)
+	if err != nil {
+		return nil, err
+	}
+	var pending []*job
+	for _, d := range dirs {
+		if !d.IsDir() || !idPattern.MatchString(d.Name()) {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(s.results, d.Name(), jobFile))
+		if err != nil {
+			continue
+		}
+		j := new(job)
+		if err := json.Unmarshal(data, j); err != nil || j.ID != d.Name() {
+			continue
+		}
+		j.done = make(chan struct{})
+		if j.finished() {
+			close(j.done)
+		} else {
+			j.Status, j.Started = jobQueued, nil
+			pending = append(pending, j)
+		}
+		s.jobs[j.ID] = j
+	}
+	sort.Slice(pending, func(i, k int) bool {
+		return pending[i].Created.Before(pending[k].Created)
+	})
+	return pending, nil
+}
+
+// saveJob writes the state of the job into its result directory. It must be called with the lock held.
+func (s *server) saveJob(j *job) error {
+	data, err := json.MarshalIndent(j, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(s.results, j.ID, jobFile)
+	if err := os.WriteFile(path+".tmp", data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// submit stores the new job and adds it to the queue.
+func (s *server) submit(j *job) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.saveJob(j); err != nil {
+		return err
+	}
+	select {
+	case s.queue <- j:
+	default:
+		return errors.New("the job queue is full")
+	}
+	s.jobs[j.ID] = j
+	return nil
+}
+
+// work runs the queued jobs one after the other.
+func (s *server) work() {
+	for j := range s.queue {
+		s.run(j)
+	}
+}
+
+// run analyzes the image of the job, unless the job has been canceled while queued.
+func (s *server) run(j *job) {
+	s.mu.Lock()
+	if j.Status != jobQueued {
+		s.mu.Unlock()
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	now := time.Now().UTC()
+	j.Status, j.Started, j.cancel = jobRunning, &now, cancel
+	s.saveJob(j)
+	s.running++
+	s.mu.Unlock()
+
+	var (
+		resp  *detectResponse
+		entry batchEntry
+	)
+	p, err := s.params.with(j.Params)
+	if err != nil {
+		entry.Status, entry.Error = "error", err.Error()
+	} else {
+		t := &tracker{
+			image: j.ID,
+			reporter: progressFunc(func(e progressEvent) {
+				s.mu.Lock()
+				j.Stage, j.Current, j.Total = e.Stage, e.Current, e.Total
+				s.mu.Unlock()
+			}),
+		}
+		resp, entry = s.analyze(ctx, j, p, t)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.running--
+	switch {
+	case resp != nil:
+		j.Status, j.Result = jobDone, resp
+	case entry.Status == "canceled":
+		j.Status = jobCanceled
+	default:
+		j.Status, j.Error = jobFailed, entry.Error
+	}
+	s.finish(j)
+	logger.Info("job finished", "id", j.ID, "status", j.Status, "error", j.Error, "duration", entry.Duration)
+}
+
+// finish records the end of the job. It must be called with the lock held.
+func (s *server) finish(j *job) {
+	now := time.Now().UTC()
+	j.Finished, j.cancel = &now, nil
+	j.Stage, j.Current, j.Total = "", 0, 0
+	s.saveJob(j)
+	close(j.done)
+}
+
+// cancel stops the job if it is queued or running.
+func (s *server) cancel(j *job) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch j.Status {
+	case jobQueued:
+		j.Status = jobCanceled
+		s.finish(j)
+	case jobRunning:
+		// The analysis stops at its next check of the context.
+		j.cancel()
+	}
+}
+
+// remove deletes the job and its result directory. It must be called with the lock held.
+func (s *server) remove(j *job) error {
+	delete(s.jobs, j.ID)
+	return os.RemoveAll(filepath.Join(s.results, j.ID))
+}
+
+// expireJobs periodically removes the finished jobs older than the retention time,
+// and the oldest ones beyond the maximum number of jobs kept.
+func (s *server) expireJobs() {
+	for {
+		s.expire(time.Now())
+		time.Sleep(time.Minute)
+	}
+}
+
+// expire removes the expired jobs.
+func (s *server) expire(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var finished []*job
+	for _, j := range s.jobs {
+		if j.finished() {
+			finished = append(finished, j)
+		}
+	}
+	sort.Slice(finished, func(i, k int) bool {
+		return finished[i].Finished.After(*finished[k].Finished)
+	})
+	for i, j := range finished {
+		if (s.retention > 0 && now.Sub(*j.Finished) > s.retention) || (s.maxJobs > 0 && i >= s.maxJobs) {
+			s.remove(j)
+		}
+	}
+}
+
+// handleJobs submits a new job (POST) or lists the jobs (GET).
+func (s *server) handleJobs(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		j := s.receive(w, r)
+		if j == nil {
+			return
+		}
+		w.Header().Set("Location", "/jobs/"+j.ID)
+		writeJSON(w, http.StatusAccepted, s.snapshot(j))
+	case http.MethodGet, http.MethodHead:
+		s.mu.Lock()
+		list := make([]job, 0, len(s.jobs))
+		for _, j := range s.jobs {
+			list = append(list, *j)
+		}
+		s.mu.Unlock()
+		sort.Slice(list, func(i, k int) bool {
+			return list[i].Created.Before(list[k].Created)
+		})
+		writeJSON(w, http.StatusOK, list)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// handleJob reports the status of a job (GET), cancels it if it is not finished
+// or deletes it together with its results otherwise (DELETE).
+func (s *server) handleJob(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, "/jobs/")
+	s.mu.Lock()
+	j, ok := s.jobs[id]
+	s.mu.Unlock()
+	if !ok {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		writeJSON(w, http.StatusOK, s.snapshot(j))
+	case http.MethodDelete:
+		s.mu.Lock()
+		if j.finished() {
+			err := s.remove(j)
+			s.mu.Unlock()
+			if err != nil {
+				writeError(w, http.StatusInternalServerError, err.Error())
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		s.mu.Unlock()
+		s.cancel(j)
+		writeJSON(w, http.StatusAccepted, s.snapshot(j))
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// snapshot returns a copy of the job state.
+func (s *server) snapshot(j *job) job {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return *j
+}
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"image"
@@ -9,17 +11,17 @@ import (
 	_ "image/jpeg"
 	"image/png"
 	_ "image/png"
-	"log"
 	"math"
 	"os"
+	"path/filepath"
 	"sort"
+	"strings"
 	"time"
 
 	"github.com/nfnt/resize"
-	"gopkg.in/cheggaaa/pb.v1"
 )
 
-// MaxImageSize is the resized image maximum width or height depending on the image ratio.
+// MaxImageSize is the default resized image maximum width or height depending on the image ratio.
 const MaxImageSize = 320
 
 const Banner = `
@@ -27,7 +29,7 @@ const Banner = `
 ├┤ │ │├┬┘├┤ │││└─┐││
 └  └─┘┴└─└─┘┘└┘└─┘┴└─┘
 
-Image forgery detection library.
+Image forgery detection tool.
     Version: %s
 
 `
@@ -36,16 +38,29 @@ Image forgery detection library.
 var Version string
 
 var (
-	// Flags
-	source            = flag.String("in", "", "Input image")
-	destination       = flag.String("out", "", "Output image")
-	blurRadius        = flag.Int("blur", 1, "Blur radius")
-	blockSize         = flag.Int("bs", 4, "Block size")
-	offsetThreshold   = flag.Int("ot", 72, "Offset threshold")
-	distanceThreshold = flag.Float64("dt", 0.4, "Distance threshold")
-	forgeryThreshold  = flag.Float64("ft", 210, "Forgery threshold")
+	// Detection flags
+	detectFlags = flag.NewFlagSet("detect", flag.ExitOnError)
+
+	source       = detectFlags.String("in", "", "Input image")
+	destination  = detectFlags.String("out", "", "Output image")
+	debugOutput  = detectFlags.Bool("debug", false, "Write the low-texture blocks excluded from matching into <out>_excluded.png")
+	outputDir    = detectFlags.String("outdir", "", "Output directory (batch mode)")
+	summaryFile  = detectFlags.String("summary", "", "Batch summary file, CSV or JSON depending on the extension (default <outdir>/summary.csv)")
+	configFile   = detectFlags.String("config", "", "Configuration file (YAML, JSON or TOML), looked up as .forensic.{yaml,yml,json,toml} in the image directory and its parents if empty")
+	presetName   = detectFlags.String("preset", "", "Parameter preset: strict, balanced, sensitive, high-res")
+	metricsFile  = detectFlags.String("metrics", "", "Prometheus metrics file written at the end of the run (node exporter textfile format)")
+	reportFile   = detectFlags.String("report", "", "Self-contained HTML report of the analysis (single image)")
+	manifestFile = detectFlags.String("manifest", "", "Chain-of-custody manifest of the run (default <out>_manifest.json, or <outdir>/manifest.json in batch mode)")
+	noManifest   = detectFlags.Bool("no-manifest", false, "Don't write the chain-of-custody manifest of the run")
+	runLogFile   = detectFlags.String("runlog", "", "Append-only run log (default custody.log in the directory of the manifest)")
+	signKey      = detectFlags.String("sign", "", "Ed25519 private key signing the manifest into <manifest>.sig (see forensic keygen)")
 )
 
+func init() {
+	// The detection parameters. The values set on the command line override the preset and the configuration file.
+	defaultParams().register(detectFlags)
+}
+
 // pixel struct contains the discrete cosine transformation R,G,B,Y values.
 type pixel struct {
 	r, g, b, y float64
@@ -62,17 +77,24 @@ type imageBlock struct {
 }
 
 // vector struct contains the neighboring blocks top left position and the shift vectors between them.
+// For the blocks matched with a transformed copy the shift vector is computed between the
+// target block and the transformed position of the source block, so it's constant over the copied region.
 type vector struct {
 	xa, ya           int
 	xb, yb           int
 	offsetX, offsetY float64
+	transform        transform
 }
 
-// feature struct contains the feature blocks x, y position and their respective values.
+// feature struct contains the feature block x, y position and its feature vector.
+// The blocks are sorted on their key, which is either the feature vector itself or its quantized version.
+// The transformed flag is set for the feature vectors obtained from a transformed block.
 type feature struct {
-	x    int
-	y    int
-	coef float64
+	x           int
+	y           int
+	coef        []float64
+	key         []float64
+	transformed bool
 }
 
 // q4x4 is the quantization matrix table.
@@ -84,230 +106,547 @@ var q4x4 = [][]float64{
 }
 
 var (
-	resizedImg     image.Image
-	features       []feature
-	vectors        []vector
-	cr, cg, cb, cy float64
+	// interactive enables the progress bars and the detailed console output of the commands.
+	// It is set from the global options; the analyses get it through their options (see analysisOptions).
+	interactive = true
 )
 
 func main() {
-	done := make(chan struct{})
-	flag.Usage = func() {
-		fmt.Fprintf(os.Stderr, fmt.Sprintf(Banner, Version))
-		flag.PrintDefaults()
+	if err := dispatch(os.Args[1:]); err != nil {
+		if err == errUsage {
+			os.Exit(2)
+		}
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+}
+
+// runDetect runs the forgery detection on a single image or, if an output directory is provided, on a batch of images.
+func runDetect(args []string) error {
+	// The positional arguments are batch inputs, like the value of the -in flag.
+	inputs := args
+	if len(*source) > 0 {
+		inputs = append([]string{*source}, inputs...)
+	}
+	batch := len(*outputDir) > 0
+
+	if len(inputs) == 0 || (!batch && len(*destination) == 0) {
+		return errUsage
+	}
+
+	if !batch && (len(inputs) > 1 || isBatchInput(inputs[0])) {
+		return fmt.Errorf("the -outdir flag is required for processing multiple images")
 	}
-	flag.Parse()
 
-	if len(*source) == 0 || len(*destination) == 0 {
-		log.Fatal("Usage: forensic -in input.jpg -out out.jpg")
+	if batch && len(*reportFile) > 0 {
+		return fmt.Errorf("the -report flag is only supported for a single image")
 	}
 
-	if *blockSize <= 1 {
-		log.Fatal("ERROR: the block size must be greater then 1.")
+	if _, ok := presets[*presetName]; *presetName != "" && !ok {
+		return fmt.Errorf("unknown preset: %s", *presetName)
+	}
+
+	// Check the command line parameters on their own, before the analysis of the images.
+	p := defaultParams()
+	resolver := newParamsResolver(detectFlags, *presetName, *configFile)
+	if err := p.apply(resolver.explicit); err != nil {
+		return err
+	}
+	if err := p.validate(); err != nil {
+		return err
+	}
+	if *noManifest && (*manifestFile != "" || *runLogFile != "" || *signKey != "") {
+		return fmt.Errorf("the -manifest, -runlog and -sign flags can't be used with the -no-manifest flag")
+	}
+	// The signing key is checked before the analysis of the images.
+	if *signKey != "" {
+		if _, err := loadPrivateKey(*signKey); err != nil {
+			return err
+		}
 	}
 
 	start := time.Now()
+	// Hashing the inputs and outputs of large batches takes time, so the manifest can be skipped.
+	var custody *manifest
+	manifestPath := *manifestFile
+	if !*noManifest {
+		custody = newManifest(start)
+		if manifestPath == "" {
+			manifestPath = manifestName(*destination, *outputDir)
+		}
+	}
+	if *metricsFile != "" {
+		// The metrics include the failed analyses.
+		defer func() {
+			if err := stats.writeFile(*metricsFile); err != nil {
+				logger.Error("cannot write the metrics", "file", *metricsFile, "error", err)
+			}
+		}()
+	}
 
-	input, err := os.Open(*source)
-	defer input.Close()
+	if batch {
+		entries, err := runBatch(inputs, *outputDir, *summaryFile, workers, resolver, *debugOutput)
+		if err != nil {
+			return err
+		}
+		if custody != nil {
+			for _, e := range entries {
+				if err := custody.add(e); err != nil {
+					return err
+				}
+			}
+			summary := *summaryFile
+			if summary == "" {
+				summary = filepath.Join(*outputDir, "summary.csv")
+			}
+			if err := custody.addOutput(summary); err != nil {
+				return err
+			}
+			data, err := recordRun(custody, manifestPath, *runLogFile)
+			if err != nil {
+				return err
+			}
+			if *signKey != "" {
+				if err := signManifest(manifestPath, data, *signKey); err != nil {
+					return fmt.Errorf("Error signing the manifest: %v", err)
+				}
+			}
+		}
+		if outputFormat == "json" {
+			return printJSON(entries)
+		}
+		if verbosity > 0 {
+			fmt.Printf("\nDone in: %.2fs\n", time.Since(start).Seconds())
+		}
+		return nil
+	}
 
+	entry, res := analyzeFile(context.Background(), inputs[0], *destination, resolver.resolve, analysisOptions{
+		tracker: &tracker{reporter: progressOutput},
+		debug:   *debugOutput,
+		verbose: interactive,
+	})
+	if entry.Status != "ok" {
+		// The failed analysis is recorded as well, if its input can be hashed.
+		if custody != nil && custody.add(entry) == nil {
+			if _, err := recordRun(custody, manifestPath, *runLogFile); err != nil {
+				logger.Error(err.Error())
+			}
+		}
+		return errors.New(entry.Error)
+	}
+	if len(*reportFile) > 0 {
+		if err := writeReport(*reportFile, entry, res); err != nil {
+			return fmt.Errorf("Error writing the report: %v", err)
+		}
+	}
+	if custody != nil {
+		if err := custody.add(entry); err != nil {
+			return err
+		}
+		if len(*reportFile) > 0 {
+			if err := custody.addOutput(*reportFile); err != nil {
+				return err
+			}
+		}
+		data, err := recordRun(custody, manifestPath, *runLogFile)
+		if err != nil {
+			return err
+		}
+		if *signKey != "" {
+			if err := signManifest(manifestPath, data, *signKey); err != nil {
+				return fmt.Errorf("Error signing the manifest: %v", err)
+			}
+		}
+	}
+	if outputFormat == "json" {
+		return printJSON(entry)
+	}
+	if interactive {
+		for _, note := range entry.Auto {
+			fmt.Printf("Auto: %s\n", note)
+		}
+		fmt.Printf("Configuration: %s\n", entry.Config)
+	}
+	v := verdict(entry.Score)
+	fmt.Println(strings.ToUpper(v[:1]) + v[1:])
+	if interactive && entry.Evidence != nil {
+		printEvidence(entry.Evidence)
+	}
+	if interactive && entry.Fusion != nil {
+		printFusion(entry.Fusion)
+	}
+
+	if verbosity > 0 {
+		fmt.Printf("\nDone in: %.2fs\n", time.Since(start).Seconds())
+	}
+	return nil
+}
+
+// loadImage decodes the image file and resizes it to fit into maxSize.
+func loadImage(path string, maxSize int) (image.Image, error) {
+	input, err := os.Open(path)
 	if err != nil {
-		log.Fatalf("Error reading the image file: %v", err)
+		return nil, fmt.Errorf("Error reading the image file: %v", err)
 	}
+	defer input.Close()
+
 	src, _, err := image.Decode(input)
 	if err != nil {
-		log.Fatalf("Error decoding the image: %v", err)
+		return nil, fmt.Errorf("Error decoding the image: %v", err)
 	}
 
-	if src.Bounds().Dx() > MaxImageSize {
-		resizedImg = resize.Resize(MaxImageSize, 0, src, resize.Lanczos3)
-	} else if src.Bounds().Dy() > MaxImageSize {
-		resizedImg = resize.Resize(0, MaxImageSize, src, resize.Lanczos3)
-	} else {
-		resizedImg = src
+	if src.Bounds().Dx() > maxSize {
+		return resize.Resize(uint(maxSize), 0, src, resize.Lanczos3), nil
+	} else if src.Bounds().Dy() > maxSize {
+		return resize.Resize(0, uint(maxSize), src, resize.Lanczos3), nil
 	}
+	return src, nil
+}
 
-	go func() {
-		var output string
-		precision := float64(process(resizedImg, done))
-		if precision > 50.0 {
-			output = fmt.Sprintf("%.0f%% the image is forged!", precision)
-		} else {
-			precision = 100 - precision
-			output = fmt.Sprintf("%.0f%% the image is NOT forged!", precision)
-		}
-		fmt.Println(output)
-	}()
-	<-done
+// verdict returns the human readable interpretation of the forgery probability, in percent.
+func verdict(probability float64) string {
+	if probability > 50.0 {
+		return fmt.Sprintf("the image is forged (probability %.0f%%)", probability)
+	}
+	return fmt.Sprintf("the image is NOT forged (probability of forgery %.0f%%)", probability)
+}
 
-	fmt.Printf("\nDone in: %.2fs\n", time.Since(start).Seconds())
+// detection is the outcome of the analysis of an image.
+type detection struct {
+	// score is the calibrated probability of a forgery in percent, or the fused score of the detectors (see fuse).
+	score    float64
+	evidence *evidence
+	regions  []region
+	// pairs are the copied regions found by the block matching (dct only).
+	pairs []clonePair
+	mask  *image.Alpha
+	// image is the analyzed image.
+	image image.Image
+	// excluded is the number of low-texture blocks excluded from matching.
+	excluded int
+	// files are the output files written by the analysis.
+	files []string
 }
 
-// process analyze the input image and detect forgeries.
-// It returns the precision score and a boolean value indication
-func process(input image.Image, done chan struct{}) float64 {
+// process analyze the input image, detect forgeries and writes the result into the destination file.
+// It returns the error of the context if the analysis is canceled.
+func process(ctx context.Context, input image.Image, destination string, p *params) (*detection, error) {
 	img := imgToNRGBA(input)
 	output := image.NewRGBA(img.Bounds())
 	draw.Draw(output, image.Rect(0, 0, img.Bounds().Dx(), img.Bounds().Dy()), img, image.ZP, draw.Src)
 
 	// Blur the image to eliminate the details.
-	if *blurRadius > 0 {
-		img = StackBlur(img, uint32(*blurRadius))
-	}
-
-	// Convert image to YUV color space
-	yuv := convertRGBImageToYUV(img)
-	newImg := image.NewRGBA(yuv.Bounds())
-	draw.Draw(newImg, image.Rect(0, 0, yuv.Bounds().Dx(), yuv.Bounds().Dy()), yuv, image.ZP, draw.Src)
-
-	dx, dy := yuv.Bounds().Max.X, yuv.Bounds().Max.Y
-	bdx, bdy := (dx - *blockSize + 1), (dy - *blockSize + 1)
-	n := math.Max(float64(dx), float64(dy))
-
-	var blocks []imageBlock
-	for i := 0; i < bdx; i++ {
-		for j := 0; j < bdy; j++ {
-			r := image.Rect(i, j, i+*blockSize, j+*blockSize)
-			block := newImg.SubImage(r).(*image.RGBA)
-			blocks = append(blocks, imageBlock{x: i, y: j, img: block})
-		}
-	}
-
-	bar := pb.StartNew(len(blocks))
-	bar.Prefix("Generate: ")
-
-	for _, block := range blocks {
-		// Average RGB value.
-		var avr, avg, avb float64
-
-		b := block.img.(*image.RGBA)
-		i0 := b.PixOffset(b.Bounds().Min.X, b.Bounds().Min.Y)
-		i1 := i0 + b.Bounds().Dx()*4
-
-		dctPixels := make(dctPx, *blockSize**blockSize)
-		for u := 0; u < *blockSize; u++ {
-			dctPixels[u] = make([]pixel, *blockSize)
-			for v := 0; v < *blockSize; v++ {
-				for i := i0; i < i1; i += 4 {
-					// Obtain the pixels converted to YUV color space
-					yc, uc, vc, _ := b.Pix[i+0], b.Pix[i+2], b.Pix[i+2], b.Pix[i+3]
-					// Convert YUV to RGB and obtain the R,G,B value
-					r, g, b := color.YCbCrToRGB(yc, uc, vc)
-
-					for x := 0; x < *blockSize; x++ {
-						for y := 0; y < *blockSize; y++ {
-							// Compute Discrete Cosine coefficients
-							cr += dct(float64(x), float64(y), float64(u), float64(v), float64(*blockSize)) * float64(r)
-							cg += dct(float64(x), float64(y), float64(u), float64(v), float64(*blockSize)) * float64(g)
-							cb += dct(float64(x), float64(y), float64(u), float64(v), float64(*blockSize)) * float64(b)
-							cy += dct(float64(x), float64(y), float64(u), float64(v), float64(*blockSize)) * float64(yc)
-
-							avr += float64(r)
-							avg += float64(g)
-							avb += float64(b)
-						}
-					}
-				}
+	if p.BlurRadius > 0 {
+		start := time.Now()
+		img = StackBlur(img, uint32(p.BlurRadius))
+		stats.observeStage("blur", time.Since(start))
+	}
 
-				// Normalize alpha channel.
-				alpha := func(a float64) float64 {
-					if a == 0 {
-						return math.Sqrt(1.0 / float64(n))
-					} else {
-						return math.Sqrt(2.0 / float64(n))
-					}
-				}
+	// precision is the raw score of the detection
+	var precision = 0.0
 
-				cu, cv := float64(u), float64(v)
-				cr *= alpha(cu) * alpha(cv)
-				cg *= alpha(cu) * alpha(cv)
-				cb *= alpha(cu) * alpha(cv)
-				cy *= alpha(cu) * alpha(cv)
+	// The low-texture blocks are excluded from matching.
+	size := p.BlockSize
+	if p.Method == "patchmatch" {
+		size = p.PatchSize
+	}
+	start := time.Now()
+	flat := lowTexture(img, size, p.TextureThreshold)
+	stats.observeStage("texture", time.Since(start))
+	var excluded int
+	for _, f := range flat {
+		if f {
+			excluded++
+		}
+	}
+	if p.verbose && verbosity > 1 && flat != nil {
+		fmt.Printf("\nLow-texture blocks excluded from matching: %d (%.1f%%)\n", excluded, 100*float64(excluded)/math.Max(float64(len(flat)), 1))
+	}
 
-				dctPixels[u][v] = pixel{cr, cg, cb, cy}
+	var (
+		mask      *image.Alpha
+		simBlocks newVector
+		clusters  []shiftCluster
+		patches   []densePatch
+		pairs     []clonePair
+		ev        evidence
+	)
+	switch p.Method {
+	case "patchmatch":
+		start := time.Now()
+		var err error
+		if mask, patches, err = denseDetect(ctx, img, p.PatchSize, p.MinOffset, p.Iterations, flat); err != nil {
+			return nil, err
+		}
+		stats.observeStage("patchmatch", time.Since(start))
+	default:
+		var err error
+		if clusters, simBlocks, err = detectBlocks(ctx, img, p, flat); err != nil {
+			return nil, err
+		}
+		ev.Clusters, ev.Votes = len(clusters), len(simBlocks)
+		for _, c := range clusters {
+			ev.Coherence = math.Max(ev.Coherence, float64(len(c.blocks))/float64(len(simBlocks)))
+		}
 
-				// Obtain the quantized DCT coefficients.
-				if *blockSize <= 4 {
-					dctPixels[u][v].r = dctPixels[u][v].r / q4x4[u][v]
-					dctPixels[u][v].g = dctPixels[u][v].g / q4x4[u][v]
-					dctPixels[u][v].b = dctPixels[u][v].b / q4x4[u][v]
-					dctPixels[u][v].y = dctPixels[u][v].y / q4x4[u][v]
-				}
+		if p.verbose {
+			fmt.Println("\nNumber of shift vector clusters detected: ", len(clusters))
+			for i, c := range clusters {
+				xmin, ymin, xmax, ymax := c.bounds()
+				fmt.Printf("  #%d: transform %s, shift (%.1f, %.1f), %d blocks, source region (%d,%d)-(%d,%d)\n",
+					i+1, c.transform, c.offsetX, c.offsetY, len(c.blocks), xmin, ymin, xmax+p.BlockSize, ymax+p.BlockSize)
 			}
 		}
-		avr /= float64(*blockSize * *blockSize)
-		avg /= float64(*blockSize * *blockSize)
-		avb /= float64(*blockSize * *blockSize)
+		mask = rasterizeBlocks(img.Bounds(), simBlocks, p.BlockSize)
+	}
 
-		features = append(features, feature{x: block.x, y: block.y, coef: dctPixels[0][0].y})
-		features = append(features, feature{x: block.x, y: block.y, coef: dctPixels[0][1].y})
-		features = append(features, feature{x: block.x, y: block.y, coef: dctPixels[1][0].y})
-		features = append(features, feature{x: block.x, y: block.y, coef: dctPixels[0][0].r})
-		features = append(features, feature{x: block.x, y: block.y, coef: dctPixels[0][0].g})
-		features = append(features, feature{x: block.x, y: block.y, coef: dctPixels[0][0].b})
+	start = time.Now()
+	mask, regions := postProcess(mask, p.CloseRadius, p.OpenRadius, p.MinArea)
+	stats.observeStage("filtering", time.Since(start))
+
+	switch p.Method {
+	case "patchmatch":
+		// The forged pixels are the footprints of the consistent patches kept by the post-processing,
+		// and of their matches. The score is based on the fitting residual of these patches.
+		var (
+			kept       []vector
+			confidence float64
+		)
+		for _, d := range patches {
+			if mask.Pix[mask.PixOffset(d.xa+p.PatchSize/2, d.ya+p.PatchSize/2)] != 0 {
+				kept = append(kept, d.vector)
+				confidence += d.confidence()
+			}
+		}
+		if ev.Votes = len(kept); ev.Votes > 0 {
+			ev.Coherence = confidence / float64(ev.Votes)
+			precision = 50 + 50*ev.Coherence
+		}
+		// The regions were already filtered on their area, they are only measured on the footprints.
+		mask = rasterizeBlocks(mask.Bounds(), kept, p.PatchSize)
+		regions = labelRegions(mask, 0)
+	case "dct":
+		// The forged blocks are the suspicious blocks kept by the post-processing.
+		var forgedBlocksNum int
+		for _, bl := range simBlocks {
+			if mask.Pix[mask.PixOffset(bl.xa, bl.ya)] != 0 {
+				forgedBlocksNum++
+			}
+		}
+		if len(simBlocks) > 0 {
+			precision = float64(forgedBlocksNum) / float64(len(simBlocks)) * 100
+		}
+		// The clone pairs are the clusters having blocks kept by the post-processing.
+		for _, c := range clusters {
+			for _, bl := range c.blocks {
+				if mask.Pix[mask.PixOffset(bl.xa, bl.ya)] != 0 {
+					pairs = append(pairs, c.pair(p.BlockSize))
+					break
+				}
+			}
+		}
+		if p.verbose {
+			fmt.Println("Number of forged blocks detected: ", forgedBlocksNum)
+		}
+	}
+	if len(regions) == 0 {
+		precision = 0
+	}
 
-		// Append average R,G,B values to the features vector(slice).
-		features = append(features, feature{x: block.x, y: block.y, coef: avr})
-		features = append(features, feature{x: block.x, y: block.y, coef: avb})
-		features = append(features, feature{x: block.x, y: block.y, coef: avg})
-		bar.Increment()
+	// The probability of a forgery is computed by the calibration model from the evidence.
+	ev.Score, ev.Regions = precision, len(regions)
+	for _, r := range regions {
+		ev.Area += float64(r.area)
+	}
+	ev.Area /= float64(img.Bounds().Dx() * img.Bounds().Dy())
+	p.calibration.apply(&ev)
+
+	if p.verbose {
+		fmt.Println("Number of forged regions detected: ", len(regions))
+		for _, r := range regions {
+			fmt.Printf("  #%d: bounds (%d,%d)-(%d,%d), area %d px, centroid (%.1f, %.1f)\n",
+				r.label, r.bounds.Min.X, r.bounds.Min.Y, r.bounds.Max.X, r.bounds.Max.Y, r.area, r.cx, r.cy)
+		}
 	}
-	bar.Finish()
 
-	// Lexicographically sort the feature vectors
-	sort.Sort(featVec(features))
+	drawOverlay(output, mask, regions, pairs, p)
+	if p.SideBySide {
+		output = sideBySide(input, output)
+	}
+	if err := writePNG(destination, output); err != nil {
+		return nil, err
+	}
+	files := []string{destination}
+
+	if p.debug && flat != nil {
+		// Show the excluded blocks in blue over the original image.
+		debug := image.NewRGBA(img.Bounds())
+		draw.Draw(debug, debug.Bounds(), input, input.Bounds().Min, draw.Src)
+		draw.DrawMask(debug, debug.Bounds(), &image.Uniform{color.RGBA{0, 0, 255, 160}}, image.ZP,
+			blockFootprint(img.Bounds(), flat, size), image.ZP, draw.Over)
+		if err := writePNG(debugName(destination, "excluded"), debug); err != nil {
+			return nil, err
+		}
+		files = append(files, debugName(destination, "excluded"))
+	}
 
-	bar = pb.StartNew(len(features) - 1)
-	bar.Prefix("Analyze: ")
+	return &detection{
+		score:    100 * ev.Probability,
+		evidence: &ev,
+		regions:  regions,
+		pairs:    pairs,
+		mask:     mask,
+		image:    input,
+		excluded: excluded,
+		files:    files,
+	}, nil
+}
 
-	for i := 0; i < len(features)-1; i++ {
-		blockA, blockB := features[i], features[i+1]
-		result := analyzeBlocks(blockA, blockB)
+// writePNG encodes the image into the destination file.
+func writePNG(destination string, img image.Image) error {
+	out, err := os.Create(destination)
+	if err != nil {
+		return fmt.Errorf("Error creating output file: %v", err)
+	}
+	defer out.Close()
 
-		if result != nil {
-			vectors = append(vectors, *result)
-		}
-		bar.Increment()
+	if err := png.Encode(out, img); err != nil {
+		return fmt.Errorf("Error encoding image file: %v", err)
 	}
-	bar.Finish()
+	return nil
+}
 
-	simBlocks := getSuspiciousBlocks(vectors)
-	forgedBlocks, _ := filterOutNeighbors(simBlocks)
+// debugName returns the name of a debug image, written next to the output image.
+func debugName(destination, suffix string) string {
+	return strings.TrimSuffix(destination, filepath.Ext(destination)) + "_" + suffix + ".png"
+}
 
-	simBlocksNum := len(simBlocks)
-	forgedBlocksNum := len(forgedBlocks)
+// detectBlocks runs the block based detection on the image, using the feature extractor of the parameters.
+// The blocks flagged as flat (see lowTexture) are not matched. It returns the shift vector clusters and the suspicious blocks,
+// or the error of the context if it is done before the end of the detection.
+func detectBlocks(ctx context.Context, img *image.NRGBA, p *params, flat []bool) ([]shiftCluster, newVector, error) {
+	extractor := p.extractor
+	start := time.Now()
+	features, err := extractor.extract(ctx, img, p.tracker)
+	if err != nil {
+		return nil, nil, err
+	}
+	stats.observeStage("features", time.Since(start))
+	// The offset threshold scales with the image size, not with the number of textured blocks.
+	blocks := len(features)
+	if flat != nil {
+		bw := img.Bounds().Dx() - p.BlockSize + 1
+		textured := features[:0]
+		for _, f := range features {
+			if !flat[f.y*bw+f.x] {
+				textured = append(textured, f)
+			}
+		}
+		features = textured
+	}
 
-	// precision indicates the detection accuracy
-	var precision = 0.0
-	if forgedBlocksNum > 0 {
-		precision = 100 - (float64(forgedBlocksNum) / (float64(forgedBlocksNum + simBlocksNum)) * 100)
+	// The transformations the features are invariant to are evaluated on the pairs of candidate
+	// found for the translated copies, since the transformed blocks can't be told apart.
+	passes := []transform{identity}
+	var invariant []transform
+	for _, t := range p.transforms {
+		if extractor.invariant(t) {
+			invariant = append(invariant, t)
+		} else {
+			passes = append(passes, t)
+		}
 	}
 
-	forgedImg := image.NewRGBA(img.Bounds())
-	overlay := color.RGBA{255, 0, 0, 255}
+	bar := startProgress(p.tracker, (len(features)-1)*len(passes)+len(features)*(len(passes)-1), "analyze")
 
-	fmt.Println("\nNumber of forged blocks detected: ", forgedBlocksNum)
-	for _, bl := range forgedBlocks {
-		draw.Draw(forgedImg, image.Rect(bl.xa, bl.ya, bl.xa+*blockSize*2, bl.ya+*blockSize*2), &image.Uniform{overlay}, image.ZP, draw.Over)
+	var (
+		vectors           []vector
+		sorting, matching time.Duration
+	)
+	match := func(blockA, blockB feature, t transform) {
+		if result := analyzeBlocks(blockA, blockB, t, p); result != nil {
+			vectors = append(vectors, *result)
+		}
 	}
 
-	final := StackBlur(imgToNRGBA(forgedImg), 10)
-	draw.Draw(output, img.Bounds(), final, image.ZP, draw.Over)
+	for _, t := range passes {
+		// Match the blocks against the transformed version of the other blocks
+		// by sorting the original and the transformed feature vectors together.
+		candidates := features
+		if t != identity {
+			candidates = make([]feature, 0, 2*len(features))
+			candidates = append(candidates, features...)
+			for _, f := range features {
+				coef := extractor.transform(f.coef, t)
+				candidates = append(candidates, feature{
+					x:           f.x,
+					y:           f.y,
+					coef:        coef,
+					key:         coef,
+					transformed: true,
+				})
+			}
+		}
+
+		// Lexicographically sort the feature vectors
+		start := time.Now()
+		sort.Sort(featVec(candidates))
+		sorting += time.Since(start)
+		start = time.Now()
+
+		for i := 0; i < len(candidates)-1; i++ {
+			blockA, blockB := candidates[i], candidates[i+1]
+			if t != identity {
+				// Only an original and a transformed block can form a pair of candidate.
+				if blockA.transformed != blockB.transformed {
+					match(blockA, blockB, t)
+				}
+				if bar.Increment()%checkInterval == 0 && ctx.Err() != nil {
+					return nil, nil, ctx.Err()
+				}
+				continue
+			}
 
-	out, err := os.Create(*destination)
-	if err != nil {
-		fmt.Printf("Error creating output file: %v", err)
+			match(blockA, blockB, identity)
+			for _, it := range invariant {
+				// Either block might be the transformed one.
+				blockA.transformed, blockB.transformed = true, false
+				match(blockA, blockB, it)
+				if !it.involution() {
+					blockA.transformed, blockB.transformed = false, true
+					match(blockA, blockB, it)
+				}
+			}
+			if bar.Increment()%checkInterval == 0 && ctx.Err() != nil {
+				return nil, nil, ctx.Err()
+			}
+		}
+		matching += time.Since(start)
 	}
+	bar.Finish()
+	stats.observeStage("sort", sorting)
+	stats.observeStage("matching", matching)
 
-	if err := png.Encode(out, output); err != nil {
-		fmt.Printf("Error encoding image file: %v", err)
+	threshold := p.OffsetThreshold
+	if threshold == 0 {
+		threshold = voteThreshold(blocks)
 	}
-	done <- struct{}{}
+	if p.verbose && verbosity > 1 {
+		fmt.Printf("\nBlocks: %d, matched: %d, shift vectors: %d, offset threshold: %d\n", blocks, len(features), len(vectors), threshold)
+	}
+	start = time.Now()
+	clusters := getSuspiciousBlocks(vectors, p.ShiftTolerance, threshold, p.tracker)
+	stats.observeStage("voting", time.Since(start))
 
-	return precision
+	var simBlocks newVector
+	for _, c := range clusters {
+		simBlocks = append(simBlocks, c.blocks...)
+	}
+	return clusters, simBlocks, nil
 }
 
-//convertRGBImageToYUV coverts the image from RGB to YUV color space.
+// convertRGBImageToYUV coverts the image from RGB to YUV color space.
 func convertRGBImageToYUV(img image.Image) image.Image {
 	bounds := img.Bounds()
 	dx, dy := bounds.Max.X, bounds.Max.Y
@@ -324,98 +663,73 @@ func convertRGBImageToYUV(img image.Image) image.Image {
 }
 
 // analyzeBlocks checks weather two neighboring blocks are considered almost identical.
-func analyzeBlocks(blockA, blockB feature) *vector {
-	// Compute the euclidean distance between two neighboring blocks.
-	dx := float64(blockA.x) - float64(blockB.x)
-	dy := float64(blockA.y) - float64(blockB.y)
-	dist := math.Sqrt(math.Pow(dx, 2) + math.Pow(dy, 2))
+// The source of the returned vector is the transformed block and the shift vector
+// is computed between the target block and the transformed position of the source block.
+// If the transformation is its own inverse, the blocks can be swapped, so the shift vector
+// is normalized to the larger one (in lexicographic order) of the two possible values.
+// For translated copies this means the shift vector points to the right (or downwards
+// for vertical shifts), while opposite diagonal directions are kept apart.
+func analyzeBlocks(blockA, blockB feature, t transform, p *params) *vector {
+	// Compute the euclidean distance between the feature vectors of two neighboring blocks.
+	var sum float64
+	for i := range blockA.coef {
+		sum += math.Pow(blockA.coef[i]-blockB.coef[i], 2)
+	}
+	if math.Sqrt(sum) >= p.DistanceThreshold {
+		return nil
+	}
 
-	res := &vector{
-		xa:      blockA.x,
-		ya:      blockA.y,
-		xb:      blockB.x,
-		yb:      blockB.y,
-		offsetX: math.Abs(dx),
-		offsetY: math.Abs(dy),
+	// Discard the trivial matches between overlapping or nearby blocks.
+	if math.Sqrt(math.Pow(float64(blockB.x-blockA.x), 2)+math.Pow(float64(blockB.y-blockA.y), 2)) < float64(p.MinOffset) {
+		return nil
 	}
 
-	if dist < *distanceThreshold {
-		return res
+	if blockB.transformed {
+		blockA, blockB = blockB, blockA
+	}
+	tx, ty := t.apply(float64(blockA.x), float64(blockA.y))
+	dx, dy := float64(blockB.x)-tx, float64(blockB.y)-ty
+
+	if t.involution() {
+		// Swapping the blocks results in the -T(dx, dy) shift vector.
+		sx, sy := t.apply(dx, dy)
+		sx, sy = -sx, -sy
+		if sx > dx || (sx == dx && sy > dy) {
+			blockA, blockB = blockB, blockA
+			dx, dy = sx, sy
+		}
 	}
-	return nil
-}
 
-type offset struct {
-	x, y float64
+	return &vector{
+		xa:        blockA.x,
+		ya:        blockA.y,
+		xb:        blockB.x,
+		yb:        blockB.y,
+		offsetX:   dx,
+		offsetY:   dy,
+		transform: t,
+	}
 }
 
 type newVector []vector
 
-// getSuspiciousBlocks analyze pair of candidate and check for
-// similarity by computing the accumulative number of shift vectors.
-func getSuspiciousBlocks(vect []vector) newVector {
-	var suspiciousBlocks newVector
-	//For each pair of candidate compute the accumulative number of the corresponding shift vectors.
-	duplicates := make(map[offset]int)
-
-	bar := pb.StartNew(len(vect)).Prefix("Detect: ")
-
-	for _, v := range vect {
-		// Check for duplicate blocks
-		offsetX := v.offsetX
-		offsetY := v.offsetY
-		offset := &offset{offsetX, offsetY}
-
-		_, exists := duplicates[*offset]
-		if exists {
-			duplicates[*offset]++
-		} else {
-			duplicates[*offset] = 1
-		}
+// getSuspiciousBlocks analyze pair of candidate and check for similarity by clustering
+// the corresponding shift vectors. The clusters having more members than the
+// threshold are considered suspicious and are returned in decreasing order of their size.
+func getSuspiciousBlocks(vect []vector, tolerance float64, threshold int, t *tracker) []shiftCluster {
+	var suspicious []shiftCluster
 
+	bar := startProgress(t, len(vect), "detect")
+	for _, c := range clusterShiftVectors(vect, tolerance, bar.Increment) {
 		// If the accumulative number of corresponding shift vectors is greater than
 		// a predefined threshold, the corresponding regions are marked as suspicious.
-		if duplicates[*offset] > *offsetThreshold {
-			suspiciousBlocks = append(suspiciousBlocks, vector{
-				v.xa, v.ya, v.xb, v.yb, v.offsetX, v.offsetY,
-			})
+		if len(c.blocks) > threshold {
+			suspicious = append(suspicious, c)
 		}
-		bar.Increment()
 	}
 	bar.Finish()
-	return suspiciousBlocks
-}
 
-// filterOutNeighbors filters out the neighboring blocks.
-func filterOutNeighbors(vect []vector) (newVector, bool) {
-	var forgedBlocks newVector
-	var isForged bool
-
-	bar := pb.StartNew(len(vect)).Prefix("Filter: ")
-
-	for i := 1; i < len(vect); i++ {
-		blockA, blockB := vect[i-1], vect[i]
-
-		// Calculate the euclidean distance between both regions.
-		dx := float64(blockA.xa - blockB.xa)
-		dy := float64(blockA.ya - blockB.ya)
-		dist := math.Sqrt(math.Pow(dx, 2) + math.Pow(dy, 2))
-
-		// Evaluate the euclidean distance distance between two regions
-		// and make sure the distance is greater than a predefined threshold.
-		if dist > *forgeryThreshold {
-			forgedBlocks = append(forgedBlocks, vector{
-				blockA.xa, blockA.ya, blockA.xb, blockA.yb, blockA.offsetX, vect[i].offsetY,
-			})
-			// We need to verify if an image is forged only once.
-			if !isForged {
-				isForged = true
-			}
-		}
-		bar.Increment()
-	}
-	bar.Finish()
-	return forgedBlocks, isForged
+	return suspicious
 }
 
 // dct computes the Discrete Cosine Transform.
@@ -443,6 +757,13 @@ func idct(u, v, x, y, w float64) float64 {
 // Implement sorting function on feature vector
 type featVec []feature
 
-func (a featVec) Len() int           { return len(a) }
-func (a featVec) Less(i, j int) bool { return a[i].coef < a[j].coef }
-func (a featVec) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a featVec) Len() int      { return len(a) }
+func (a featVec) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a featVec) Less(i, j int) bool {
+	for k := range a[i].key {
+		if a[i].key[k] != a[j].key[k] {
+			return a[i].key[k] < a[j].key[k]
+		}
+	}
+	return false
+}
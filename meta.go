@@ -0,0 +1,358 @@
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"flag"
+	"fmt"
+	"image"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Metadata flags
+var metaFlags = flag.NewFlagSet("meta", flag.ExitOnError)
+
+// metadata contains the information of an image file relevant to the forensic analysis.
+// Editing software usually leaves traces in the metadata, like the Software tag or
+// a JPEG quality different from the one used by the camera.
+type metadata struct {
+	File     string            `json:"file"`
+	Size     int64             `json:"size"`
+	Modified time.Time         `json:"modified"`
+	Format   string            `json:"format"`
+	Width    int               `json:"width"`
+	Height   int               `json:"height"`
+	Quality  int               `json:"quality,omitempty"`
+	Segments []string          `json:"segments,omitempty"`
+	Tags     map[string]string `json:"tags,omitempty"`
+
+	// luminanceTable is the luminance quantization table of a JPEG image in natural order, or nil.
+	luminanceTable []int
+}
+
+// jpegLuminanceTable is the standard luminance quantization table of the JPEG specification (quality 50).
+var jpegLuminanceTable = [64]float64{
+	16, 11, 10, 16, 24, 40, 51, 61,
+	12, 12, 14, 19, 26, 58, 60, 55,
+	14, 13, 16, 24, 40, 57, 69, 56,
+	14, 17, 22, 29, 51, 87, 80, 62,
+	18, 22, 37, 56, 68, 109, 103, 77,
+	24, 35, 55, 64, 81, 104, 113, 92,
+	49, 64, 78, 87, 103, 121, 120, 101,
+	72, 92, 95, 98, 112, 100, 103, 99,
+}
+
+// jpegZigzag maps the zigzag order of the JPEG quantization tables to the natural order.
+var jpegZigzag = [64]int{
+	0, 1, 8, 16, 9, 2, 3, 10,
+	17, 24, 32, 25, 18, 11, 4, 5,
+	12, 19, 26, 33, 40, 48, 41, 34,
+	27, 20, 13, 6, 7, 14, 21, 28,
+	35, 42, 49, 56, 57, 50, 43, 36,
+	29, 22, 15, 23, 30, 37, 44, 51,
+	58, 59, 52, 45, 38, 31, 39, 46,
+	53, 60, 61, 54, 47, 55, 62, 63,
+}
+
+// exifTags are the textual EXIF tags reported by the meta command.
+var exifTags = map[uint16]string{
+	0x010f: "Make",
+	0x0110: "Model",
+	0x0131: "Software",
+	0x0132: "DateTime",
+	0x013b: "Artist",
+	0x9003: "DateTimeOriginal",
+	0x9004: "DateTimeDigitized",
+}
+
+// exifIFDPointer is the tag of the offset of the EXIF specific IFD.
+const exifIFDPointer = 0x8769
+
+// readMetadata reads the metadata of the image file.
+func readMetadata(path string) (*metadata, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading the image file: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading the image file: %v", err)
+	}
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("Error decoding the image: %v", err)
+	}
+
+	meta := &metadata{
+		File:     path,
+		Size:     fi.Size(),
+		Modified: fi.ModTime(),
+		Format:   format,
+		Width:    cfg.Width,
+		Height:   cfg.Height,
+		Tags:     make(map[string]string),
+	}
+	switch format {
+	case "jpeg":
+		meta.readJPEG(data)
+	case "png":
+		meta.readPNG(data)
+	}
+	meta.Segments = compactSegments(meta.Segments)
+	return meta, nil
+}
+
+// compactSegments merges the consecutive segments of the same kind, like the PNG data chunks.
+func compactSegments(names []string) []string {
+	var res []string
+	for i := 0; i < len(names); {
+		j := i + 1
+		for j < len(names) && names[j] == names[i] {
+			j++
+		}
+		if j-i > 1 {
+			res = append(res, fmt.Sprintf("%s x%d", names[i], j-i))
+		} else {
+			res = append(res, names[i])
+		}
+		i = j
+	}
+	return res
+}
+
+// readJPEG walks through the JPEG markers until the start of the compressed data.
+func (m *metadata) readJPEG(data []byte) {
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xff {
+			return
+		}
+		marker := data[i+1]
+		if marker == 0xff {
+			// Fill byte.
+			i++
+			continue
+		}
+		if marker == 0x01 || (marker >= 0xd0 && marker <= 0xd7) {
+			// Markers without payload.
+			i += 2
+			continue
+		}
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		if length < 2 || i+2+length > len(data) {
+			return
+		}
+		payload := data[i+4 : i+2+length]
+
+		switch {
+		case marker >= 0xe0 && marker <= 0xef:
+			name := fmt.Sprintf("APP%d", marker-0xe0)
+			id := payload
+			if n := bytes.IndexByte(id, 0); n >= 0 {
+				id = id[:n]
+			}
+			switch {
+			case bytes.HasPrefix(payload, []byte("Exif\x00\x00")):
+				m.readExif(payload[6:])
+			case bytes.HasPrefix(payload, []byte("http://ns.adobe.com/xap/")):
+				id = []byte("XMP")
+				m.Tags["XMP"] = "present"
+			case bytes.HasPrefix(payload, []byte("Photoshop")):
+				m.Tags["Photoshop"] = "present"
+			}
+			if len(id) > 0 && len(id) <= 16 {
+				name += " " + string(id)
+			}
+			m.Segments = append(m.Segments, name)
+		case marker == 0xdb:
+			m.readQuantizationTables(payload)
+			m.Segments = append(m.Segments, "DQT")
+		case marker == 0xfe:
+			m.Tags["Comment"] = strings.TrimRight(string(payload), "\x00")
+			m.Segments = append(m.Segments, "COM")
+		case marker == 0xc4:
+			m.Segments = append(m.Segments, "DHT")
+		case marker == 0xdd:
+			m.Segments = append(m.Segments, "DRI")
+		case marker >= 0xc0 && marker <= 0xcf:
+			m.Segments = append(m.Segments, fmt.Sprintf("SOF%d", marker-0xc0))
+		case marker == 0xda:
+			m.Segments = append(m.Segments, "SOS")
+			return
+		default:
+			m.Segments = append(m.Segments, fmt.Sprintf("0x%02X", marker))
+		}
+		i += 2 + length
+	}
+}
+
+// readQuantizationTables keeps the luminance quantization table and estimates the JPEG quality from it,
+// by comparing it with the standard table scaled as done by the IJG library.
+func (m *metadata) readQuantizationTables(payload []byte) {
+	for len(payload) > 0 {
+		precision, id := payload[0]>>4, payload[0]&0x0f
+		size := 64
+		if precision != 0 {
+			size = 128
+		}
+		if len(payload) < 1+size {
+			return
+		}
+		if id == 0 {
+			m.luminanceTable = make([]int, 64)
+			var sum, std float64
+			for k := 0; k < 64; k++ {
+				q := int(payload[1+k])
+				if precision != 0 {
+					q = int(binary.BigEndian.Uint16(payload[1+2*k:]))
+				}
+				m.luminanceTable[jpegZigzag[k]] = q
+				sum += float64(q)
+				std += jpegLuminanceTable[k]
+			}
+			scale := sum / std * 100
+			if scale <= 100 {
+				m.Quality = int(math.Round((200 - scale) / 2))
+			} else {
+				m.Quality = int(math.Round(5000 / scale))
+			}
+			if m.Quality < 1 {
+				m.Quality = 1
+			}
+		}
+		payload = payload[1+size:]
+	}
+}
+
+// readExif reads the textual tags of the main and the EXIF IFDs of the TIFF structure.
+func (m *metadata) readExif(tiff []byte) {
+	if len(tiff) < 8 {
+		return
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return
+	}
+
+	var readIFD func(offset uint32, depth int)
+	readIFD = func(offset uint32, depth int) {
+		if depth > 1 || int(offset)+2 > len(tiff) {
+			return
+		}
+		count := int(order.Uint16(tiff[offset:]))
+		for e := 0; e < count; e++ {
+			pos := int(offset) + 2 + 12*e
+			if pos+12 > len(tiff) {
+				return
+			}
+			tag, typ := order.Uint16(tiff[pos:]), order.Uint16(tiff[pos+2:])
+			n, value := order.Uint32(tiff[pos+4:]), order.Uint32(tiff[pos+8:])
+
+			if tag == exifIFDPointer {
+				readIFD(value, depth+1)
+				continue
+			}
+			name, ok := exifTags[tag]
+			if !ok || typ != 2 {
+				continue
+			}
+			// ASCII values up to 4 bytes are stored in the entry itself.
+			start := pos + 8
+			if n > 4 {
+				start = int(value)
+			}
+			if start+int(n) > len(tiff) || start+int(n) < start {
+				continue
+			}
+			if s := strings.TrimSpace(strings.TrimRight(string(tiff[start:start+int(n)]), "\x00")); s != "" {
+				m.Tags[name] = s
+			}
+		}
+	}
+	readIFD(order.Uint32(tiff[4:]), 0)
+}
+
+// readPNG walks through the PNG chunks and reads the textual ones.
+func (m *metadata) readPNG(data []byte) {
+	for i := 8; i+12 <= len(data); {
+		length := int(binary.BigEndian.Uint32(data[i:]))
+		name := string(data[i+4 : i+8])
+		if length < 0 || i+12+length > len(data) {
+			return
+		}
+		chunk := data[i+8 : i+8+length]
+		m.Segments = append(m.Segments, name)
+
+		switch name {
+		case "tEXt":
+			if kv := bytes.SplitN(chunk, []byte{0}, 2); len(kv) == 2 {
+				m.Tags[string(kv[0])] = string(kv[1])
+			}
+		case "zTXt":
+			if kv := bytes.SplitN(chunk, []byte{0}, 2); len(kv) == 2 && len(kv[1]) > 0 {
+				if r, err := zlib.NewReader(bytes.NewReader(kv[1][1:])); err == nil {
+					if text, err := io.ReadAll(r); err == nil {
+						m.Tags[string(kv[0])] = string(text)
+					}
+				}
+			}
+		case "iTXt":
+			// keyword, compression flag and method, language tag, translated keyword, text
+			if kv := bytes.SplitN(chunk, []byte{0}, 2); len(kv) == 2 && len(kv[1]) > 2 && kv[1][0] == 0 {
+				if parts := bytes.SplitN(kv[1][2:], []byte{0}, 3); len(parts) == 3 {
+					m.Tags[string(kv[0])] = string(parts[2])
+				}
+			}
+		case "tIME":
+			if len(chunk) == 7 {
+				m.Tags["LastModification"] = fmt.Sprintf("%04d-%02d-%02d %02d:%02d:%02d",
+					binary.BigEndian.Uint16(chunk), chunk[2], chunk[3], chunk[4], chunk[5], chunk[6])
+			}
+		case "IEND":
+			return
+		}
+		i += 12 + length
+	}
+}
+
+// runMeta prints the metadata of the image given as argument.
+func runMeta(args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+	meta, err := readMetadata(args[0])
+	if err != nil {
+		return err
+	}
+	if outputFormat == "json" {
+		return printJSON(meta)
+	}
+
+	fmt.Printf("File: %s\nSize: %d bytes\nModified: %s\nFormat: %s\nDimensions: %dx%d\n",
+		meta.File, meta.Size, meta.Modified.Format(time.RFC3339), meta.Format, meta.Width, meta.Height)
+	if meta.Quality > 0 {
+		fmt.Printf("Estimated JPEG quality: %d\n", meta.Quality)
+	}
+	if interactive && len(meta.Segments) > 0 {
+		fmt.Printf("Segments: %s\n", strings.Join(meta.Segments, ", "))
+	}
+	keys := make([]string, 0, len(meta.Tags))
+	for k := range meta.Tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Printf("%s: %s\n", k, meta.Tags[k])
+	}
+	return nil
+}
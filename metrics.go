@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// stageBuckets are the upper bounds in seconds of the stage duration histograms.
+	stageBuckets = []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+	// scoreBuckets are the upper bounds of the score histogram.
+	scoreBuckets = []float64{10, 20, 30, 40, 50, 60, 70, 80, 90, 100}
+)
+
+// histogram is a Prometheus histogram having cumulative buckets.
+type histogram struct {
+	bounds []float64
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+func newHistogram(bounds []float64) *histogram {
+	return &histogram{bounds: bounds, counts: make([]uint64, len(bounds))}
+}
+
+func (h *histogram) observe(v float64) {
+	for i, b := range h.bounds {
+		if v <= b {
+			h.counts[i]++
+		}
+	}
+	h.sum += v
+	h.count++
+}
+
+// write writes the series of the histogram in the Prometheus text format.
+func (h *histogram) write(w io.Writer, name, labels string) {
+	sep := ""
+	if labels != "" {
+		sep = ","
+	}
+	for i, b := range h.bounds {
+		fmt.Fprintf(w, "%s_bucket{%s%sle=\"%g\"} %d\n", name, labels, sep, b, h.counts[i])
+	}
+	fmt.Fprintf(w, "%s_bucket{%s%sle=\"+Inf\"} %d\n", name, labels, sep, h.count)
+	if labels != "" {
+		labels = "{" + labels + "}"
+	}
+	fmt.Fprintf(w, "%s_sum%s %g\n", name, labels, h.sum)
+	fmt.Fprintf(w, "%s_count%s %d\n", name, labels, h.count)
+}
+
+// metrics collects the statistics of the analyses, exported in the Prometheus text format.
+type metrics struct {
+	mu       sync.Mutex
+	stages   map[string]*histogram
+	images   map[string]uint64
+	failures map[string]uint64
+	scores   *histogram
+}
+
+// stats are the metrics of the current process.
+var stats = &metrics{
+	stages:   make(map[string]*histogram),
+	images:   make(map[string]uint64),
+	failures: make(map[string]uint64),
+	scores:   newHistogram(scoreBuckets),
+}
+
+// observeStage records the duration of an analysis stage.
+func (m *metrics) observeStage(stage string, d time.Duration) {
+	m.mu.Lock()
+	h, ok := m.stages[stage]
+	if !ok {
+		h = newHistogram(stageBuckets)
+		m.stages[stage] = h
+	}
+	h.observe(d.Seconds())
+	m.mu.Unlock()
+	logger.Debug("stage finished", "stage", stage, "duration", d.Seconds())
+}
+
+// observeImage records the outcome of the analysis of an image.
+func (m *metrics) observeImage(e batchEntry) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.images[e.Status]++
+	if e.Status == "ok" {
+		m.scores.observe(e.Score)
+	} else {
+		m.failures[e.reason]++
+	}
+}
+
+// write writes the metrics in the Prometheus text format.
+func (m *metrics) write(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	fmt.Fprintln(w, "# HELP forensic_images_processed_total Number of images analyzed, by status.")
+	fmt.Fprintln(w, "# TYPE forensic_images_processed_total counter")
+	for _, k := range sortedKeys(m.images) {
+		fmt.Fprintf(w, "forensic_images_processed_total{status=%q} %d\n", k, m.images[k])
+	}
+
+	fmt.Fprintln(w, "# HELP forensic_failures_total Number of failed analyses, by reason.")
+	fmt.Fprintln(w, "# TYPE forensic_failures_total counter")
+	for _, k := range sortedKeys(m.failures) {
+		fmt.Fprintf(w, "forensic_failures_total{reason=%q} %d\n", k, m.failures[k])
+	}
+
+	fmt.Fprintln(w, "# HELP forensic_score Forgery score of the analyzed images.")
+	fmt.Fprintln(w, "# TYPE forensic_score histogram")
+	m.scores.write(w, "forensic_score", "")
+
+	fmt.Fprintln(w, "# HELP forensic_stage_duration_seconds Duration of the analysis stages.")
+	fmt.Fprintln(w, "# TYPE forensic_stage_duration_seconds histogram")
+	stages := make([]string, 0, len(m.stages))
+	for k := range m.stages {
+		stages = append(stages, k)
+	}
+	sort.Strings(stages)
+	for _, k := range stages {
+		m.stages[k].write(w, "forensic_stage_duration_seconds", fmt.Sprintf("stage=%q", k))
+	}
+}
+
+// writeFile writes the metrics into the file, in the format of the textfile collector of the node exporter.
+// The file is replaced atomically, so that the collector never reads a partial file.
+func (m *metrics) writeFile(path string) error {
+	var b strings.Builder
+	m.write(&b)
+	if err := os.WriteFile(path+".tmp", []byte(b.String()), 0644); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// sortedKeys returns the keys of the counters in increasing order.
+func sortedKeys(counters map[string]uint64) []string {
+	keys := make([]string, 0, len(counters))
+	for k := range counters {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
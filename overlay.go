@@ -0,0 +1,194 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"strconv"
+)
+
+// overlayStyles are the renderings of the detection onto the output image:
+//   - heatmap: the forged regions filled in red and blurred;
+//   - boxes: the bounding boxes of the source (dashed) and target (solid) regions of each clone pair;
+//   - outline: the contour of the forged regions.
+//
+// The boxes and outline styles draw each clone pair in its own color, with an arrow along the shift
+// vector and the number of the pair, as in the HTML report.
+var overlayStyles = []string{"heatmap", "boxes", "outline"}
+
+// pairColors are the colors of the clone pairs, cycled in the order of the clusters.
+var pairColors = []color.RGBA{
+	{230, 25, 75, 255},
+	{60, 180, 75, 255},
+	{0, 130, 200, 255},
+	{245, 130, 48, 255},
+	{145, 30, 180, 255},
+	{70, 240, 240, 255},
+	{240, 50, 230, 255},
+	{210, 245, 60, 255},
+}
+
+// canvas draws the shapes of the overlay onto an image, blending the colors with the given opacity.
+type canvas struct {
+	img     *image.RGBA
+	opacity float64
+}
+
+// set blends the color into the pixel, if it is inside the image.
+func (c *canvas) set(x, y int, col color.RGBA) {
+	if !image.Pt(x, y).In(c.img.Bounds()) {
+		return
+	}
+	i := c.img.PixOffset(x, y)
+	a := c.opacity * float64(col.A) / 255
+	for k, v := range []uint8{col.R, col.G, col.B} {
+		c.img.Pix[i+k] = uint8(math.Round(float64(c.img.Pix[i+k])*(1-a) + float64(v)*a))
+	}
+}
+
+// fill paints the rectangle.
+func (c *canvas) fill(r image.Rectangle, col color.RGBA) {
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			c.set(x, y, col)
+		}
+	}
+}
+
+// line draws a segment with a width of two pixels, skipping the gaps if dashed.
+func (c *canvas) line(x0, y0, x1, y1 float64, col color.RGBA, dashed bool) {
+	n := int(math.Max(math.Abs(x1-x0), math.Abs(y1-y0))) + 1
+	drawn := make(map[image.Point]bool)
+	for i := 0; i <= n; i++ {
+		if dashed && (i/4)%2 == 1 {
+			continue
+		}
+		t := float64(i) / float64(n)
+		x, y := int(math.Round(x0+t*(x1-x0))), int(math.Round(y0+t*(y1-y0)))
+		// The pixels shared by consecutive points are blended only once.
+		for _, p := range []image.Point{{x, y}, {x + 1, y}, {x, y + 1}, {x + 1, y + 1}} {
+			if !drawn[p] {
+				drawn[p] = true
+				c.set(p.X, p.Y, col)
+			}
+		}
+	}
+}
+
+// rect draws the outline of the rectangle.
+func (c *canvas) rect(r image.Rectangle, col color.RGBA, dashed bool) {
+	x0, y0, x1, y1 := float64(r.Min.X), float64(r.Min.Y), float64(r.Max.X-2), float64(r.Max.Y-2)
+	c.line(x0, y0, x1, y0, col, dashed)
+	c.line(x1, y0, x1, y1, col, dashed)
+	c.line(x1, y1, x0, y1, col, dashed)
+	c.line(x0, y1, x0, y0, col, dashed)
+}
+
+// arrow draws a segment ending with an arrowhead.
+func (c *canvas) arrow(x0, y0, x1, y1 float64, col color.RGBA) {
+	c.line(x0, y0, x1, y1, col, false)
+	angle := math.Atan2(y1-y0, x1-x0)
+	for _, a := range []float64{angle + math.Pi*5/6, angle - math.Pi*5/6} {
+		c.line(x1, y1, x1+7*math.Cos(a), y1+7*math.Sin(a), col, false)
+	}
+}
+
+// label writes the number in white on a box of the given color, with its upper left corner at (x, y).
+func (c *canvas) label(x, y int, n int, col color.RGBA) {
+	s := strconv.Itoa(n)
+	c.fill(image.Rect(x, y, x+8*len(s)+2, y+14), col)
+	for _, r := range s {
+		for gy, row := range digitGlyphs[r] {
+			for gx, on := range row {
+				if on == '1' {
+					c.fill(image.Rect(x+2+2*gx, y+2+2*gy, x+4+2*gx, y+4+2*gy), color.RGBA{255, 255, 255, 255})
+				}
+			}
+		}
+		x += 8
+	}
+}
+
+// drawOverlay renders the detection onto the output image, in the style and with the opacity of the parameters.
+// The clone pairs are numbered starting from 1 and colored with pairColors.
+func drawOverlay(output *image.RGBA, mask *image.Alpha, regions []region, pairs []clonePair, p *params) {
+	b := output.Bounds()
+	if p.Overlay == "heatmap" {
+		forgedImg := image.NewRGBA(b)
+		draw.DrawMask(forgedImg, b, &image.Uniform{color.RGBA{255, 0, 0, 255}}, image.ZP, mask, image.ZP, draw.Over)
+		final := StackBlur(imgToNRGBA(forgedImg), 10)
+		opacity := &image.Uniform{color.Alpha{uint8(math.Round(255 * p.Opacity))}}
+		draw.DrawMask(output, b, final, image.ZP, opacity, image.ZP, draw.Over)
+		return
+	}
+
+	c := &canvas{img: output, opacity: p.Opacity}
+	red := color.RGBA{255, 0, 0, 255}
+	colorAt := func(x, y int) color.RGBA {
+		for i, pair := range pairs {
+			pt := image.Pt(x, y)
+			if pt.In(pair.source) || pt.In(pair.target) {
+				return pairColors[i%len(pairColors)]
+			}
+		}
+		return red
+	}
+
+	switch p.Overlay {
+	case "boxes":
+		if len(pairs) == 0 {
+			// The dense detection finds the regions without pairing them.
+			for _, r := range regions {
+				c.rect(r.bounds, red, false)
+			}
+		}
+		for i, pair := range pairs {
+			col := pairColors[i%len(pairColors)]
+			c.rect(pair.source, col, true)
+			c.rect(pair.target, col, false)
+		}
+	case "outline":
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				if mask.AlphaAt(x, y).A == 0 {
+					continue
+				}
+				// The contour pixels have a neighbor outside of the mask.
+				for _, n := range []image.Point{{x - 1, y}, {x + 1, y}, {x, y - 1}, {x, y + 1}} {
+					if !n.In(b) || mask.AlphaAt(n.X, n.Y).A == 0 {
+						c.set(x, y, colorAt(x, y))
+						break
+					}
+				}
+			}
+		}
+	}
+
+	for i, pair := range pairs {
+		col := pairColors[i%len(pairColors)]
+		sx, sy := float64(pair.source.Min.X+pair.source.Max.X)/2, float64(pair.source.Min.Y+pair.source.Max.Y)/2
+		tx, ty := float64(pair.target.Min.X+pair.target.Max.X)/2, float64(pair.target.Min.Y+pair.target.Max.Y)/2
+		c.arrow(sx, sy, tx, ty, col)
+	}
+	// The labels are drawn last, to be readable.
+	for i, pair := range pairs {
+		col := pairColors[i%len(pairColors)]
+		c.label(pair.source.Min.X, pair.source.Min.Y, i+1, col)
+		c.label(pair.target.Min.X, pair.target.Min.Y, i+1, col)
+	}
+	if len(pairs) == 0 {
+		for _, r := range regions {
+			c.label(r.bounds.Min.X, r.bounds.Min.Y, r.label, red)
+		}
+	}
+}
+
+// sideBySide returns the original image on the left of the overlay.
+func sideBySide(original image.Image, overlay *image.RGBA) *image.RGBA {
+	b := overlay.Bounds()
+	res := image.NewRGBA(image.Rect(0, 0, 2*b.Dx(), b.Dy()))
+	draw.Draw(res, b, original, original.Bounds().Min, draw.Src)
+	draw.Draw(res, b.Add(image.Pt(b.Dx(), 0)), overlay, b.Min, draw.Src)
+	return res
+}
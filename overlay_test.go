@@ -0,0 +1,90 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+)
+
+// overlayFixture returns a textured output image, and the mask and the clone pairs of two copies
+// 50 pixels to the right.
+func overlayFixture() (*image.RGBA, *image.Alpha, []clonePair) {
+	output := image.NewRGBA(image.Rect(0, 0, 100, 80))
+	draw.Draw(output, output.Bounds(), texturedImage(100, 80, 1), image.ZP, draw.Src)
+	pairs := []clonePair{
+		{source: image.Rect(10, 10, 30, 30), target: image.Rect(60, 10, 80, 30), blocks: 4},
+		{source: image.Rect(10, 45, 30, 65), target: image.Rect(60, 45, 80, 65), blocks: 4},
+	}
+	mask := image.NewAlpha(output.Bounds())
+	for _, p := range pairs {
+		draw.Draw(mask, p.source, image.Opaque, image.ZP, draw.Src)
+		draw.Draw(mask, p.target, image.Opaque, image.ZP, draw.Src)
+	}
+	return output, mask, pairs
+}
+
+func TestDrawOverlay(t *testing.T) {
+	for _, style := range []string{"boxes", "outline"} {
+		output, mask, pairs := overlayFixture()
+		original := image.NewRGBA(output.Bounds())
+		copy(original.Pix, output.Pix)
+		p := defaultParams()
+		p.Overlay, p.Opacity = style, 1
+		drawOverlay(output, mask, nil, pairs, p)
+
+		for i, pair := range pairs {
+			for _, r := range []image.Rectangle{pair.source, pair.target} {
+				// The right edge, away from the label and the arrow.
+				edge := image.Pt(r.Max.X-1, r.Min.Y+2)
+				if c := output.RGBAAt(edge.X, edge.Y); c != pairColors[i] {
+					t.Errorf("%s: the pixel %v of the pair %d is %v, want %v", style, edge, i+1, c, pairColors[i])
+				}
+				inside := image.Pt(r.Min.X+15, r.Min.Y+15)
+				if c, want := output.RGBAAt(inside.X, inside.Y), original.RGBAAt(inside.X, inside.Y); c != want {
+					t.Errorf("%s: the pixel %v inside the pair %d is %v, want %v", style, inside, i+1, c, want)
+				}
+			}
+		}
+	}
+}
+
+func TestDrawOverlayTransparent(t *testing.T) {
+	for _, style := range overlayStyles {
+		output, mask, pairs := overlayFixture()
+		original := image.NewRGBA(output.Bounds())
+		copy(original.Pix, output.Pix)
+		p := defaultParams()
+		p.Overlay, p.Opacity = style, 0
+		drawOverlay(output, mask, nil, pairs, p)
+		for i := range output.Pix {
+			if output.Pix[i] != original.Pix[i] {
+				t.Errorf("%s: the overlay with an opacity of 0 changes the image", style)
+				break
+			}
+		}
+	}
+}
+
+func TestSideBySide(t *testing.T) {
+	original := texturedImage(100, 80, 1)
+	overlay, mask, pairs := overlayFixture()
+	p := defaultParams()
+	p.Overlay = "boxes"
+	drawOverlay(overlay, mask, nil, pairs, p)
+
+	res := sideBySide(original, overlay)
+	if b := res.Bounds(); b != image.Rect(0, 0, 200, 80) {
+		t.Fatalf("the bounds are %v, want %v", b, image.Rect(0, 0, 200, 80))
+	}
+	for y := 0; y < 80; y++ {
+		for x := 0; x < 100; x++ {
+			if c, want := res.RGBAAt(x, y), color.RGBAModel.Convert(original.At(x, y)); c != want {
+				t.Fatalf("the pixel (%d,%d) is %v, want the original %v", x, y, c, want)
+			}
+			if c, want := res.RGBAAt(x+100, y), overlay.RGBAAt(x, y); c != want {
+				t.Fatalf("the pixel (%d,%d) is %v, want the overlay %v", x+100, y, c, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,609 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// params contains the parameters of the forgery detection. The parameters are identified
+// by their flag name, both on the command line and in the configuration files.
+type params struct {
+	MaxSize           int     `json:"size"`
+	BlurRadius        int     `json:"blur"`
+	BlockSize         int     `json:"bs"`
+	OffsetThreshold   int     `json:"ot"`
+	ShiftTolerance    float64 `json:"st"`
+	Transforms        string  `json:"tr"`
+	DistanceThreshold float64 `json:"dt"`
+	MinArea           int     `json:"minarea"`
+	CloseRadius       int     `json:"cr"`
+	OpenRadius        int     `json:"or"`
+	Method            string  `json:"method"`
+	Features          string  `json:"fe"`
+	PatchSize         int     `json:"ps"`
+	MinOffset         int     `json:"md"`
+	Iterations        int     `json:"pi"`
+	TextureThreshold  float64 `json:"tt"`
+	Auto              bool    `json:"auto"`
+	Calibration       string  `json:"calibration,omitempty"`
+	Fuse              string  `json:"fuse,omitempty"`
+	Fusion            string  `json:"fusion"`
+	Overlay           string  `json:"overlay"`
+	Opacity           float64 `json:"opacity"`
+	SideBySide        bool    `json:"side-by-side"`
+
+	// Preset and File record where the values come from.
+	Preset string `json:"preset,omitempty"`
+	File   string `json:"file,omitempty"`
+
+	transforms  []transform
+	extractor   featureExtractor
+	calibration *calibration
+	detectors   []detectorWeight
+	// fixed contains the parameters set by a preset, a configuration file or on the command line.
+	fixed map[string]bool
+	// analysisOptions are the settings of the current analysis (see analyzeFile).
+	analysisOptions
+}
+
+// defaultParams returns the default detection parameters.
+func defaultParams() *params {
+	return &params{
+		MaxSize:           MaxImageSize,
+		BlurRadius:        1,
+		BlockSize:         4,
+		ShiftTolerance:    2,
+		Transforms:        "hflip,vflip,rot90,rot180",
+		DistanceThreshold: 0.4,
+		MinArea:           210,
+		CloseRadius:       2,
+		OpenRadius:        1,
+		Method:            "dct",
+		Features:          "dct",
+		PatchSize:         8,
+		MinOffset:         16,
+		Iterations:        5,
+		TextureThreshold:  1,
+		Fusion:            "weighted",
+		Overlay:           "heatmap",
+		Opacity:           1,
+	}
+}
+
+// presets are the named parameter sets. The parameters not listed keep their default value.
+var presets = map[string]map[string]string{
+	// balanced is the default trade-off between false positives and missed forgeries.
+	"balanced": {},
+	// strict reports only the large and closely matching copies, to reduce the false positives.
+	"strict": {"dt": "0.25", "minarea": "400", "md": "24"},
+	// sensitive reports also the small copies, at the cost of more false positives.
+	"sensitive": {"dt": "0.6", "minarea": "100", "md": "12", "cr": "3"},
+	// high-res analyzes the images at a higher resolution, with larger blocks.
+	"high-res": {"size": "640", "bs": "8", "minarea": "800", "md": "32", "blur": "2"},
+}
+
+// configNames are the configuration files looked up in the directory of the images and in its parents.
+var configNames = []string{".forensic.yaml", ".forensic.yml", ".forensic.json", ".forensic.toml"}
+
+// register binds the parameters to the flags of the flag set, using their current values as default.
+func (p *params) register(fs *flag.FlagSet) {
+	fs.IntVar(&p.MaxSize, "size", p.MaxSize, "Maximum width or height the image is resized to")
+	fs.IntVar(&p.BlurRadius, "blur", p.BlurRadius, "Blur radius")
+	fs.IntVar(&p.BlockSize, "bs", p.BlockSize, "Block size")
+	fs.IntVar(&p.OffsetThreshold, "ot", p.OffsetThreshold, "Offset threshold (0 scales it with the image size)")
+	fs.Float64Var(&p.ShiftTolerance, "st", p.ShiftTolerance, "Shift vector clustering tolerance")
+	fs.StringVar(&p.Transforms, "tr", p.Transforms, "Block transforms to match besides translation: hflip, vflip, rot90, rot180")
+	fs.Float64Var(&p.DistanceThreshold, "dt", p.DistanceThreshold, "Distance threshold")
+	fs.IntVar(&p.MinArea, "minarea", p.MinArea, "Minimum area of a forged region, in pixels")
+	fs.Var(&deprecatedValue{name: "ft", target: fs.Lookup("minarea").Value}, "ft", "Deprecated: use -minarea")
+	fs.IntVar(&p.CloseRadius, "cr", p.CloseRadius, "Morphological closing radius of the detection mask")
+	fs.IntVar(&p.OpenRadius, "or", p.OpenRadius, "Morphological opening radius of the detection mask")
+	fs.StringVar(&p.Method, "method", p.Method, "Detection method: dct, patchmatch")
+	fs.StringVar(&p.Features, "fe", p.Features, "Block feature extractor: dct, fmt (Fourier-Mellin)")
+	fs.IntVar(&p.PatchSize, "ps", p.PatchSize, "Patch size (patchmatch)")
+	fs.IntVar(&p.MinOffset, "md", p.MinOffset, "Minimum offset distance between matched blocks")
+	fs.IntVar(&p.Iterations, "pi", p.Iterations, "Number of PatchMatch iterations (patchmatch)")
+	fs.Float64Var(&p.TextureThreshold, "tt", p.TextureThreshold, "Texture threshold: the blocks with a lower luminance deviation are not matched (0 disables)")
+	fs.BoolVar(&p.Auto, "auto", p.Auto, "Derive the parameters not set by the user from the image content")
+	fs.StringVar(&p.Calibration, "calibration", p.Calibration, "Calibration file of the forgery probability (built-in model if empty)")
+	fs.StringVar(&p.Fuse, "fuse", p.Fuse, "Detectors fused into the verdict, with their weights: copymove, ela, noise, dq, meta (e.g. copymove=1,ela=0.5; copy-move only if empty)")
+	fs.StringVar(&p.Fusion, "fusion", p.Fusion, "Fusion rule of the detectors: weighted (mean), max, calibration (learned by the calibration)")
+	fs.StringVar(&p.Overlay, "overlay", p.Overlay, "Overlay style of the output image: heatmap, boxes, outline")
+	fs.Float64Var(&p.Opacity, "opacity", p.Opacity, "Opacity of the overlay, between 0 and 1")
+	fs.BoolVar(&p.SideBySide, "side-by-side", p.SideBySide, "Write the original image on the left of the overlay into the output image")
+}
+
+// deprecated maps the deprecated parameters to the parameters replacing them.
+var deprecated = map[string]string{
+	// ft was the minimum distance between the neighbouring suspicious blocks of the original
+	// detection. That filtering is done by the post-processing, on the area of the regions.
+	"ft": "minarea",
+}
+
+// paramName returns the name of the parameter, resolving the deprecated names.
+func paramName(name string) string {
+	if n, ok := deprecated[name]; ok {
+		return n
+	}
+	return name
+}
+
+// deprecatedValue is the flag value of a deprecated parameter, which sets the parameter replacing it.
+type deprecatedValue struct {
+	name   string
+	target flag.Value
+}
+
+func (v *deprecatedValue) String() string {
+	if v.target == nil {
+		return ""
+	}
+	return v.target.String()
+}
+
+func (v *deprecatedValue) Set(value string) error {
+	logger.Warn(fmt.Sprintf("the %s parameter is deprecated, use %s instead", v.name, paramName(v.name)))
+	// The deprecated values might be decimal.
+	if f, err := strconv.ParseFloat(value, 64); err == nil {
+		value = strconv.Itoa(int(math.Round(f)))
+	}
+	return v.target.Set(value)
+}
+
+// set assigns the value of the parameter having the given flag name.
+func (p *params) set(name, value string) error {
+	fs := flag.NewFlagSet("params", flag.ContinueOnError)
+	p.register(fs)
+	if fs.Lookup(name) == nil {
+		return fmt.Errorf("unknown parameter: %s", name)
+	}
+	if err := fs.Set(name, value); err != nil {
+		return fmt.Errorf("invalid value %q for parameter %s: %v", value, name, err)
+	}
+	return nil
+}
+
+// get returns the value of the parameter having the given flag name.
+func (p *params) get(name string) string {
+	fs := flag.NewFlagSet("params", flag.ContinueOnError)
+	p.register(fs)
+	if f := fs.Lookup(name); f != nil {
+		return f.Value.String()
+	}
+	return ""
+}
+
+// apply assigns the values of the parameters, in alphabetical order.
+func (p *params) apply(values map[string]string) error {
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := p.set(name, values[name]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validate checks the parameters and prepares the block transforms, the feature extractor, the fused detectors and the calibration.
+func (p *params) validate() error {
+	if p.MaxSize < 16 {
+		return fmt.Errorf("the maximum image size must be at least 16")
+	}
+
+	if p.BlockSize <= 1 {
+		return fmt.Errorf("the block size must be greater then 1")
+	}
+
+	if p.Method != "dct" && p.Method != "patchmatch" {
+		return fmt.Errorf("unsupported detection method: %s", p.Method)
+	}
+
+	if p.ShiftTolerance <= 0 {
+		return fmt.Errorf("the shift vector clustering tolerance must be positive")
+	}
+
+	if p.PatchSize <= 1 {
+		return fmt.Errorf("the patch size must be greater then 1")
+	}
+
+	if p.BlurRadius < 0 {
+		return fmt.Errorf("the blur radius (-blur) must not be negative")
+	}
+
+	if p.OffsetThreshold < 0 {
+		return fmt.Errorf("the offset threshold (-ot) must not be negative")
+	}
+
+	if p.DistanceThreshold < 0 {
+		return fmt.Errorf("the distance threshold (-dt) must not be negative")
+	}
+
+	if p.MinArea < 0 {
+		return fmt.Errorf("the minimum area (-minarea) must not be negative")
+	}
+
+	if p.CloseRadius < 0 || p.OpenRadius < 0 {
+		return fmt.Errorf("the closing and opening radii (-cr, -or) must not be negative")
+	}
+
+	if p.MinOffset < 0 {
+		return fmt.Errorf("the minimum offset distance (-md) must not be negative")
+	}
+
+	if p.Iterations < 1 {
+		return fmt.Errorf("the number of PatchMatch iterations (-pi) must be at least 1")
+	}
+
+	if p.TextureThreshold < 0 {
+		return fmt.Errorf("the texture threshold (-tt) must not be negative")
+	}
+
+	var err error
+	if p.transforms, err = parseTransforms(p.Transforms); err != nil {
+		return err
+	}
+
+	if p.extractor, err = newFeatureExtractor(p.Features, p.BlockSize); err != nil {
+		return err
+	}
+
+	if !contains(overlayStyles, p.Overlay) {
+		return fmt.Errorf("unsupported overlay style: %s", p.Overlay)
+	}
+
+	if p.Opacity < 0 || p.Opacity > 1 {
+		return fmt.Errorf("the overlay opacity must be between 0 and 1")
+	}
+
+	if !contains(fusionRules, p.Fusion) {
+		return fmt.Errorf("unsupported fusion rule: %s", p.Fusion)
+	}
+	if p.detectors, err = parseDetectors(p.Fuse); err != nil {
+		return err
+	}
+
+	p.calibration, err = loadCalibration(p.Calibration)
+	return err
+}
+
+// with returns a copy of the parameters, with the values applied on top of them.
+// The preset key applies the preset before the other values.
+func (p *params) with(values map[string]string) (*params, error) {
+	q := *p
+	q.fixed = make(map[string]bool, len(p.fixed)+len(values))
+	for name := range p.fixed {
+		q.fixed[name] = true
+	}
+
+	changes := make(map[string]string, len(values))
+	for name, value := range values {
+		changes[name] = value
+	}
+	if name, ok := changes["preset"]; ok {
+		preset, ok := presets[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown preset: %s", name)
+		}
+		q.Preset = name
+		delete(changes, "preset")
+		if err := q.apply(preset); err != nil {
+			return nil, err
+		}
+		for name := range preset {
+			q.fixed[name] = true
+		}
+	}
+	if err := q.apply(changes); err != nil {
+		return nil, err
+	}
+	for name := range changes {
+		q.fixed[paramName(name)] = true
+	}
+	if err := q.validate(); err != nil {
+		return nil, err
+	}
+	return &q, nil
+}
+
+// String returns the parameters in the flag=value form.
+func (p *params) String() string {
+	var s []string
+	fs := flag.NewFlagSet("params", flag.ContinueOnError)
+	p.register(fs)
+	fs.VisitAll(func(f *flag.Flag) {
+		if _, ok := deprecated[f.Name]; !ok {
+			s = append(s, fmt.Sprintf("%s=%s", f.Name, f.Value))
+		}
+	})
+	if p.Preset != "" {
+		s = append(s, "preset="+p.Preset)
+	}
+	if p.File != "" {
+		s = append(s, "file="+p.File)
+	}
+	return strings.Join(s, " ")
+}
+
+// values returns the parameters by flag name, as the String method lists them.
+func (p *params) values() map[string]string {
+	values := make(map[string]string)
+	fs := flag.NewFlagSet("params", flag.ContinueOnError)
+	p.register(fs)
+	fs.VisitAll(func(f *flag.Flag) {
+		if _, ok := deprecated[f.Name]; !ok {
+			values[f.Name] = f.Value.String()
+		}
+	})
+	if p.Preset != "" {
+		values["preset"] = p.Preset
+	}
+	if p.File != "" {
+		values["file"] = p.File
+	}
+	return values
+}
+
+// loadConfig reads the parameters of a configuration file. The YAML, JSON and TOML
+// formats are supported, depending on the file extension, restricted to flat key-value pairs.
+// The preset key selects the preset the other values are applied on.
+func loadConfig(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var values map[string]string
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".json":
+		values, err = parseJSONConfig(data)
+	case ".yaml", ".yml":
+		values, err = parseFlatConfig(data, ':')
+	case ".toml":
+		values, err = parseFlatConfig(data, '=')
+	default:
+		return nil, fmt.Errorf("unsupported configuration file format: %s", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return values, nil
+}
+
+// writeConfig writes the parameters into a configuration file, in the format given by the file extension,
+// so that it can be read back by loadConfig. The comment lines are written at the top of the YAML and TOML files.
+func writeConfig(path string, values map[string]string, comments []string) error {
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b bytes.Buffer
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".json":
+		obj := make(map[string]interface{}, len(values))
+		for name, value := range values {
+			obj[name] = configValue(value)
+		}
+		data, err := json.MarshalIndent(obj, "", "  ")
+		if err != nil {
+			return err
+		}
+		b.Write(data)
+		b.WriteByte('\n')
+	case ".yaml", ".yml", ".toml":
+		sep := ": "
+		if ext == ".toml" {
+			sep = " = "
+		}
+		for _, c := range comments {
+			fmt.Fprintf(&b, "# %s\n", c)
+		}
+		for _, name := range names {
+			value := values[name]
+			if _, ok := configValue(value).(string); ok && (ext == ".toml" || strings.ContainsAny(value, "#:'\"")) {
+				value = strconv.Quote(value)
+			}
+			fmt.Fprintf(&b, "%s%s%s\n", name, sep, value)
+		}
+	default:
+		return fmt.Errorf("unsupported configuration file format: %s", path)
+	}
+	return os.WriteFile(path, b.Bytes(), 0644)
+}
+
+// configValue returns the number or boolean represented by the value, or the value itself.
+func configValue(value string) interface{} {
+	if v, err := strconv.ParseFloat(value, 64); err == nil {
+		return v
+	}
+	if v, err := strconv.ParseBool(value); err == nil && (value == "true" || value == "false") {
+		return v
+	}
+	return value
+}
+
+// parseJSONConfig parses a JSON object having only scalar values.
+func parseJSONConfig(data []byte) (map[string]string, error) {
+	var obj map[string]interface{}
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return nil, err
+	}
+	values := make(map[string]string, len(obj))
+	for k, v := range obj {
+		switch v := v.(type) {
+		case string:
+			values[k] = v
+		case float64:
+			values[k] = strconv.FormatFloat(v, 'f', -1, 64)
+		case bool:
+			values[k] = strconv.FormatBool(v)
+		default:
+			return nil, fmt.Errorf("unsupported value of %s: only strings, numbers and booleans are allowed", k)
+		}
+	}
+	return values, nil
+}
+
+// parseFlatConfig parses the key-value pairs separated by sep, one per line.
+// The values might be quoted and the comments start with #.
+func parseFlatConfig(data []byte, sep byte) (map[string]string, error) {
+	values := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' || line == "---" {
+			continue
+		}
+		i := strings.IndexByte(line, sep)
+		if i <= 0 {
+			return nil, fmt.Errorf("line %d: expected key %c value", n, sep)
+		}
+		key, value := strings.TrimSpace(line[:i]), strings.TrimSpace(line[i+1:])
+		if value == "" || strings.HasPrefix(value, "[") || strings.HasPrefix(value, "{") {
+			return nil, fmt.Errorf("line %d: only scalar values are supported", n)
+		}
+		if q := value[0]; q == '"' || q == '\'' {
+			end := strings.IndexByte(value[1:], q)
+			if end < 0 {
+				return nil, fmt.Errorf("line %d: unterminated string", n)
+			}
+			value = value[1 : end+1]
+		} else if c := strings.Index(value, "#"); c >= 0 {
+			value = strings.TrimSpace(value[:c])
+		}
+		values[strings.Trim(key, `"'`)] = value
+	}
+	return values, scanner.Err()
+}
+
+// findConfig returns the configuration file of the nearest directory, starting from dir, or an empty string.
+func findConfig(dir string) string {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return ""
+	}
+	for {
+		for _, name := range configNames {
+			path := filepath.Join(dir, name)
+			if fi, err := os.Stat(path); err == nil && !fi.IsDir() {
+				return path
+			}
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// paramsResolver computes the effective parameters of the images. The values are applied in
+// increasing order of priority: defaults, preset, configuration file and command line flags.
+type paramsResolver struct {
+	preset   string
+	config   string
+	explicit map[string]string
+
+	mu    sync.Mutex
+	cache map[string]*params
+}
+
+// newParamsResolver creates a resolver for the flags explicitly set on the command line.
+// If the config file is empty, it is looked up in the directory of each image.
+func newParamsResolver(fs *flag.FlagSet, preset, config string) *paramsResolver {
+	r := &paramsResolver{
+		preset:   preset,
+		config:   config,
+		explicit: make(map[string]string),
+		cache:    make(map[string]*params),
+	}
+	probe := flag.NewFlagSet("params", flag.ContinueOnError)
+	defaultParams().register(probe)
+	fs.Visit(func(f *flag.Flag) {
+		if probe.Lookup(f.Name) != nil {
+			r.explicit[paramName(f.Name)] = f.Value.String()
+		}
+	})
+	return r
+}
+
+// resolve returns the parameters of the image. The returned value is shared
+// by the images using the same configuration and must not be modified.
+func (r *paramsResolver) resolve(image string) (*params, error) {
+	config := r.config
+	if config == "" {
+		config = findConfig(filepath.Dir(image))
+	}
+	return r.load(config)
+}
+
+// load returns the parameters obtained with the configuration file, which might be empty.
+func (r *paramsResolver) load(config string) (*params, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if p, ok := r.cache[config]; ok {
+		return p, nil
+	}
+
+	p := defaultParams()
+	p.fixed = make(map[string]bool)
+	var values map[string]string
+	if config != "" {
+		var err error
+		if values, err = loadConfig(config); err != nil {
+			return nil, err
+		}
+		p.File = config
+	}
+
+	p.Preset = r.preset
+	if p.Preset == "" {
+		p.Preset = values["preset"]
+	}
+	delete(values, "preset")
+	if p.Preset != "" {
+		preset, ok := presets[p.Preset]
+		if !ok {
+			return nil, fmt.Errorf("unknown preset: %s", p.Preset)
+		}
+		if err := p.apply(preset); err != nil {
+			return nil, err
+		}
+	}
+	// The calibration file of a configuration file is relative to its directory.
+	if c, ok := values["calibration"]; ok && c != "" && !filepath.IsAbs(c) {
+		values["calibration"] = filepath.Join(filepath.Dir(config), c)
+	}
+	if err := p.apply(values); err != nil {
+		return nil, fmt.Errorf("%s: %v", config, err)
+	}
+	if err := p.apply(r.explicit); err != nil {
+		return nil, err
+	}
+	for _, set := range []map[string]string{presets[p.Preset], values, r.explicit} {
+		for name := range set {
+			p.fixed[paramName(name)] = true
+		}
+	}
+	if err := p.validate(); err != nil {
+		return nil, err
+	}
+
+	r.cache[config] = p
+	return p, nil
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidateRanges(t *testing.T) {
+	for _, tc := range []struct {
+		name, value string
+	}{
+		{"blur", "-1"},
+		{"ot", "-1"},
+		{"dt", "-0.1"},
+		{"minarea", "-10"},
+		{"cr", "-1"},
+		{"or", "-1"},
+		{"md", "-1"},
+		{"pi", "0"},
+		{"tt", "-1"},
+	} {
+		_, err := defaultParams().with(map[string]string{tc.name: tc.value})
+		if err == nil || !strings.Contains(err.Error(), "-"+tc.name) {
+			t.Errorf("-%s=%s: got the error %v, want an error naming the flag", tc.name, tc.value, err)
+		}
+	}
+	// The bounds themselves are valid.
+	if _, err := defaultParams().with(map[string]string{"blur": "0", "dt": "0", "minarea": "0", "pi": "1", "tt": "0"}); err != nil {
+		t.Error(err)
+	}
+
+	// The values of the configuration files are checked as well.
+	config := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(config, []byte("minarea: -5\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	r := newParamsResolver(flag.NewFlagSet("test", flag.ContinueOnError), "", config)
+	if _, err := r.resolve("image.png"); err == nil || !strings.Contains(err.Error(), "-minarea") {
+		t.Errorf("the negative area of the configuration file gave the error %v", err)
+	}
+}
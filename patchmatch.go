@@ -0,0 +1,300 @@
+// Dense copy-move detection based on the PatchMatch nearest-neighbour field,
+// following the approach described by Cozzolino, Poggi and Verdoliva in
+// "Efficient dense-field copy–move forgery detection" (IEEE TIFS, 2015).
+
+package main
+
+import (
+	"context"
+	"image"
+	"math"
+	"math/rand"
+	"sort"
+)
+
+const (
+	// medianRadius is the radius of the median filter applied on the offset field.
+	medianRadius = 2
+	// fitRadius is the radius of the neighbourhood used by the dense linear fitting.
+	fitRadius = 4
+	// fitThreshold is the maximum mean squared residual of the linear fitting
+	// for which a pixel is considered part of a consistently displaced region.
+	fitThreshold = 4.0
+)
+
+// nnField is the nearest-neighbour field computed by PatchMatch.
+// For each patch position it stores the offset to the best matching patch and the matching cost.
+type nnField struct {
+	w, h   int
+	dx, dy []int
+	cost   []float64
+}
+
+// patchMatcher holds the state required to compute the nearest-neighbour field of an image.
+type patchMatcher struct {
+	lum       []float64
+	width     int
+	patchSize int
+	minDist   int
+	rnd       *rand.Rand
+	field     *nnField
+}
+
+// newPatchMatcher returns a new patchMatcher operating on the luminance channel of the image.
+func newPatchMatcher(img *image.NRGBA, patchSize, minDist int) *patchMatcher {
+	dx, dy := img.Bounds().Dx(), img.Bounds().Dy()
+	lum := luminance(img)
+	w, h := dx-patchSize+1, dy-patchSize+1
+	if w < 0 {
+		w = 0
+	}
+	if h < 0 {
+		h = 0
+	}
+
+	return &patchMatcher{
+		lum:       lum,
+		width:     dx,
+		patchSize: patchSize,
+		minDist:   minDist,
+		rnd:       rand.New(rand.NewSource(1)),
+		field: &nnField{
+			w:    w,
+			h:    h,
+			dx:   make([]int, w*h),
+			dy:   make([]int, w*h),
+			cost: make([]float64, w*h),
+		},
+	}
+}
+
+// distance computes the sum of squared differences between the patches
+// having their upper left corner at (xa, ya) and (xb, yb). The computation
+// is abandoned as soon as the partial sum exceeds the limit.
+func (pm *patchMatcher) distance(xa, ya, xb, yb int, limit float64) float64 {
+	var sum float64
+	for j := 0; j < pm.patchSize; j++ {
+		ia := (ya+j)*pm.width + xa
+		ib := (yb+j)*pm.width + xb
+		for i := 0; i < pm.patchSize; i++ {
+			d := pm.lum[ia+i] - pm.lum[ib+i]
+			sum += d * d
+		}
+		if sum > limit {
+			return sum
+		}
+	}
+	return sum
+}
+
+// valid reports whether the patch at (x, y) can be matched with the patch displaced by (ox, oy).
+// Trivial self matches, i.e. the null offset and the offsets shorter than the minimum distance, are excluded.
+func (pm *patchMatcher) valid(x, y, ox, oy int) bool {
+	tx, ty := x+ox, y+oy
+	if tx < 0 || ty < 0 || tx >= pm.field.w || ty >= pm.field.h {
+		return false
+	}
+	return (ox != 0 || oy != 0) && ox*ox+oy*oy >= pm.minDist*pm.minDist
+}
+
+// try evaluates the candidate offset for the patch at (x, y) and keeps it if it is better.
+func (pm *patchMatcher) try(x, y, ox, oy int) {
+	if !pm.valid(x, y, ox, oy) {
+		return
+	}
+	idx := y*pm.field.w + x
+	best := pm.field.cost[idx]
+	if d := pm.distance(x, y, x+ox, y+oy, best); d < best {
+		pm.field.dx[idx], pm.field.dy[idx], pm.field.cost[idx] = ox, oy, d
+	}
+}
+
+// randomOffset returns a random valid offset for the patch at (x, y).
+func (pm *patchMatcher) randomOffset(x, y int) (int, int) {
+	f := pm.field
+	for {
+		tx, ty := pm.rnd.Intn(f.w), pm.rnd.Intn(f.h)
+		if pm.valid(x, y, tx-x, ty-y) {
+			return tx - x, ty - y
+		}
+	}
+}
+
+// compute runs the PatchMatch algorithm for the requested number of iterations.
+// Each iteration consists of a propagation step, which tries the offsets
+// of the already visited neighbours, and a random search step around the current best match.
+// It returns nil if the image is too small compared to the minimum offset distance,
+// and the error of the context if it is done before the end of the iterations.
+func (pm *patchMatcher) compute(ctx context.Context, iterations int) (*nnField, error) {
+	f := pm.field
+	// The farthest corner of the field is at least half of the diagonal away from any
+	// position, so below this size some positions might not have a valid match at all. A single position
+	// has no match other than itself.
+	if f.w*f.h < 2 || f.w*f.w+f.h*f.h < 4*pm.minDist*pm.minDist {
+		return nil, nil
+	}
+	for y := 0; y < f.h; y++ {
+		for x := 0; x < f.w; x++ {
+			idx := y*f.w + x
+			f.dx[idx], f.dy[idx] = pm.randomOffset(x, y)
+			f.cost[idx] = pm.distance(x, y, x+f.dx[idx], y+f.dy[idx], math.MaxFloat64)
+		}
+	}
+
+	maxRadius := f.w
+	if f.h > maxRadius {
+		maxRadius = f.h
+	}
+
+	for it := 0; it < iterations; it++ {
+		// Alternate the scan order on even and odd iterations.
+		x0, x1, y0, y1, step := 0, f.w, 0, f.h, 1
+		if it%2 == 1 {
+			x0, x1, y0, y1, step = f.w-1, -1, f.h-1, -1, -1
+		}
+		for y := y0; y != y1; y += step {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			for x := x0; x != x1; x += step {
+				// Propagation.
+				if nx := x - step; nx >= 0 && nx < f.w {
+					n := y*f.w + nx
+					pm.try(x, y, f.dx[n], f.dy[n])
+				}
+				if ny := y - step; ny >= 0 && ny < f.h {
+					n := ny*f.w + x
+					pm.try(x, y, f.dx[n], f.dy[n])
+				}
+				// Random search.
+				idx := y*f.w + x
+				for r := maxRadius; r >= 1; r /= 2 {
+					ox := f.dx[idx] + pm.rnd.Intn(2*r+1) - r
+					oy := f.dy[idx] + pm.rnd.Intn(2*r+1) - r
+					pm.try(x, y, ox, oy)
+				}
+			}
+		}
+	}
+	return f, nil
+}
+
+// medianFilter applies a median filter of the given radius on the offset field components.
+func (f *nnField) medianFilter(radius int) {
+	mdx, mdy := make([]int, len(f.dx)), make([]int, len(f.dy))
+	window := (2*radius + 1) * (2*radius + 1)
+	wx, wy := make([]int, 0, window), make([]int, 0, window)
+
+	for y := 0; y < f.h; y++ {
+		for x := 0; x < f.w; x++ {
+			wx, wy = wx[:0], wy[:0]
+			for j := y - radius; j <= y+radius; j++ {
+				for i := x - radius; i <= x+radius; i++ {
+					if i < 0 || j < 0 || i >= f.w || j >= f.h {
+						continue
+					}
+					wx = append(wx, f.dx[j*f.w+i])
+					wy = append(wy, f.dy[j*f.w+i])
+				}
+			}
+			sort.Ints(wx)
+			sort.Ints(wy)
+			mdx[y*f.w+x], mdy[y*f.w+x] = wx[len(wx)/2], wy[len(wy)/2]
+		}
+	}
+	f.dx, f.dy = mdx, mdy
+}
+
+// fitError computes for each position the mean squared residual of a least squares
+// linear fitting of the offset field over a square neighbourhood of the given radius.
+// Regions copied with a rigid transformation have a locally linear offset field,
+// hence a residual close to zero, while random matches produce large residuals.
+// Positions too close to the border to be fitted get an infinite error.
+func (f *nnField) fitError(radius int) []float64 {
+	errs := make([]float64, f.w*f.h)
+	for i := range errs {
+		errs[i] = math.Inf(1)
+	}
+
+	// With a full, centered window the normal equations are diagonal.
+	n := float64((2*radius + 1) * (2*radius + 1))
+	var s float64
+	for k := -radius; k <= radius; k++ {
+		s += float64(k * k)
+	}
+	s *= float64(2*radius + 1)
+
+	for y := radius; y < f.h-radius; y++ {
+		for x := radius; x < f.w-radius; x++ {
+			var res float64
+			for _, d := range [][]int{f.dx, f.dy} {
+				var sum, sumU, sumV, sumSq float64
+				for v := -radius; v <= radius; v++ {
+					for u := -radius; u <= radius; u++ {
+						val := float64(d[(y+v)*f.w+x+u])
+						sum += val
+						sumU += float64(u) * val
+						sumV += float64(v) * val
+						sumSq += val * val
+					}
+				}
+				a, b, c := sum/n, sumU/s, sumV/s
+				res += sumSq - n*a*a - s*b*b - s*c*c
+			}
+			errs[y*f.w+x] = math.Max(res, 0) / n
+		}
+	}
+	return errs
+}
+
+// densePatch is a patch of the offset field consistently displaced, with the residual of the linear fitting.
+type densePatch struct {
+	vector
+	fit float64
+}
+
+// confidence returns the confidence of the match in the [0, 1] range, based on the fitting residual.
+func (d densePatch) confidence() float64 {
+	return 1 - d.fit/fitThreshold
+}
+
+// denseDetect computes the PatchMatch nearest-neighbour field of the image,
+// regularizes it with a median filter and selects the regions with a consistent
+// offset field by means of dense linear fitting. The patches flagged as flat are discarded.
+// It returns the mask of the consistent positions of the field, each patch being marked
+// at its centre, together with the consistent patches and their matches. The mask goes
+// through the post-processing shared with the block matching, which removes the small regions.
+// It returns the error of the context if the analysis is canceled.
+func denseDetect(ctx context.Context, img *image.NRGBA, patchSize, minDist, iterations int, flat []bool) (*image.Alpha, []densePatch, error) {
+	bounds := img.Bounds()
+	mask := image.NewAlpha(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+
+	pm := newPatchMatcher(img, patchSize, minDist)
+	field, err := pm.compute(ctx, iterations)
+	if err != nil {
+		return nil, nil, err
+	}
+	if field == nil {
+		return mask, nil, nil
+	}
+	field.medianFilter(medianRadius)
+	errs := field.fitError(fitRadius)
+
+	var patches []densePatch
+	for i, e := range errs {
+		if e >= fitThreshold || (flat != nil && flat[i]) {
+			continue
+		}
+		x, y := i%field.w, i/field.w
+		tx, ty := x+field.dx[i], y+field.dy[i]
+		if tx < 0 || ty < 0 || tx >= field.w || ty >= field.h {
+			continue
+		}
+		mask.Pix[mask.PixOffset(x+patchSize/2, y+patchSize/2)] = 0xff
+		patches = append(patches, densePatch{
+			vector: vector{xa: x, ya: y, xb: tx, yb: ty, offsetX: float64(tx - x), offsetY: float64(ty - y)},
+			fit:    e,
+		})
+	}
+	return mask, patches, nil
+}
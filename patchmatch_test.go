@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"image"
+	"math/rand"
+	"testing"
+)
+
+// maskIoU returns the intersection over union of the detected mask and the ground truth masks.
+func maskIoU(detected *image.Alpha, truth ...*image.Gray) float64 {
+	var inter, union int
+	for i, v := range detected.Pix {
+		var set bool
+		for _, m := range truth {
+			set = set || m.Pix[i] != 0
+		}
+		if v != 0 && set {
+			inter++
+		}
+		if v != 0 || set {
+			union++
+		}
+	}
+	return float64(inter) / float64(union)
+}
+
+func TestDenseDetect(t *testing.T) {
+	p := defaultParams()
+	opts := forgeOptions{minSize: 0.25, maxSize: 0.3, minShift: 32, minScale: 1, maxScale: 1}
+	for seed := int64(1); seed <= 3; seed++ {
+		forged, pasted, f, err := forge(smoothImage(160, 140, seed), opts, rand.New(rand.NewSource(seed)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		mask, patches, err := denseDetect(context.Background(), forged, p.PatchSize, p.MinOffset, p.Iterations, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		mask, _ = postProcess(mask, p.CloseRadius, p.OpenRadius, p.MinArea)
+
+		// The detected pixels are the footprints of the kept patches and of their matches, as in process.
+		var kept []vector
+		for _, d := range patches {
+			if mask.Pix[mask.PixOffset(d.xa+p.PatchSize/2, d.ya+p.PatchSize/2)] != 0 {
+				kept = append(kept, d.vector)
+				if d.offsetX*d.offsetX+d.offsetY*d.offsetY < float64(p.MinOffset*p.MinOffset) {
+					t.Errorf("seed %d: the patch at (%d, %d) matches itself", seed, d.xa, d.ya)
+				}
+			}
+		}
+		footprint := rasterizeBlocks(mask.Bounds(), kept, p.PatchSize)
+		if iou := maskIoU(footprint, pasted, sourceMask(pasted.Bounds(), f)); iou < 0.75 {
+			t.Errorf("seed %d: the IoU of the dense detection is %.2f", seed, iou)
+		}
+	}
+}
+
+func TestRandomOffset(t *testing.T) {
+	img := smoothImage(40, 30, 1)
+	for _, minDist := range []int{0, 1, 10} {
+		pm := newPatchMatcher(img, 8, minDist)
+		for y := 0; y < pm.field.h; y++ {
+			for x := 0; x < pm.field.w; x++ {
+				ox, oy := pm.randomOffset(x, y)
+				if ox == 0 && oy == 0 {
+					t.Fatalf("minimum distance %d: the offset of (%d, %d) is the trivial self match", minDist, x, y)
+				}
+				if ox*ox+oy*oy < minDist*minDist {
+					t.Fatalf("minimum distance %d: the offset (%d, %d) is too short", minDist, ox, oy)
+				}
+				if tx, ty := x+ox, y+oy; tx < 0 || ty < 0 || tx >= pm.field.w || ty >= pm.field.h {
+					t.Fatalf("the offset (%d, %d) of (%d, %d) is out of the field", ox, oy, x, y)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+	"sync"
+
+	"gopkg.in/cheggaaa/pb.v1"
+)
+
+// checkInterval is the number of processed items between two checks of the cancellation of an analysis.
+const checkInterval = 1024
+
+// progressEvent reports the progress of an analysis stage (generate, analyze or detect).
+// The first event of a stage has a zero counter, the last one is marked as done.
+type progressEvent struct {
+	Image   string  `json:"image,omitempty"`
+	Stage   string  `json:"stage"`
+	Current int     `json:"current"`
+	Total   int     `json:"total"`
+	Percent float64 `json:"percent"`
+	Done    bool    `json:"done,omitempty"`
+}
+
+// progressReporter receives the progress events of the analyses.
+// It must be safe for concurrent use if several images are analyzed at the same time.
+// It is internal to the command: the Go programs plug their callback, a client.ProgressFunc,
+// into the StreamDetect method of the gRPC client instead.
+type progressReporter interface {
+	report(e progressEvent)
+}
+
+// progressFunc adapts a callback to the progressReporter interface.
+type progressFunc func(e progressEvent)
+
+func (f progressFunc) report(e progressEvent) {
+	f(e)
+}
+
+// tracker follows an analysis of an image through its progress counters.
+type tracker struct {
+	image    string
+	reporter progressReporter
+}
+
+// progress counts the processed items of an analysis stage.
+type progress struct {
+	tracker *tracker
+	stage   string
+	current int
+	total   int
+	// step is the number of increments between two reported events.
+	step int
+}
+
+// startProgress starts counting the items of the stage. The tracker, if not nil,
+// receives an event about every percent of the total.
+func startProgress(t *tracker, total int, stage string) *progress {
+	p := &progress{
+		tracker: t,
+		stage:   stage,
+		total:   total,
+		step:    total/100 + 1,
+	}
+	p.notify(false)
+	return p
+}
+
+// Increment increments the counter and returns its new value.
+func (p *progress) Increment() int {
+	p.current++
+	if p.current%p.step == 0 {
+		p.notify(false)
+	}
+	return p.current
+}
+
+// Finish reports the end of the stage.
+func (p *progress) Finish() {
+	p.notify(true)
+}
+
+func (p *progress) notify(done bool) {
+	t := p.tracker
+	if t == nil || t.reporter == nil {
+		return
+	}
+	e := progressEvent{
+		Image:   t.image,
+		Stage:   p.stage,
+		Current: p.current,
+		Total:   p.total,
+		Percent: 100,
+		Done:    done,
+	}
+	if p.total > 0 {
+		e.Percent = math.Round(float64(10000*p.current)/float64(p.total)) / 100
+	}
+	t.reporter.report(e)
+}
+
+// newProgressReporter returns the console renderer of the progress events: progress bars (bar),
+// a line every 10 percent (plain) or JSON lines (json), written to the standard error.
+// In auto mode the bars are shown on a terminal, the lines otherwise, and only in interactive mode.
+// It returns nil if the progress is not reported (none).
+func newProgressReporter(mode string) (progressReporter, error) {
+	if mode == "auto" {
+		switch {
+		case !interactive:
+			mode = "none"
+		case isTerminal(os.Stderr):
+			mode = "bar"
+		default:
+			mode = "plain"
+		}
+	}
+	switch mode {
+	case "bar":
+		return &barReporter{bars: make(map[string]*pb.ProgressBar)}, nil
+	case "plain":
+		return &lineReporter{w: os.Stderr, last: make(map[string]int)}, nil
+	case "json":
+		return &jsonReporter{enc: json.NewEncoder(os.Stderr)}, nil
+	case "none":
+		return nil, nil
+	}
+	return nil, fmt.Errorf("unsupported progress mode: %s", mode)
+}
+
+// isTerminal reports whether the file is a character device.
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// barReporter shows a progress bar for each stage. It is meant for a single image at a time.
+type barReporter struct {
+	mu   sync.Mutex
+	bars map[string]*pb.ProgressBar
+}
+
+func (r *barReporter) report(e progressEvent) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key := e.Image + "\x00" + e.Stage
+	bar, ok := r.bars[key]
+	if !ok {
+		bar = pb.New(e.Total).Prefix(strings.ToUpper(e.Stage[:1]) + e.Stage[1:] + ": ")
+		bar.Output = os.Stderr
+		bar.Start()
+		r.bars[key] = bar
+	}
+	bar.Set(e.Current)
+	if e.Done {
+		bar.Finish()
+		delete(r.bars, key)
+	}
+}
+
+// lineReporter writes a line whenever a stage progresses by 10 percent.
+type lineReporter struct {
+	mu   sync.Mutex
+	w    io.Writer
+	last map[string]int
+}
+
+func (r *lineReporter) report(e progressEvent) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key := e.Image + "\x00" + e.Stage
+	last, ok := r.last[key]
+	if e.Done {
+		delete(r.last, key)
+		if ok && last == 10 {
+			return
+		}
+	} else {
+		decile := int(e.Percent) / 10
+		if ok && decile <= last {
+			return
+		}
+		r.last[key] = decile
+	}
+	if e.Image != "" {
+		fmt.Fprintf(r.w, "%s: ", e.Image)
+	}
+	fmt.Fprintf(r.w, "%s %3.0f%% (%d/%d)\n", e.Stage, e.Percent, e.Current, e.Total)
+}
+
+// jsonReporter writes each event as a JSON line.
+type jsonReporter struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+func (r *jsonReporter) report(e progressEvent) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.enc.Encode(e)
+}
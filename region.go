@@ -0,0 +1,175 @@
+package main
+
+import (
+	"image"
+	"sort"
+)
+
+// region describes a connected component of the detection mask.
+type region struct {
+	label  int
+	bounds image.Rectangle
+	area   int
+	cx, cy float64
+}
+
+// regionReport is the description of a forged region in the reports.
+type regionReport struct {
+	Label  int     `json:"label"`
+	X      int     `json:"x"`
+	Y      int     `json:"y"`
+	Width  int     `json:"width"`
+	Height int     `json:"height"`
+	Area   int     `json:"area"`
+	CX     float64 `json:"cx"`
+	CY     float64 `json:"cy"`
+}
+
+// report returns the description of the region.
+func (r region) report() regionReport {
+	return regionReport{
+		Label:  r.label,
+		X:      r.bounds.Min.X,
+		Y:      r.bounds.Min.Y,
+		Width:  r.bounds.Dx(),
+		Height: r.bounds.Dy(),
+		Area:   r.area,
+		CX:     r.cx,
+		CY:     r.cy,
+	}
+}
+
+// rasterizeBlocks marks on a binary mask both the source and the target blocks of the shift vectors.
+func rasterizeBlocks(bounds image.Rectangle, vect []vector, size int) *image.Alpha {
+	mask := image.NewAlpha(bounds)
+	for _, v := range vect {
+		for _, r := range []image.Rectangle{
+			image.Rect(v.xa, v.ya, v.xa+size, v.ya+size),
+			image.Rect(v.xb, v.yb, v.xb+size, v.yb+size),
+		} {
+			r = r.Intersect(bounds)
+			for y := r.Min.Y; y < r.Max.Y; y++ {
+				for x := r.Min.X; x < r.Max.X; x++ {
+					mask.Pix[mask.PixOffset(x, y)] = 0xff
+				}
+			}
+		}
+	}
+	return mask
+}
+
+// morph applies a dilation (or an erosion) with a square structuring element of the given radius.
+// The square element is separable, so the operation is applied first horizontally then vertically.
+func morph(mask *image.Alpha, radius int, dilate bool) *image.Alpha {
+	if radius <= 0 {
+		return mask
+	}
+	b := mask.Bounds()
+	pass := func(src *image.Alpha, dx, dy int) *image.Alpha {
+		dst := image.NewAlpha(b)
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				// Pixels outside of the image don't take part in the dilation,
+				// but are considered set for the erosion, to not erode the regions touching the border.
+				val := !dilate
+				for k := -radius; k <= radius; k++ {
+					p := image.Pt(x+k*dx, y+k*dy)
+					if !p.In(b) {
+						continue
+					}
+					if set := src.Pix[src.PixOffset(p.X, p.Y)] != 0; set == dilate {
+						val = dilate
+						break
+					}
+				}
+				if val {
+					dst.Pix[dst.PixOffset(x, y)] = 0xff
+				}
+			}
+		}
+		return dst
+	}
+	return pass(pass(mask, 1, 0), 0, 1)
+}
+
+// opening removes the structures smaller than the structuring element (erosion followed by dilation).
+func opening(mask *image.Alpha, radius int) *image.Alpha {
+	return morph(morph(mask, radius, false), radius, true)
+}
+
+// closing fills the gaps smaller than the structuring element (dilation followed by erosion).
+func closing(mask *image.Alpha, radius int) *image.Alpha {
+	return morph(morph(mask, radius, true), radius, false)
+}
+
+// labelRegions finds the 4-connected components of the mask. The components having
+// an area smaller than minArea are removed from the mask. The remaining ones are returned
+// in decreasing order of their area and labelled starting from 1.
+func labelRegions(mask *image.Alpha, minArea int) []region {
+	b := mask.Bounds()
+	visited := make([]bool, len(mask.Pix))
+	var regions []region
+	var stack, pixels []image.Point
+
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			i := mask.PixOffset(x, y)
+			if mask.Pix[i] == 0 || visited[i] {
+				continue
+			}
+			visited[i] = true
+			stack = append(stack[:0], image.Pt(x, y))
+			pixels = pixels[:0]
+
+			for len(stack) > 0 {
+				p := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				pixels = append(pixels, p)
+
+				for _, n := range []image.Point{{p.X - 1, p.Y}, {p.X + 1, p.Y}, {p.X, p.Y - 1}, {p.X, p.Y + 1}} {
+					if !n.In(b) {
+						continue
+					}
+					j := mask.PixOffset(n.X, n.Y)
+					if mask.Pix[j] != 0 && !visited[j] {
+						visited[j] = true
+						stack = append(stack, n)
+					}
+				}
+			}
+
+			if len(pixels) < minArea {
+				for _, p := range pixels {
+					mask.Pix[mask.PixOffset(p.X, p.Y)] = 0
+				}
+				continue
+			}
+
+			r := region{bounds: image.Rectangle{Min: pixels[0], Max: pixels[0].Add(image.Pt(1, 1))}, area: len(pixels)}
+			for _, p := range pixels {
+				r.bounds = r.bounds.Union(image.Rectangle{Min: p, Max: p.Add(image.Pt(1, 1))})
+				r.cx += float64(p.X)
+				r.cy += float64(p.Y)
+			}
+			r.cx /= float64(r.area)
+			r.cy /= float64(r.area)
+			regions = append(regions, r)
+		}
+	}
+
+	sort.SliceStable(regions, func(i, j int) bool {
+		return regions[i].area > regions[j].area
+	})
+	for i := range regions {
+		regions[i].label = i + 1
+	}
+	return regions
+}
+
+// postProcess applies the morphological closing and opening on the detection mask,
+// then extracts the regions having an area greater than or equal to minArea.
+func postProcess(mask *image.Alpha, closeRadius, openRadius, minArea int) (*image.Alpha, []region) {
+	mask = opening(closing(mask, closeRadius), openRadius)
+	regions := labelRegions(mask, minArea)
+	return mask, regions
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"image"
+	"testing"
+)
+
+// fill sets the pixels of the rectangle in the mask.
+func fill(mask *image.Alpha, r image.Rectangle) {
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			mask.Pix[mask.PixOffset(x, y)] = 0xff
+		}
+	}
+}
+
+// count returns the number of pixels set in the mask.
+func count(mask *image.Alpha) int {
+	var n int
+	for _, v := range mask.Pix {
+		if v != 0 {
+			n++
+		}
+	}
+	return n
+}
+
+func TestLabelRegions(t *testing.T) {
+	mask := image.NewAlpha(image.Rect(0, 0, 40, 30))
+	fill(mask, image.Rect(2, 2, 8, 6))     // 24 pixels
+	fill(mask, image.Rect(20, 10, 30, 20)) // 100 pixels
+	fill(mask, image.Rect(30, 19, 35, 20)) // connected to the previous one
+	fill(mask, image.Rect(10, 25, 12, 27)) // 4 pixels, removed
+	// Touching by the corner only: not 4-connected to the large square.
+	fill(mask, image.Rect(18, 8, 20, 10))
+
+	regions := labelRegions(mask, 5)
+	want := []region{
+		{label: 1, bounds: image.Rect(20, 10, 35, 20), area: 105},
+		{label: 2, bounds: image.Rect(2, 2, 8, 6), area: 24},
+	}
+	if len(regions) != len(want) {
+		t.Fatalf("got %d regions, want %d: %v", len(regions), len(want), regions)
+	}
+	for i, r := range regions {
+		w := want[i]
+		if r.label != w.label || r.bounds != w.bounds || r.area != w.area {
+			t.Errorf("region %d is %+v, want %+v", i, r, w)
+		}
+	}
+	if r := regions[1]; r.cx != 4.5 || r.cy != 3.5 {
+		t.Errorf("the centroid is (%v, %v), want (4.5, 3.5)", r.cx, r.cy)
+	}
+	// The small regions are removed from the mask.
+	if n := count(mask); n != 105+24 {
+		t.Errorf("the mask has %d pixels set, want %d", n, 105+24)
+	}
+}
+
+func TestPostProcess(t *testing.T) {
+	mask := image.NewAlpha(image.Rect(0, 0, 60, 40))
+	// Two halves of a square separated by a one pixel gap, filled by the closing.
+	fill(mask, image.Rect(10, 10, 20, 30))
+	fill(mask, image.Rect(21, 10, 30, 30))
+	// A thin line, removed by the opening.
+	fill(mask, image.Rect(40, 5, 41, 35))
+
+	mask, regions := postProcess(mask, 2, 1, 50)
+	if len(regions) != 1 {
+		t.Fatalf("got %d regions, want 1: %v", len(regions), regions)
+	}
+	if r := regions[0]; r.bounds != image.Rect(10, 10, 30, 30) || r.area != 400 {
+		t.Errorf("got the region %+v, want the 20×20 square at (10,10)", r)
+	}
+	if n := count(mask); n != 400 {
+		t.Errorf("the mask has %d pixels set, want 400", n)
+	}
+
+	// The regions smaller than the minimum area are dropped.
+	if _, regions := postProcess(mask, 2, 1, 401); len(regions) != 0 {
+		t.Errorf("got %d regions, want none", len(regions))
+	}
+}
@@ -0,0 +1,383 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+	"html/template"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+var (
+	// Report flags
+	reportFlags = flag.NewFlagSet("report", flag.ExitOnError)
+
+	reportOut    = reportFlags.String("out", "", "HTML report file")
+	reportConfig = reportFlags.String("config", "", "Configuration file (YAML, JSON or TOML), looked up as .forensic.{yaml,yml,json,toml} in the image directory and its parents if empty")
+	reportPreset = reportFlags.String("preset", "", "Parameter preset: strict, balanced, sensitive, high-res")
+)
+
+func init() {
+	// The detection parameters, as for the detect command.
+	defaultParams().register(reportFlags)
+}
+
+// hexColor returns the CSS notation of the color.
+func hexColor(c color.RGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
+
+// reportLayer is an image drawn over the analyzed image, whose opacity can be changed with a slider.
+type reportLayer struct {
+	ID, Name string
+	Image    template.URL
+	Opacity  int
+}
+
+// reportPair is a clone pair of the report, with the arrow from the center of the source to the center of the target.
+type reportPair struct {
+	Label          int
+	Transform      string
+	Source, Target image.Rectangle
+	Blocks         int
+	Color          string
+	X1, Y1, X2, Y2 float64
+}
+
+// reportData contains the values of the report template.
+type reportData struct {
+	Entry     batchEntry
+	Verdict   string
+	Version   string
+	Generated string
+	Width     int
+	Height    int
+	Original  template.URL
+	Overlay   template.URL
+	Mask      template.URL
+	Layers    []reportLayer
+	Regions   []regionReport
+	Pairs     []reportPair
+	Evidence  []evidenceRow
+	Meta      *metadata
+	MetaError string
+	Clues     []string
+	Tags      [][2]string
+	Params    [][2]string
+}
+
+// writeReport writes the single-file HTML report of the analysis of an image. The images are embedded
+// as data URIs, so that the report can be opened without the output files and without network access.
+func writeReport(path string, entry batchEntry, res *detection) error {
+	b := res.image.Bounds()
+	data := reportData{
+		Entry:     entry,
+		Verdict:   verdict(entry.Score),
+		Version:   Version,
+		Generated: time.Now().UTC().Format(time.RFC3339),
+		Width:     b.Dx(),
+		Height:    b.Dy(),
+	}
+	if data.Version == "" {
+		data.Version = "devel"
+	}
+
+	var err error
+	if data.Original, err = dataURI(res.image); err != nil {
+		return err
+	}
+	overlay, err := os.ReadFile(entry.Output)
+	if err != nil {
+		return err
+	}
+	data.Overlay = template.URL("data:image/png;base64," + base64.StdEncoding.EncodeToString(overlay))
+	mask := &image.Gray{Pix: res.mask.Pix, Stride: res.mask.Stride, Rect: res.mask.Rect}
+	if data.Mask, err = dataURI(mask); err != nil {
+		return err
+	}
+
+	// The heatmaps of the fused detectors, or the detection mask.
+	type heatmap struct {
+		name string
+		heat []float64
+	}
+	var layers []heatmap
+	if entry.Fusion != nil {
+		for _, d := range entry.Fusion.Detectors {
+			if d.heat != nil {
+				layers = append(layers, heatmap{d.Name, d.heat})
+			}
+		}
+	} else {
+		heat := make([]float64, b.Dx()*b.Dy())
+		for i := range heat {
+			heat[i] = float64(mask.Pix[i/b.Dx()*mask.Stride+i%b.Dx()]) / 255
+		}
+		layers = append(layers, heatmap{"copymove", heat})
+	}
+	for i, l := range layers {
+		img := image.NewNRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+		for j, v := range l.heat {
+			img.Pix[4*j], img.Pix[4*j+3] = 255, uint8(math.Round(255*v))
+		}
+		layer := reportLayer{ID: fmt.Sprintf("layer%d", i), Name: l.name, Opacity: 60}
+		if layer.Image, err = dataURI(img); err != nil {
+			return err
+		}
+		data.Layers = append(data.Layers, layer)
+	}
+
+	for _, r := range res.regions {
+		data.Regions = append(data.Regions, r.report())
+	}
+	for i, p := range res.pairs {
+		data.Pairs = append(data.Pairs, reportPair{
+			Label:     i + 1,
+			Transform: p.transform.String(),
+			Source:    p.source,
+			Target:    p.target,
+			Blocks:    p.blocks,
+			Color:     hexColor(pairColors[i%len(pairColors)]),
+			X1:        float64(p.source.Min.X+p.source.Max.X) / 2,
+			Y1:        float64(p.source.Min.Y+p.source.Max.Y) / 2,
+			X2:        float64(p.target.Min.X+p.target.Max.X) / 2,
+			Y2:        float64(p.target.Min.Y+p.target.Max.Y) / 2,
+		})
+	}
+	if entry.Evidence != nil {
+		data.Evidence = entry.Evidence.rows()
+	}
+
+	if data.Meta, err = readMetadata(entry.Input); err != nil {
+		data.MetaError = err.Error()
+	} else {
+		_, data.Clues = metadataClues(data.Meta)
+		for k, v := range data.Meta.Tags {
+			data.Tags = append(data.Tags, [2]string{k, v})
+		}
+		sort.Slice(data.Tags, func(i, j int) bool { return data.Tags[i][0] < data.Tags[j][0] })
+	}
+
+	if p := entry.Config; p != nil {
+		fs := flag.NewFlagSet("params", flag.ContinueOnError)
+		p.register(fs)
+		fs.VisitAll(func(f *flag.Flag) {
+			if _, ok := deprecated[f.Name]; !ok {
+				data.Params = append(data.Params, [2]string{f.Name, f.Value.String()})
+			}
+		})
+		if p.Preset != "" {
+			data.Params = append(data.Params, [2]string{"preset", p.Preset})
+		}
+		if p.File != "" {
+			data.Params = append(data.Params, [2]string{"file", p.File})
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := reportTemplate.Execute(&buf, data); err != nil {
+		return err
+	}
+	return os.WriteFile(path, buf.Bytes(), 0644)
+}
+
+// dataURI returns the image encoded as a PNG data URI.
+func dataURI(img image.Image) (template.URL, error) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return "", err
+	}
+	return template.URL("data:image/png;base64," + base64.StdEncoding.EncodeToString(buf.Bytes())), nil
+}
+
+// reportTemplate is the HTML report. The styles and the few scripts of the sliders are inline.
+var reportTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"percent": func(v float64) string { return fmt.Sprintf("%.0f%%", v) },
+	"fixed":   func(v float64) string { return fmt.Sprintf("%.2f", v) },
+	"opacity": func(v int) string { return fmt.Sprintf("%.2f", float64(v)/100) },
+	"rect": func(r image.Rectangle) string {
+		return fmt.Sprintf("(%d,%d)-(%d,%d)", r.Min.X, r.Min.Y, r.Max.X, r.Max.Y)
+	},
+	"box": func(r regionReport) string {
+		return fmt.Sprintf("(%d,%d)-(%d,%d)", r.X, r.Y, r.X+r.Width, r.Y+r.Height)
+	},
+	"date": func(t time.Time) string { return t.Format(time.RFC3339) },
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Forensic report: {{.Entry.Input}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em auto; max-width: 1100px; color: #222; padding: 0 1em; }
+h1 { font-size: 1.5em; word-break: break-all; }
+h2 { font-size: 1.2em; margin-top: 2em; border-bottom: 1px solid #ccc; padding-bottom: .2em; }
+table { border-collapse: collapse; margin: .5em 0; }
+th, td { border: 1px solid #ddd; padding: .3em .6em; text-align: left; vertical-align: top; }
+th { background: #f4f4f4; }
+td.num { text-align: right; font-variant-numeric: tabular-nums; }
+.verdict { padding: .8em 1em; border-radius: 4px; font-size: 1.2em; font-weight: bold; }
+.forged { background: #fde2e2; color: #a00; }
+.authentic { background: #e2f5e4; color: #060; }
+.images { display: flex; flex-wrap: wrap; gap: 1em; }
+.images figure { margin: 0; flex: 1 1 300px; }
+.images img { width: 100%; image-rendering: pixelated; border: 1px solid #ccc; }
+figcaption { font-size: .9em; color: #555; text-align: center; }
+.viewer { position: relative; width: 100%; max-width: 720px; }
+.viewer img, .viewer svg { position: absolute; top: 0; left: 0; width: 100%; height: 100%; image-rendering: pixelated; }
+.viewer img.base { position: static; display: block; height: auto; }
+.controls label { display: inline-block; min-width: 7em; }
+.note { color: #555; font-size: .9em; }
+</style>
+</head>
+<body>
+<h1>Forensic report: {{.Entry.Input}}</h1>
+<p class="verdict {{if .Entry.Forged}}forged{{else}}authentic{{end}}">{{.Verdict}}</p>
+<table>
+<tr><th>Score</th><td>{{percent .Entry.Score}}</td></tr>
+<tr><th>Forged regions</th><td>{{.Entry.Regions}}</td></tr>
+<tr><th>Low-texture blocks excluded</th><td>{{.Entry.Excluded}}</td></tr>
+<tr><th>Analysis duration</th><td>{{printf "%.2f" .Entry.Duration}} s</td></tr>
+<tr><th>Analyzed size</th><td>{{.Width}}x{{.Height}} px</td></tr>
+<tr><th>Report generated</th><td>{{.Generated}} by forensic {{.Version}}</td></tr>
+</table>
+
+<h2>Images</h2>
+<div class="images">
+<figure><img src="{{.Original}}" alt="original"><figcaption>Analyzed image</figcaption></figure>
+<figure><img src="{{.Overlay}}" alt="overlay"><figcaption>Detected regions</figcaption></figure>
+<figure><img src="{{.Mask}}" alt="mask"><figcaption>Detection mask</figcaption></figure>
+</div>
+
+<h2>Heatmaps</h2>
+<p class="note">The heatmaps are drawn in red over the analyzed image. Move the sliders to change their opacity.</p>
+<div class="viewer">
+<img class="base" src="{{.Original}}" alt="analyzed image">
+{{range .Layers}}<img id="{{.ID}}" src="{{.Image}}" alt="{{.Name}} heatmap" style="opacity: {{opacity .Opacity}}">
+{{end}}{{if .Pairs}}<svg id="arrows" viewBox="0 0 {{.Width}} {{.Height}}" preserveAspectRatio="none">
+<defs>{{range .Pairs}}<marker id="head{{.Label}}" viewBox="0 0 10 10" refX="9" refY="5" markerWidth="4" markerHeight="4" orient="auto"><path d="M0,0 L10,5 L0,10 z" fill="{{.Color}}"/></marker>{{end}}</defs>
+{{range .Pairs}}<rect x="{{.Source.Min.X}}" y="{{.Source.Min.Y}}" width="{{.Source.Dx}}" height="{{.Source.Dy}}" fill="none" stroke="{{.Color}}" stroke-width="1" stroke-dasharray="3,2"/>
+<rect x="{{.Target.Min.X}}" y="{{.Target.Min.Y}}" width="{{.Target.Dx}}" height="{{.Target.Dy}}" fill="none" stroke="{{.Color}}" stroke-width="1.5"/>
+<line x1="{{.X1}}" y1="{{.Y1}}" x2="{{.X2}}" y2="{{.Y2}}" stroke="{{.Color}}" stroke-width="1.5" marker-end="url(#head{{.Label}})"/>
+{{end}}</svg>{{end}}
+</div>
+<div class="controls">
+{{range .Layers}}<div><label for="{{.ID}}-opacity">{{.Name}}</label> <input id="{{.ID}}-opacity" type="range" min="0" max="100" value="{{.Opacity}}" oninput="document.getElementById('{{.ID}}').style.opacity = this.value / 100"></div>
+{{end}}{{if .Pairs}}<div><label for="arrows-visible">clone pairs</label> <input id="arrows-visible" type="checkbox" checked onchange="document.getElementById('arrows').style.display = this.checked ? '' : 'none'"></div>{{end}}
+</div>
+
+<h2>Detected regions</h2>
+{{if .Regions}}<table>
+<tr><th>#</th><th>Bounds</th><th>Area (px)</th><th>Centroid</th></tr>
+{{range .Regions}}<tr><td class="num">{{.Label}}</td><td>{{box .}}</td><td class="num">{{.Area}}</td><td>({{fixed .CX}}, {{fixed .CY}})</td></tr>
+{{end}}</table>{{else}}<p>No forged region was detected.</p>{{end}}
+{{if .Pairs}}<h3>Clone pairs</h3>
+<p class="note">The arrows go from the source of each copy (dashed) to its target (solid).</p>
+<table>
+<tr><th>#</th><th>Transform</th><th>Source</th><th>Target</th><th>Blocks</th></tr>
+{{range .Pairs}}<tr><td class="num" style="color: {{.Color}}">{{.Label}}</td><td>{{.Transform}}</td><td>{{rect .Source}}</td><td>{{rect .Target}}</td><td class="num">{{.Blocks}}</td></tr>
+{{end}}</table>{{end}}
+
+{{with .Entry.Fusion}}<h2>Detectors</h2>
+<p>Fusion rule: {{.Rule}}, fused score {{percent $.Entry.Score}}.</p>
+<table>
+<tr><th>Detector</th><th>Weight</th><th>Score</th><th>Fired</th><th>Regions and clues</th></tr>
+{{range .Detectors}}<tr><td>{{.Name}}</td><td class="num">{{fixed .Weight}}</td><td class="num">{{fixed .Score}}</td><td>{{if .Fired}}yes{{else}}no{{end}}</td><td>{{range .Regions}}{{box .}} {{end}}{{range .Clues}}{{.}}<br>{{end}}</td></tr>
+{{end}}</table>{{end}}
+
+{{if .Evidence}}<h2>Evidence</h2>
+<p class="note">{{if eq .Entry.Evidence.Calibration "uncalibrated"}}Uncalibrated built-in model: the probability is only a score.{{else}}Calibration {{.Entry.Evidence.Calibration}}.{{end}} The contributions to the log-odds of a forgery add up to the logit of the probability.</p>
+<table>
+<tr><th>Evidence</th><th>Value</th><th>Contribution</th></tr>
+{{range .Evidence}}<tr><td>{{.Label}}</td><td class="num">{{.Value}}</td><td class="num">{{.Contribution}}</td></tr>
+{{end}}</table>{{end}}
+
+<h2>Metadata</h2>
+{{if .Meta}}{{with .Meta}}<table>
+<tr><th>File</th><td>{{.File}}</td></tr>
+<tr><th>Size</th><td>{{.Size}} bytes</td></tr>
+<tr><th>Modified</th><td>{{date .Modified}}</td></tr>
+<tr><th>Format</th><td>{{.Format}}, {{.Width}}x{{.Height}} px</td></tr>
+{{if .Quality}}<tr><th>Estimated JPEG quality</th><td>{{.Quality}}</td></tr>{{end}}
+{{if .Segments}}<tr><th>Segments</th><td>{{range $i, $s := .Segments}}{{if $i}}, {{end}}{{$s}}{{end}}</td></tr>{{end}}
+</table>{{end}}
+{{if .Tags}}<table>
+<tr><th>Tag</th><th>Value</th></tr>
+{{range .Tags}}<tr><td>{{index . 0}}</td><td>{{index . 1}}</td></tr>
+{{end}}</table>{{end}}
+{{if .Clues}}<p>Traces of editing:</p><ul>{{range .Clues}}<li>{{.}}</li>{{end}}</ul>{{else}}<p>No trace of editing was found in the metadata.</p>{{end}}
+{{else}}<p>The metadata can't be read: {{.MetaError}}</p>{{end}}
+
+<h2>Parameters</h2>
+<table>
+<tr><th>Parameter</th><th>Value</th></tr>
+{{range .Params}}<tr><td>{{index . 0}}</td><td>{{index . 1}}</td></tr>
+{{end}}</table>
+{{if .Entry.Auto}}<p>Automatic parameters:</p><ul>{{range .Entry.Auto}}<li>{{.}}</li>{{end}}</ul>{{end}}
+</body>
+</html>
+`))
+
+// runReport analyzes the image given as argument and writes the HTML report of the analysis.
+// The output images are only embedded into the report, so they are written into a temporary directory.
+func runReport(args []string) error {
+	if len(args) != 1 || len(*reportOut) == 0 {
+		return errUsage
+	}
+	if _, ok := presets[*reportPreset]; *reportPreset != "" && !ok {
+		return fmt.Errorf("unknown preset: %s", *reportPreset)
+	}
+	p := defaultParams()
+	resolver := newParamsResolver(reportFlags, *reportPreset, *reportConfig)
+	if err := p.apply(resolver.explicit); err != nil {
+		return err
+	}
+	if err := p.validate(); err != nil {
+		return err
+	}
+
+	dir, err := os.MkdirTemp("", "forensic")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	entry, res := analyzeFile(context.Background(), args[0], filepath.Join(dir, "output.png"), resolver.resolve, analysisOptions{
+		tracker: &tracker{reporter: progressOutput},
+		verbose: interactive,
+	})
+	if entry.Status != "ok" {
+		return errors.New(entry.Error)
+	}
+	if err := writeReport(*reportOut, entry, res); err != nil {
+		return fmt.Errorf("Error writing the report: %v", err)
+	}
+
+	// The temporary output files are removed.
+	entry.Output = ""
+	if entry.Fusion != nil {
+		entry.Fusion.Heatmap = ""
+	}
+	if outputFormat == "json" {
+		return printJSON(struct {
+			batchEntry
+			Report string `json:"report"`
+		}{entry, *reportOut})
+	}
+	v := verdict(entry.Score)
+	fmt.Println(strings.ToUpper(v[:1]) + v[1:])
+	if verbosity > 0 {
+		fmt.Printf("Report written to %s\n", *reportOut)
+	}
+	return nil
+}
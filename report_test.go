@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReport(t *testing.T) {
+	dir := t.TempDir()
+	img := texturedImage(160, 140, 2)
+	for y := 20; y < 60; y++ {
+		for x := 20; x < 60; x++ {
+			img.SetNRGBA(x+60, y+50, img.NRGBAAt(x, y))
+		}
+	}
+	input := filepath.Join(dir, "forged.png")
+	if err := writePNG(input, img); err != nil {
+		t.Fatal(err)
+	}
+	p, err := defaultParams().with(map[string]string{"fuse": "copymove,ela,noise,meta"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry, res := analyzeFile(context.Background(), input, filepath.Join(dir, "out.png"), func(string) (*params, error) { return p, nil }, analysisOptions{})
+	if entry.Status != "ok" {
+		t.Fatal(entry.Error)
+	}
+	if len(res.pairs) == 0 {
+		t.Fatal("no clone pair was detected")
+	}
+	path := filepath.Join(dir, "report.html")
+	if err := writeReport(path, entry, res); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The report is parsed with the HTML mode of the XML decoder.
+	d := xml.NewDecoder(strings.NewReader(string(data)))
+	d.Strict = false
+	d.AutoClose = xml.HTMLAutoClose
+	d.Entity = xml.HTMLEntity
+	var layers []string
+	var rows []string
+	var row *strings.Builder
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("the report doesn't parse: %v", err)
+		}
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			for _, a := range tok.Attr {
+				if (a.Name.Local == "src" || a.Name.Local == "href") && !strings.HasPrefix(a.Value, "data:") {
+					t.Errorf("the %s element refers to an external resource: %s=%q", tok.Name.Local, a.Name.Local, a.Value)
+				}
+				if tok.Name.Local == "img" && a.Name.Local == "id" && strings.HasPrefix(a.Value, "layer") {
+					layers = append(layers, a.Value)
+				}
+			}
+			if tok.Name.Local == "tr" {
+				row = &strings.Builder{}
+			} else if row != nil {
+				row.WriteString(" ")
+			}
+		case xml.CharData:
+			if row != nil {
+				row.Write(tok)
+			}
+		case xml.EndElement:
+			if tok.Name.Local == "tr" && row != nil {
+				rows = append(rows, strings.Join(strings.Fields(row.String()), " "))
+				row = nil
+			}
+		}
+	}
+
+	// Meta has no heatmap.
+	var want []string
+	for _, d := range entry.Fusion.Detectors {
+		if d.heat != nil {
+			want = append(want, d.Name)
+		}
+	}
+	if len(want) != 3 || len(layers) != len(want) {
+		t.Errorf("the report has the layers %v, want one per detector with a heatmap %v", layers, want)
+	}
+	for i, pair := range res.pairs {
+		s := fmt.Sprintf("(%d,%d)-(%d,%d)", pair.source.Min.X, pair.source.Min.Y, pair.source.Max.X, pair.source.Max.Y)
+		tg := fmt.Sprintf("(%d,%d)-(%d,%d)", pair.target.Min.X, pair.target.Min.Y, pair.target.Max.X, pair.target.Max.Y)
+		r := fmt.Sprintf("%d %s %s %s %d", i+1, pair.transform, s, tg, pair.blocks)
+		found := false
+		for _, row := range rows {
+			found = found || row == r
+		}
+		if !found {
+			t.Errorf("the row %q of the clone pair %d is missing", r, i+1)
+		}
+	}
+}
@@ -0,0 +1,529 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"image"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+var (
+	// Server flags
+	serveFlags = flag.NewFlagSet("serve", flag.ExitOnError)
+
+	serveAddr        = serveFlags.String("addr", "127.0.0.1:8080", "Listening address")
+	serveGRPCAddr    = serveFlags.String("grpc-addr", "", "Listening address of the gRPC API (disabled if empty)")
+	serveMaxUpload   = serveFlags.Int64("max-upload", 20, "Maximum size of the uploaded images in MB")
+	serveConcurrency = serveFlags.Int("concurrency", 0, "Maximum number of images analyzed concurrently (0 uses the number of workers)")
+	serveResults     = serveFlags.String("results", filepath.Join(os.TempDir(), "forensic"), "Directory of the uploaded images and of the results")
+	serveConfig      = serveFlags.String("config", "", "Configuration file (YAML, JSON or TOML) of the default parameters")
+	servePreset      = serveFlags.String("preset", "", "Default parameter preset: strict, balanced, sensitive, high-res")
+	serveQueue       = serveFlags.Int("queue", 100, "Maximum number of queued jobs")
+	serveRetention   = serveFlags.Duration("retention", 24*time.Hour, "Time the finished jobs are kept for (0 keeps them)")
+	serveMaxJobs     = serveFlags.Int("max-jobs", 1000, "Maximum number of finished jobs kept (0 keeps all)")
+)
+
+// resultFiles are the files of an analysis which can be downloaded.
+var resultFiles = map[string]bool{
+	"overlay.png":        true,
+	"mask.png":           true,
+	"overlay_fusion.png": true,
+	"manifest.json":      true,
+}
+
+// requestParams are the detection parameters a request may set. The calibration is a file
+// of the server, chosen by its configuration only.
+var requestParams = map[string]bool{
+	"preset": true, "auto": true, "method": true, "fe": true, "tr": true,
+	"size": true, "blur": true, "bs": true, "ot": true, "st": true, "dt": true,
+	"minarea": true, "cr": true, "or": true, "ps": true, "md": true, "pi": true, "tt": true,
+	"fuse": true, "fusion": true, "overlay": true, "opacity": true, "side-by-side": true,
+}
+
+// idPattern matches the identifiers of the analyses.
+var idPattern = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+// server is the HTTP API exposing the forgery detection. The analyses are run as jobs
+// by a fixed number of workers, both for the synchronous and the asynchronous requests.
+type server struct {
+	results     string
+	maxUpload   int64
+	params      *params
+	concurrency int
+	retention   time.Duration
+	maxJobs     int
+
+	mu      sync.Mutex
+	jobs    map[string]*job
+	queue   chan *job
+	running int
+}
+
+// detectResponse is the JSON report returned by the detection endpoint.
+type detectResponse struct {
+	ID       string         `json:"id"`
+	Filename string         `json:"filename,omitempty"`
+	Score    float64        `json:"score"`
+	Forged   bool           `json:"forged"`
+	Verdict  string         `json:"verdict"`
+	Evidence *evidence      `json:"evidence"`
+	Fusion   *fusion        `json:"fusion,omitempty"`
+	Regions  []regionReport `json:"regions"`
+	Excluded int            `json:"excluded"`
+	Duration float64        `json:"duration"`
+	Config   *params        `json:"config"`
+	Auto     []string       `json:"auto,omitempty"`
+	Overlay  string         `json:"overlay"`
+	Mask     string         `json:"mask"`
+	Manifest string         `json:"manifest"`
+}
+
+// newServer creates the server analyzing the images with the default parameters.
+// The jobs left unfinished by the previous run are queued again.
+func newServer(results string, maxUpload int64, concurrency, queue int, p *params) (*server, error) {
+	if err := os.MkdirAll(results, 0755); err != nil {
+		return nil, err
+	}
+	s := &server{
+		results:     results,
+		maxUpload:   maxUpload,
+		params:      p,
+		concurrency: concurrency,
+		jobs:        make(map[string]*job),
+	}
+	pending, err := s.loadJobs()
+	if err != nil {
+		return nil, err
+	}
+	if len(pending) > queue {
+		queue = len(pending)
+	}
+	s.queue = make(chan *job, queue)
+	for _, j := range pending {
+		s.queue <- j
+	}
+	return s, nil
+}
+
+// routes returns the handler of the API endpoints.
+func (s *server) routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/health", s.handleHealth)
+	mux.HandleFunc("/detect", s.handleDetect)
+	mux.HandleFunc("/jobs", s.handleJobs)
+	mux.HandleFunc("/jobs/", s.handleJob)
+	mux.HandleFunc("/results/", s.handleResult)
+	mux.HandleFunc("/metrics", s.handleMetrics)
+	return logRequests(mux)
+}
+
+// handleHealth reports the status and the load of the server.
+func (s *server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"status":   "ok",
+		"version":  Version,
+		"busy":     s.running,
+		"capacity": s.concurrency,
+		"queued":   len(s.queue),
+	})
+}
+
+// handleMetrics exports the metrics of the analyses and of the job queue in the Prometheus text format.
+func (s *server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	s.mu.Lock()
+	running, queued := s.running, len(s.queue)
+	s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	stats.write(w)
+	fmt.Fprintln(w, "# HELP forensic_jobs_running Number of jobs being analyzed.")
+	fmt.Fprintln(w, "# TYPE forensic_jobs_running gauge")
+	fmt.Fprintf(w, "forensic_jobs_running %d\n", running)
+	fmt.Fprintln(w, "# HELP forensic_jobs_queued Number of jobs waiting for a worker.")
+	fmt.Fprintln(w, "# TYPE forensic_jobs_queued gauge")
+	fmt.Fprintf(w, "forensic_jobs_queued %d\n", queued)
+}
+
+// handleDetect analyzes the uploaded image and waits for the result.
+// The job is canceled if the client gives up.
+func (s *server) handleDetect(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	j := s.receive(w, r)
+	if j == nil {
+		return
+	}
+	select {
+	case <-j.done:
+	case <-r.Context().Done():
+		s.cancel(j)
+		return
+	}
+
+	res := s.snapshot(j)
+	if res.Status != jobDone {
+		writeError(w, http.StatusUnprocessableEntity, res.Error)
+		return
+	}
+	writeJSON(w, http.StatusOK, res.Result)
+}
+
+// receive saves the image uploaded either as the image field of a multipart form or as the raw
+// request body, and submits it to the queue. The detection parameters are given as query or form
+// values, using the names of the detection flags. It writes the error response and returns nil on failure.
+func (s *server) receive(w http.ResponseWriter, r *http.Request) *job {
+	r.Body = http.MaxBytesReader(w, r.Body, s.maxUpload)
+
+	values := make(map[string]string)
+	for k, v := range r.URL.Query() {
+		values[k] = v[0]
+	}
+
+	var (
+		body     io.Reader = r.Body
+		filename string
+	)
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == "multipart/form-data" {
+		if err := r.ParseMultipartForm(32 << 20); err != nil {
+			writeUploadError(w, err)
+			return nil
+		}
+		defer r.MultipartForm.RemoveAll()
+		for k, v := range r.MultipartForm.Value {
+			values[k] = v[0]
+		}
+		file, header, err := r.FormFile("image")
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "missing image field")
+			return nil
+		}
+		defer file.Close()
+		body, filename = file, header.Filename
+	}
+
+	j, status, err := s.create(filename, values, body)
+	if err != nil {
+		writeError(w, status, err.Error())
+		return nil
+	}
+	return j
+}
+
+// create checks the detection parameters, saves the uploaded image and submits its analysis to the queue.
+// On failure, it returns the HTTP status code of the error.
+func (s *server) create(filename string, values map[string]string, body io.Reader) (*job, int, error) {
+	if err := s.checkParams(values); err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+
+	id, err := newID()
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	dir := filepath.Join(s.results, id)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	j := &job{
+		ID:       id,
+		Status:   jobQueued,
+		Filename: filename,
+		Input:    "input" + strings.ToLower(filepath.Ext(filename)),
+		Params:   values,
+		Created:  time.Now().UTC(),
+		done:     make(chan struct{}),
+	}
+	if err := saveUpload(filepath.Join(dir, j.Input), body); err != nil {
+		os.RemoveAll(dir)
+		status, err := uploadError(err)
+		return nil, status, err
+	}
+	if err := s.submit(j); err != nil {
+		os.RemoveAll(dir)
+		return nil, http.StatusServiceUnavailable, err
+	}
+	return j, http.StatusAccepted, nil
+}
+
+// checkParams checks the detection parameters of a request. Only the parameters of requestParams can be set,
+// and the ones the analysis time grows with (the image size, the block and patch sizes and the number of
+// PatchMatch iterations) can't exceed the values configured for the server.
+func (s *server) checkParams(values map[string]string) error {
+	for name := range values {
+		if !requestParams[paramName(name)] {
+			return fmt.Errorf("the parameter %s can't be set by the request", name)
+		}
+	}
+	q, err := s.params.with(values)
+	if err != nil {
+		return err
+	}
+	for _, c := range []struct {
+		name       string
+		value, max int
+	}{
+		{"size", q.MaxSize, s.params.MaxSize},
+		{"bs", q.BlockSize, s.params.BlockSize},
+		{"ps", q.PatchSize, s.params.PatchSize},
+		{"pi", q.Iterations, s.params.Iterations},
+	} {
+		if c.value > c.max {
+			return fmt.Errorf("the parameter %s can't exceed %d on this server", c.name, c.max)
+		}
+	}
+	return nil
+}
+
+// analyze runs the detection of the job, followed by the tracker, and writes the mask and the chain-of-custody
+// manifest next to the overlay. The job is appended to the run log of the server, in the results directory.
+// The response is nil if the analysis failed or was canceled through the context, the reason being reported by the entry.
+func (s *server) analyze(ctx context.Context, j *job, p *params, t *tracker) (*detectResponse, batchEntry) {
+	dir := filepath.Join(s.results, j.ID)
+	entry, res := analyzeFile(ctx, filepath.Join(dir, j.Input), filepath.Join(dir, "overlay.png"), func(string) (*params, error) {
+		return p, nil
+	}, analysisOptions{tracker: t})
+	if res == nil {
+		return nil, entry
+	}
+	mask := &image.Gray{Pix: res.mask.Pix, Stride: res.mask.Stride, Rect: res.mask.Rect}
+	if err := writePNG(filepath.Join(dir, "mask.png"), mask); err != nil {
+		entry.Status, entry.Error = "error", err.Error()
+		return nil, entry
+	}
+	m := newManifest(*j.Started)
+	err := m.add(entry)
+	if err == nil {
+		err = m.addOutput(filepath.Join(dir, "mask.png"))
+	}
+	if err == nil {
+		_, err = recordRun(m, filepath.Join(dir, "manifest.json"), filepath.Join(s.results, "custody.log"))
+	}
+	if err != nil {
+		entry.Status, entry.Error = "error", err.Error()
+		return nil, entry
+	}
+
+	resp := &detectResponse{
+		ID:       j.ID,
+		Filename: j.Filename,
+		Score:    entry.Score,
+		Forged:   entry.Forged,
+		Verdict:  verdict(entry.Score),
+		Evidence: entry.Evidence,
+		Regions:  make([]regionReport, len(res.regions)),
+		Excluded: entry.Excluded,
+		Duration: entry.Duration,
+		Config:   entry.Config,
+		Auto:     entry.Auto,
+		Overlay:  "/results/" + j.ID + "/overlay.png",
+		Mask:     "/results/" + j.ID + "/mask.png",
+		Manifest: "/results/" + j.ID + "/manifest.json",
+	}
+	for i, reg := range res.regions {
+		resp.Regions[i] = reg.report()
+	}
+	if entry.Fusion != nil {
+		// The composite heatmap is served next to the overlay.
+		f := *entry.Fusion
+		f.Heatmap = "/results/" + j.ID + "/" + filepath.Base(f.Heatmap)
+		resp.Fusion = &f
+	}
+	return resp, entry
+}
+
+// handleResult serves the result images of an analysis.
+func (s *server) handleResult(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/results/"), "/")
+	if len(parts) != 2 || !idPattern.MatchString(parts[0]) || !resultFiles[parts[1]] {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+	path := filepath.Join(s.results, parts[0], parts[1])
+	if _, err := os.Stat(path); err != nil {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+	http.ServeFile(w, r, path)
+}
+
+// saveUpload writes the uploaded image into the file.
+func saveUpload(path string, body io.Reader) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, body); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// newID returns a random identifier.
+func newID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// uploadError returns the status code and the error reported for the errors occurred while reading the uploaded image.
+func uploadError(err error) (int, error) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return http.StatusRequestEntityTooLarge, errors.New("the image exceeds the maximum upload size")
+	}
+	return http.StatusBadRequest, err
+}
+
+// writeUploadError reports the errors occurred while reading the uploaded image.
+func writeUploadError(w http.ResponseWriter, err error) {
+	status, err := uploadError(err)
+	writeError(w, status, err.Error())
+}
+
+// writeError writes the error message in JSON format.
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"error": msg})
+}
+
+// writeJSON writes the value in JSON format with the given status code.
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
+
+// statusRecorder records the status code of the response.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// logRequests logs the requests.
+func logRequests(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		h.ServeHTTP(rec, r)
+		logger.Info("request", "method", r.Method, "path", r.URL.Path, "status", rec.status,
+			"duration", time.Since(start).Seconds())
+	})
+}
+
+// runServe starts the HTTP API server and stops it gracefully on SIGINT or SIGTERM.
+func runServe(args []string) error {
+	if len(args) != 0 {
+		return errUsage
+	}
+	if *serveMaxUpload <= 0 {
+		return fmt.Errorf("the maximum upload size must be positive")
+	}
+	if *serveQueue <= 0 {
+		return fmt.Errorf("the queue size must be positive")
+	}
+	concurrency := *serveConcurrency
+	if concurrency <= 0 {
+		concurrency = workers
+	}
+	if _, ok := presets[*servePreset]; *servePreset != "" && !ok {
+		return fmt.Errorf("unknown preset: %s", *servePreset)
+	}
+	p, err := newParamsResolver(serveFlags, *servePreset, *serveConfig).load(*serveConfig)
+	if err != nil {
+		return err
+	}
+
+	s, err := newServer(*serveResults, *serveMaxUpload<<20, concurrency, *serveQueue, p)
+	if err != nil {
+		return err
+	}
+	s.retention, s.maxJobs = *serveRetention, *serveMaxJobs
+	for i := 0; i < concurrency; i++ {
+		go s.work()
+	}
+	go s.expireJobs()
+
+	srv := &http.Server{
+		Addr:              *serveAddr,
+		Handler:           s.routes(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	errc := make(chan error, 2)
+	go func() {
+		errc <- srv.ListenAndServe()
+	}()
+	logger.Info("listening", "addr", *serveAddr, "results", *serveResults)
+
+	var gs *grpc.Server
+	if *serveGRPCAddr != "" {
+		lis, err := net.Listen("tcp", *serveGRPCAddr)
+		if err != nil {
+			srv.Close()
+			return err
+		}
+		gs = newGRPCServer(s)
+		go func() {
+			errc <- gs.Serve(lis)
+		}()
+		logger.Info("listening", "grpc-addr", *serveGRPCAddr)
+	}
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	select {
+	case err := <-errc:
+		return err
+	case <-stop:
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	if gs != nil {
+		stopGRPC(ctx, gs)
+	}
+	return srv.Shutdown(ctx)
+}
@@ -0,0 +1,317 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+)
+
+// The manifests are signed with Ed25519 into a detached signature file, <manifest>.sig. The signature covers
+// the canonical JSON form of the manifest, so reformatting the file doesn't invalidate it, while any change
+// of a value does. Since the manifest contains the hashes of the input and output files, including the
+// HTML report, the signature also covers them.
+
+var (
+	// Key generation flags
+	keygenFlags = flag.NewFlagSet("keygen", flag.ExitOnError)
+
+	keygenOut = keygenFlags.String("out", "forensic.key", "Private key file; the public key is written into <out>.pub")
+
+	// Verification flags
+	verifyFlags = flag.NewFlagSet("verify", flag.ExitOnError)
+
+	verifyKey = verifyFlags.String("key", "", "Public key of the signer (PEM); without it, the signature is checked with the key it embeds and is not trusted")
+	verifySig = verifyFlags.String("sig", "", "Signature file (default <manifest>.sig)")
+)
+
+// signature is the detached signature of a manifest.
+type signature struct {
+	Algorithm string    `json:"algorithm"`
+	PublicKey string    `json:"public_key"`
+	Signature string    `json:"signature"`
+	Signed    time.Time `json:"signed"`
+}
+
+// canonicalJSON returns the canonical form of the JSON document: compact, with the object keys sorted
+// and the numbers kept as written.
+func canonicalJSON(data []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	if dec.More() {
+		return nil, fmt.Errorf("unexpected data after the JSON document")
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// keyID returns the fingerprint of the public key, in the SHA256:<base64> form.
+func keyID(pub ed25519.PublicKey) string {
+	sum := sha256.Sum256(pub)
+	return "SHA256:" + base64.RawStdEncoding.EncodeToString(sum[:])
+}
+
+// loadPrivateKey reads the Ed25519 private key of a PEM file (PKCS #8).
+func loadPrivateKey(path string) (ed25519.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "PRIVATE KEY" {
+		return nil, fmt.Errorf("%s: no PEM encoded private key found", path)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	priv, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%s: not an Ed25519 key", path)
+	}
+	return priv, nil
+}
+
+// loadPublicKey reads the Ed25519 public key of a PEM file (PKIX). The public key of a private key file is accepted as well.
+func loadPublicKey(path string) (ed25519.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block != nil && block.Type == "PRIVATE KEY" {
+		priv, err := loadPrivateKey(path)
+		if err != nil {
+			return nil, err
+		}
+		return priv.Public().(ed25519.PublicKey), nil
+	}
+	if block == nil || block.Type != "PUBLIC KEY" {
+		return nil, fmt.Errorf("%s: no PEM encoded public key found", path)
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	pub, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("%s: not an Ed25519 key", path)
+	}
+	return pub, nil
+}
+
+// signManifest writes the detached signature of the manifest data into <manifest>.sig. The data is the one
+// just written into the manifest file, which is not read again, so that a change of the file in between
+// isn't signed.
+func signManifest(path string, data []byte, keyFile string) error {
+	priv, err := loadPrivateKey(keyFile)
+	if err != nil {
+		return err
+	}
+	canonical, err := canonicalJSON(data)
+	if err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+
+	sig := signature{
+		Algorithm: "ed25519",
+		PublicKey: base64.StdEncoding.EncodeToString(priv.Public().(ed25519.PublicKey)),
+		Signature: base64.StdEncoding.EncodeToString(ed25519.Sign(priv, canonical)),
+		Signed:    time.Now().UTC(),
+	}
+	out, err := json.MarshalIndent(sig, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path+".sig", append(out, '\n'), 0644)
+}
+
+// runKeygen generates an Ed25519 key pair. The private key file is not overwritten.
+func runKeygen(args []string) error {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return err
+	}
+	privDER, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		return err
+	}
+	pubDER, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(*keygenOut, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if err := pem.Encode(f, &pem.Block{Type: "PRIVATE KEY", Bytes: privDER}); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.WriteFile(*keygenOut+".pub", pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER}), 0644); err != nil {
+		return err
+	}
+
+	if outputFormat == "json" {
+		return printJSON(map[string]string{"private": *keygenOut, "public": *keygenOut + ".pub", "key": keyID(pub)})
+	}
+	fmt.Printf("Private key written to %s\nPublic key written to %s.pub\nKey fingerprint: %s\n", *keygenOut, *keygenOut, keyID(pub))
+	return nil
+}
+
+// fileCheck is the verification of a file referenced by the manifest.
+type fileCheck struct {
+	Path   string `json:"path"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// verification is the outcome of the verification of a signed manifest.
+type verification struct {
+	Manifest  string      `json:"manifest"`
+	Signature string      `json:"signature"`
+	Key       string      `json:"key"`
+	Trusted   bool        `json:"trusted"`
+	Signed    time.Time   `json:"signed"`
+	Files     []fileCheck `json:"files"`
+	Valid     bool        `json:"valid"`
+}
+
+// errSignature is returned for a signature not matching the manifest.
+var errSignature = errors.New("invalid signature")
+
+// checkSignature verifies the detached signature of the manifest data, with the public key if not nil or else
+// with the key embedded in the signature. It returns the key which verified the signature.
+func checkSignature(data []byte, sig *signature, pub ed25519.PublicKey) (ed25519.PublicKey, error) {
+	if sig.Algorithm != "ed25519" {
+		return nil, fmt.Errorf("unsupported signature algorithm: %s", sig.Algorithm)
+	}
+	embedded, err := base64.StdEncoding.DecodeString(sig.PublicKey)
+	if err != nil || len(embedded) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("invalid public key in the signature")
+	}
+	if pub == nil {
+		pub = embedded
+	}
+	raw, err := base64.StdEncoding.DecodeString(sig.Signature)
+	if err != nil {
+		return nil, fmt.Errorf("invalid signature encoding")
+	}
+	canonical, err := canonicalJSON(data)
+	if err != nil {
+		return nil, err
+	}
+	if !ed25519.Verify(pub, canonical, raw) {
+		return pub, errSignature
+	}
+	return pub, nil
+}
+
+// runVerify checks the signature of a manifest and the hashes of the input and output files it references.
+func runVerify(args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+	path := args[0]
+	sigFile := *verifySig
+	if sigFile == "" {
+		sigFile = path + ".sig"
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	m := new(manifest)
+	if err := json.Unmarshal(data, m); err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	sigData, err := os.ReadFile(sigFile)
+	if err != nil {
+		return fmt.Errorf("the manifest is not signed: %v", err)
+	}
+	sig := new(signature)
+	if err := json.Unmarshal(sigData, sig); err != nil {
+		return fmt.Errorf("%s: %v", sigFile, err)
+	}
+	var trusted ed25519.PublicKey
+	if *verifyKey != "" {
+		if trusted, err = loadPublicKey(*verifyKey); err != nil {
+			return err
+		}
+	}
+
+	v := verification{Manifest: path, Signature: "valid", Trusted: trusted != nil, Signed: sig.Signed, Valid: true}
+	pub, err := checkSignature(data, sig, trusted)
+	switch {
+	case err == errSignature:
+		v.Signature, v.Valid = "invalid", false
+	case err != nil:
+		return fmt.Errorf("%s: %v", sigFile, err)
+	case trusted == nil:
+		// Anyone can sign a forged manifest with their own key.
+		v.Signature, v.Valid = "untrusted", false
+	}
+	v.Key = keyID(pub)
+
+	// The files are checked even if the signature is invalid, to show what was altered.
+	var files []custodyFile
+	for _, rec := range m.Images {
+		files = append(files, rec.Input)
+		files = append(files, rec.Files...)
+		files = append(files, rec.Outputs...)
+	}
+	for _, f := range append(files, m.Outputs...) {
+		check := fileCheck{Path: f.Path, Status: "ok"}
+		if err := m.checkFile(f); os.IsNotExist(err) {
+			check.Status, check.Error = "missing", err.Error()
+		} else if err != nil {
+			check.Status, check.Error = "altered", err.Error()
+		}
+		if check.Status != "ok" {
+			v.Valid = false
+		}
+		v.Files = append(v.Files, check)
+	}
+
+	if outputFormat == "json" {
+		if err := printJSON(v); err != nil {
+			return err
+		}
+	} else {
+		fmt.Printf("Signature: %s, key %s, signed at %s\n", v.Signature, v.Key, v.Signed.Format(time.RFC3339))
+		for _, f := range v.Files {
+			fmt.Printf("  %-8s %s\n", f.Status, f.Path)
+		}
+	}
+	if !v.Trusted {
+		return fmt.Errorf("the manifest %s is not verified without the public key of the signer (-key): the signature was only checked with the key it embeds, %s", path, v.Key)
+	}
+	if !v.Valid {
+		return fmt.Errorf("the manifest %s does not verify", path)
+	}
+	return nil
+}
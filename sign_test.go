@@ -0,0 +1,92 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCanonicalJSON(t *testing.T) {
+	for _, tc := range []struct {
+		in, want string
+	}{
+		{`{"b": 1, "a": {"d": [3, 2], "c": null}}`, `{"a":{"c":null,"d":[3,2]},"b":1}`},
+		// The numbers are kept as written.
+		{`{"x": 1.50, "y": 1e3, "z": 12345678901234567890}`, `{"x":1.50,"y":1e3,"z":12345678901234567890}`},
+		// The HTML characters aren't escaped.
+		{"{\"s\": \"<a&b>\\u00e9\"}\n", `{"s":"<a&b>é"}`},
+		{`[]`, `[]`},
+	} {
+		got, err := canonicalJSON([]byte(tc.in))
+		if err != nil {
+			t.Errorf("%s: %v", tc.in, err)
+			continue
+		}
+		if string(got) != tc.want {
+			t.Errorf("%s: got %s, want %s", tc.in, got, tc.want)
+		}
+		// The canonical form is stable.
+		if again, err := canonicalJSON(got); err != nil || string(again) != string(got) {
+			t.Errorf("%s: the canonical form changed to %s (%v)", got, again, err)
+		}
+	}
+
+	for _, in := range []string{`{"a": 1} {"b": 2}`, `{"a": }`, ``} {
+		if _, err := canonicalJSON([]byte(in)); err == nil {
+			t.Errorf("%q: no error", in)
+		}
+	}
+}
+
+func TestSignVerify(t *testing.T) {
+	dir := t.TempDir()
+	key := filepath.Join(dir, "lab.key")
+	defer func(out string) { *keygenOut = out }(*keygenOut)
+	*keygenOut = key
+	if err := runKeygen(nil); err != nil {
+		t.Fatal(err)
+	}
+	output := filepath.Join(dir, "result.png")
+	if err := os.WriteFile(output, []byte("result"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	m := newManifest(time.Now())
+	if err := m.addOutput(output); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "manifest.json")
+	data, err := recordRun(m, path, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := signManifest(path, data, key); err != nil {
+		t.Fatal(err)
+	}
+
+	verify := func(pub string) error {
+		defer func(key string) { *verifyKey = key }(*verifyKey)
+		*verifyKey = pub
+		return runVerify([]string{path})
+	}
+	if err := verify(key + ".pub"); err != nil {
+		t.Errorf("the signed manifest doesn't verify: %v", err)
+	}
+	// The key embedded in the signature is not trusted.
+	if err := verify(""); err == nil {
+		t.Error("the manifest verifies without the public key of the signer")
+	}
+
+	// The signature covers the written data, not the file as changed before the signature.
+	altered := []byte(strings.Replace(string(data), "result.png", "other.png", 1))
+	if err := os.WriteFile(path, altered, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := signManifest(path, data, key); err != nil {
+		t.Fatal(err)
+	}
+	if err := verify(key + ".pub"); err == nil {
+		t.Error("the manifest changed before its signature verifies")
+	}
+}
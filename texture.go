@@ -0,0 +1,71 @@
+package main
+
+import (
+	"image"
+	"math"
+)
+
+// lowTexture reports for each size x size block of the image whether the standard deviation
+// of its luminance is below the threshold. The flat blocks of the skies, walls or overexposed areas
+// are almost identical, so they would match each other at many different offsets.
+// The block having its upper left corner at (x, y) is stored at y*(w-size+1)+x.
+// It returns nil if the threshold is not positive.
+func lowTexture(img *image.NRGBA, size int, threshold float64) []bool {
+	if threshold <= 0 {
+		return nil
+	}
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	bw, bh := w-size+1, h-size+1
+	if bw <= 0 || bh <= 0 {
+		return nil
+	}
+	lum := luminance(img)
+
+	// Integral images of the luminance and of its square, having an extra leading row and column of zeros.
+	sum := make([]float64, (w+1)*(h+1))
+	sumSq := make([]float64, (w+1)*(h+1))
+	for y := 0; y < h; y++ {
+		var row, rowSq float64
+		for x := 0; x < w; x++ {
+			v := lum[y*w+x]
+			row += v
+			rowSq += v * v
+			i := (y+1)*(w+1) + x + 1
+			sum[i] = sum[i-w-1] + row
+			sumSq[i] = sumSq[i-w-1] + rowSq
+		}
+	}
+	area := func(s []float64, x, y int) float64 {
+		a, b := y*(w+1)+x, (y+size)*(w+1)+x
+		return s[b+size] - s[b] - s[a+size] + s[a]
+	}
+
+	n := float64(size * size)
+	flat := make([]bool, bw*bh)
+	for y := 0; y < bh; y++ {
+		for x := 0; x < bw; x++ {
+			mean := area(sum, x, y) / n
+			variance := area(sumSq, x, y)/n - mean*mean
+			flat[y*bw+x] = math.Sqrt(math.Max(variance, 0)) < threshold
+		}
+	}
+	return flat
+}
+
+// blockFootprint returns the mask of the pixels covered by the flagged blocks.
+func blockFootprint(bounds image.Rectangle, flags []bool, size int) *image.Alpha {
+	mask := image.NewAlpha(bounds)
+	bw := bounds.Dx() - size + 1
+	for i, f := range flags {
+		if !f {
+			continue
+		}
+		x, y := i%bw, i/bw
+		for j := y; j < y+size; j++ {
+			for k := x; k < x+size; k++ {
+				mask.Pix[mask.PixOffset(k, j)] = 0xff
+			}
+		}
+	}
+	return mask
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// transform identifies the geometric transformation between a block and its copy.
+type transform int
+
+const (
+	identity transform = iota
+	hflip
+	vflip
+	rot90
+	rot180
+)
+
+var transformNames = map[transform]string{
+	identity: "none",
+	hflip:    "hflip",
+	vflip:    "vflip",
+	rot90:    "rot90",
+	rot180:   "rot180",
+}
+
+// String returns the name of the transformation.
+func (t transform) String() string {
+	return transformNames[t]
+}
+
+// parseTransforms parses a comma separated list of transformation names.
+func parseTransforms(list string) ([]transform, error) {
+	var transforms []transform
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" || name == transformNames[identity] {
+			continue
+		}
+		found := false
+		for t, n := range transformNames {
+			if n == name && t != identity {
+				transforms = append(transforms, t)
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unsupported block transform: %s", name)
+		}
+	}
+	return transforms, nil
+}
+
+// apply maps a point with the linear part of the transformation.
+// The rotations are clockwise, as seen on the image.
+func (t transform) apply(x, y float64) (float64, float64) {
+	switch t {
+	case hflip:
+		return -x, y
+	case vflip:
+		return x, -y
+	case rot90:
+		return -y, x
+	case rot180:
+		return -x, -y
+	}
+	return x, y
+}
+
+// involution reports whether applying the transformation twice gives back the original block.
+func (t transform) involution() bool {
+	return t != rot90
+}
@@ -0,0 +1,404 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultGrid is the parameter space searched by default.
+const defaultGrid = "bs=4,8; dt=0.25,0.4,0.6; ot=0,20; minarea=100,210,400; blur=0,1,2; fe=dct,fmt"
+
+var (
+	// Tuning flags
+	tuneFlags = flag.NewFlagSet("tune", flag.ExitOnError)
+
+	tuneLayout    = tuneFlags.String("layout", "auto", "Dataset layout: auto, comofod, grip, labels")
+	tuneLabels    = tuneFlags.String("labels", "", "Labels file (image, label and optional mask on each line), looked up in the dataset directory if empty")
+	tuneConfig    = tuneFlags.String("config", "", "Configuration file (YAML, JSON or TOML) of the detection parameters not searched")
+	tunePreset    = tuneFlags.String("preset", "", "Parameter preset the searched values are applied on: strict, balanced, sensitive, high-res")
+	tuneMaskThr   = tuneFlags.Float64("mask-threshold", 127, "Intensity above which the pixels of the ground-truth masks are forged")
+	tuneGrid      = tuneFlags.String("grid", defaultGrid, "Searched values of the parameters: name=v1,v2,... or name=min:max:step, separated by semicolons")
+	tuneSearch    = tuneFlags.String("search", "grid", "Search strategy: grid (all the combinations), random")
+	tuneTrials    = tuneFlags.Int("trials", 20, "Number of combinations evaluated by the random search")
+	tuneSeed      = tuneFlags.Int64("seed", 1, "Seed of the random search")
+	tuneObjective = tuneFlags.String("objective", "f1", "Optimized metric: f1 (image level), pixel-f1, fpr (lowest false positive rate with a true positive rate of at least -tpr)")
+	tuneTPR       = tuneFlags.Float64("tpr", 0.9, "Minimum true positive rate of the fpr objective")
+	tuneState     = tuneFlags.String("state", "tune.jsonl", "File recording the evaluated combinations, to resume an interrupted run")
+	tuneOut       = tuneFlags.String("out", "tuned.yaml", "Configuration file (YAML, JSON or TOML) receiving the best parameters")
+)
+
+func init() {
+	defaultParams().register(tuneFlags)
+}
+
+// gridParam is a searched parameter together with its candidate values.
+type gridParam struct {
+	name   string
+	values []string
+}
+
+// trial is the evaluation of a combination of the searched parameter values.
+type trial struct {
+	// Base identifies the dataset and the fixed parameters, so that the recorded
+	// trials are not reused by a run on another dataset or with other parameters.
+	Base    string            `json:"base"`
+	Values  map[string]string `json:"values"`
+	Summary evalSummary       `json:"summary"`
+	// F1 is the image-level F1 score, the pixel-level one being part of the summary.
+	F1       float64 `json:"f1"`
+	Duration float64 `json:"duration"`
+}
+
+// tuneReport is the JSON output of the tune command.
+type tuneReport struct {
+	Dataset   string            `json:"dataset"`
+	Objective string            `json:"objective"`
+	Config    string            `json:"config"`
+	Best      map[string]string `json:"best"`
+	Trials    []trial           `json:"trials"`
+}
+
+// parseGrid parses the searched parameters. Each parameter is given as name=v1,v2,...
+// or name=min:max[:step] for a range of numbers, the parameters being separated by semicolons.
+func parseGrid(spec string) ([]gridParam, error) {
+	var grid []gridParam
+	seen := make(map[string]bool)
+	for _, field := range strings.Split(spec, ";") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		i := strings.IndexByte(field, '=')
+		if i <= 0 {
+			return nil, fmt.Errorf("invalid grid parameter: %s", field)
+		}
+		g := gridParam{name: strings.TrimSpace(field[:i])}
+		if seen[g.name] {
+			return nil, fmt.Errorf("duplicate grid parameter: %s", g.name)
+		}
+		seen[g.name] = true
+
+		for _, v := range strings.Split(field[i+1:], ",") {
+			v = strings.TrimSpace(v)
+			if !strings.Contains(v, ":") {
+				g.values = append(g.values, v)
+				continue
+			}
+			values, err := expandRange(v)
+			if err != nil {
+				return nil, err
+			}
+			g.values = append(g.values, values...)
+		}
+		for _, v := range g.values {
+			if err := defaultParams().set(g.name, v); err != nil {
+				return nil, err
+			}
+		}
+		grid = append(grid, g)
+	}
+	if len(grid) == 0 {
+		return nil, fmt.Errorf("no parameter to search")
+	}
+	return grid, nil
+}
+
+// expandRange returns the numbers of the min:max[:step] range, the step being 1 by default.
+func expandRange(s string) ([]string, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) > 3 {
+		return nil, fmt.Errorf("invalid range: %s", s)
+	}
+	bounds := []float64{0, 0, 1}
+	for i, p := range parts {
+		v, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid range: %s", s)
+		}
+		bounds[i] = v
+	}
+	min, max, step := bounds[0], bounds[1], bounds[2]
+	if step <= 0 || max < min || (max-min)/step > 1000 {
+		return nil, fmt.Errorf("invalid range: %s", s)
+	}
+	var values []string
+	for i := 0; ; i++ {
+		v := min + float64(i)*step
+		if v > max+step*1e-6 {
+			break
+		}
+		values = append(values, strconv.FormatFloat(math.Round(v*1e6)/1e6, 'f', -1, 64))
+	}
+	return values, nil
+}
+
+// combination returns the parameter values of the i-th combination of the grid,
+// the last parameter varying the fastest.
+func combination(grid []gridParam, i int) map[string]string {
+	values := make(map[string]string, len(grid))
+	for k := len(grid) - 1; k >= 0; k-- {
+		n := len(grid[k].values)
+		values[grid[k].name] = grid[k].values[i%n]
+		i /= n
+	}
+	return values
+}
+
+// formatValues returns the parameter values in the name=value form, sorted by name.
+func formatValues(values map[string]string) string {
+	s := make([]string, 0, len(values))
+	for name, value := range values {
+		s = append(s, name+"="+value)
+	}
+	sort.Strings(s)
+	return strings.Join(s, " ")
+}
+
+// rank returns the sort keys of the trial for the objective, the best trials having the highest keys.
+// For the fpr objective the trials reaching the true positive rate come first, by increasing false
+// positive rate, followed by the other ones by decreasing true positive rate.
+func (t *trial) rank(objective string, tpr float64) []float64 {
+	s := t.Summary
+	switch objective {
+	case "pixel-f1":
+		return []float64{s.F1, t.F1}
+	case "fpr":
+		if s.TPR >= tpr {
+			return []float64{1, -s.FPR, s.TPR}
+		}
+		return []float64{0, s.TPR, -s.FPR}
+	}
+	return []float64{t.F1, s.F1}
+}
+
+// metrics returns the metrics of the trial in a human readable form.
+func (t *trial) metrics() string {
+	s := t.Summary
+	m := fmt.Sprintf("F1 %.3f, TPR %.3f, FPR %.3f", t.F1, s.TPR, s.FPR)
+	if s.Masks > 0 {
+		m += fmt.Sprintf(", pixel F1 %.3f", s.F1)
+	}
+	return m
+}
+
+// loadTrials reads the trials recorded in the state file having the given base, indexed by their values.
+// The lines which can't be decoded, like a line truncated by an interruption, are ignored.
+func loadTrials(path, base string) (map[string]trial, error) {
+	trials := make(map[string]trial)
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return trials, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		var t trial
+		if err := json.Unmarshal(scanner.Bytes(), &t); err != nil || t.Base != base {
+			continue
+		}
+		trials[formatValues(t.Values)] = t
+	}
+	return trials, scanner.Err()
+}
+
+// runTune searches the detection parameters giving the best results on the dataset directory given as argument.
+// Each combination of the searched values is evaluated on the whole dataset, the images being analyzed
+// concurrently, and recorded in the state file, so that an interrupted search resumes where it stopped.
+func runTune(args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+	dir := args[0]
+	if _, ok := presets[*tunePreset]; *tunePreset != "" && !ok {
+		return fmt.Errorf("unknown preset: %s", *tunePreset)
+	}
+	switch *tuneObjective {
+	case "f1", "pixel-f1", "fpr":
+	default:
+		return fmt.Errorf("unsupported objective: %s", *tuneObjective)
+	}
+	grid, err := parseGrid(*tuneGrid)
+	if err != nil {
+		return err
+	}
+	total := 1
+	for _, g := range grid {
+		if total *= len(g.values); total > 1e6 {
+			return fmt.Errorf("the grid has more than a million combinations")
+		}
+	}
+
+	var order []int
+	switch *tuneSearch {
+	case "grid":
+		for i := 0; i < total; i++ {
+			order = append(order, i)
+		}
+	case "random":
+		if *tuneTrials < 1 {
+			return fmt.Errorf("the number of trials must be at least 1")
+		}
+		rng := rand.New(rand.NewSource(*tuneSeed))
+		drawn := make(map[int]bool)
+		for len(order) < *tuneTrials && len(order) < total {
+			if i := rng.Intn(total); !drawn[i] {
+				drawn[i] = true
+				order = append(order, i)
+			}
+		}
+	default:
+		return fmt.Errorf("unsupported search strategy: %s", *tuneSearch)
+	}
+
+	resolver := newParamsResolver(tuneFlags, *tunePreset, *tuneConfig)
+	p := defaultParams()
+	if err := p.apply(resolver.explicit); err != nil {
+		return err
+	}
+	if err := p.validate(); err != nil {
+		return err
+	}
+	// The flags of the searched parameters are overridden by the searched values.
+	for _, g := range grid {
+		delete(resolver.explicit, g.name)
+	}
+
+	samples, err := loadDataset(dir, *tuneLayout, *tuneLabels)
+	if err != nil {
+		return err
+	}
+	if len(samples) == 0 {
+		return fmt.Errorf("no images found in %s", dir)
+	}
+	sort.Slice(samples, func(i, j int) bool {
+		return samples[i].path < samples[j].path
+	})
+
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	base := fmt.Sprintf("%s layout=%s labels=%s preset=%s config=%s mask-threshold=%g %s", abs,
+		*tuneLayout, *tuneLabels, *tunePreset, *tuneConfig, *tuneMaskThr, formatValues(resolver.explicit))
+	recorded, err := loadTrials(*tuneState, base)
+	if err != nil {
+		return err
+	}
+	state, err := os.OpenFile(*tuneState, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer state.Close()
+
+	outDir, err := os.MkdirTemp("", "forensic-tune")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(outDir)
+
+	var done func(n, total int, e evalEntry)
+	if outputFormat == "text" && verbosity > 1 {
+		done = printEvalEntry
+	}
+	trials := make([]trial, 0, len(order))
+	for n, i := range order {
+		values := combination(grid, i)
+		key := formatValues(values)
+		t, resumed := recorded[key]
+		if !resumed {
+			resolve := func(image string) (*params, error) {
+				p, err := resolver.resolve(image)
+				if err != nil {
+					return nil, err
+				}
+				return p.with(values)
+			}
+			start := time.Now()
+			entries := evaluate(samples, outDir, resolve, *tuneMaskThr, done)
+			t = trial{
+				Base:     base,
+				Values:   values,
+				Summary:  summarize(entries),
+				Duration: time.Since(start).Seconds(),
+			}
+			t.F1 = ratio(2*t.Summary.TP, 2*t.Summary.TP+t.Summary.FP+t.Summary.FN)
+
+			line, err := json.Marshal(t)
+			if err != nil {
+				return err
+			}
+			if _, err := state.Write(append(line, '\n')); err != nil {
+				return err
+			}
+		}
+		trials = append(trials, t)
+
+		if outputFormat == "text" && verbosity > 0 {
+			fmt.Printf("[%d/%d] %s: %s", n+1, len(order), key, t.metrics())
+			if resumed {
+				fmt.Print(" (recorded)")
+			}
+			fmt.Println()
+		}
+	}
+
+	sort.SliceStable(trials, func(i, j int) bool {
+		a, b := trials[i].rank(*tuneObjective, *tuneTPR), trials[j].rank(*tuneObjective, *tuneTPR)
+		for k := range a {
+			if a[k] != b[k] {
+				return a[k] > b[k]
+			}
+		}
+		return false
+	})
+	best := trials[0]
+	if best.Summary.Failed == best.Summary.Images {
+		return fmt.Errorf("the analysis failed on all the images")
+	}
+
+	// The configuration file contains the fixed parameters besides the best searched values.
+	config := make(map[string]string)
+	if *tuneConfig != "" {
+		if config, err = loadConfig(*tuneConfig); err != nil {
+			return err
+		}
+	}
+	if *tunePreset != "" {
+		config["preset"] = *tunePreset
+	}
+	for _, set := range []map[string]string{resolver.explicit, best.Values} {
+		for name, value := range set {
+			config[name] = value
+		}
+	}
+	comments := []string{
+		fmt.Sprintf("Tuned on %s (%d images) for the %s objective: %s", dir, best.Summary.Images, *tuneObjective, best.metrics()),
+	}
+	if err := writeConfig(*tuneOut, config, comments); err != nil {
+		return err
+	}
+
+	if outputFormat == "json" {
+		return printJSON(tuneReport{Dataset: dir, Objective: *tuneObjective, Config: *tuneOut, Best: config, Trials: trials})
+	}
+	if *tuneObjective == "fpr" && best.Summary.TPR < *tuneTPR {
+		fmt.Printf("No combination reaches the true positive rate of %.3f.\n", *tuneTPR)
+	}
+	fmt.Printf("Best: %s (%s)\n", formatValues(best.Values), best.metrics())
+	fmt.Printf("Configuration written to %s\n", *tuneOut)
+	return nil
+}
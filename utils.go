@@ -65,6 +65,20 @@ func YUVtoRGB(y, u, v uint32) (uint32, uint32, uint32) {
 	return uint32(r), uint32(g), uint32(b)
 }
 
+// luminance returns the luminance values of the image pixels in row-major order.
+func luminance(img *image.NRGBA) []float64 {
+	dx, dy := img.Bounds().Dx(), img.Bounds().Dy()
+	lum := make([]float64, dx*dy)
+	for y := 0; y < dy; y++ {
+		for x := 0; x < dx; x++ {
+			i := img.PixOffset(img.Bounds().Min.X+x, img.Bounds().Min.Y+y)
+			r, g, b := img.Pix[i], img.Pix[i+1], img.Pix[i+2]
+			lum[y*dx+x] = 0.299*float64(r) + 0.587*float64(g) + 0.114*float64(b)
+		}
+	}
+	return lum
+}
+
 // Converts any image type to *image.NRGBA with min-point at (0, 0).
 func imgToNRGBA(img image.Image) *image.NRGBA {
 	srcBounds := img.Bounds()